@@ -24,36 +24,36 @@ func init() {
 // This is set from the Go module runtime version.
 var Version = "devel"
 
-// CookieName is the name of the cookie that Anubis uses in order to validate
-// access.
-var CookieName = "techaro.lol-anubis"
+// CookieName is the default name of the cookie that Anubis uses in order to
+// validate access. It can be overridden per server with Settings.CookieName.
+const CookieName = "techaro.lol-anubis"
 
-// TestCookieName is the name of the cookie that Anubis uses in order to check
-// if cookies are enabled on the client's browser.
-var TestCookieName = "techaro.lol-anubis-cookie-verification"
+// TestCookieName is the default name of the cookie that Anubis uses in order to
+// check if cookies are enabled on the client's browser. It can be overridden
+// per server with Settings.TestCookieName.
+const TestCookieName = "techaro.lol-anubis-cookie-verification"
 
 // CookieDefaultExpirationTime is the amount of time before the cookie/JWT expires.
 const CookieDefaultExpirationTime = 7 * 24 * time.Hour
 
-// BasePrefix is a global prefix for all Anubis endpoints. Can be emptied to remove the prefix entirely.
-var BasePrefix = ""
-
-// PublicUrl is the externally accessible URL for this Anubis instance.
-var PublicUrl = ""
-
 // StaticPath is the location where all static Anubis assets are located.
 const StaticPath = "/.within.website/x/cmd/anubis/"
 
 // APIPrefix is the location where all Anubis API endpoints are located.
 const APIPrefix = "/.within.website/x/cmd/anubis/api/"
 
+// ChallengeAPIHeader is set on challenge pages to the path of the JSON
+// challenge API, so that clients that can't run the challenge page know where
+// to ask for a challenge instead.
+const ChallengeAPIHeader = "X-Anubis-Challenge-Api"
+
+// JWTIssuer is the default iss claim of the tokens Anubis signs.
+const JWTIssuer = "anubis"
+
+// JWKSPath is the location of the JSON Web Key Set upstreams can use to
+// verify the tokens Anubis signs.
+const JWKSPath = APIPrefix + ".well-known/jwks.json"
+
 // DefaultDifficulty is the default "difficulty" (number of leading zeroes)
 // that must be met by the client in order to pass the challenge.
 const DefaultDifficulty = 4
-
-// ForcedLanguage is the language being used instead of the one of the request's Accept-Language header
-// if being set.
-var ForcedLanguage = ""
-
-// UseSimplifiedExplanation can be set to true for using the simplified explanation
-var UseSimplifiedExplanation = false
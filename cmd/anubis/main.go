@@ -31,6 +31,7 @@ import (
 	"github.com/TecharoHQ/anubis/internal"
 	libanubis "github.com/TecharoHQ/anubis/lib"
 	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/keyring"
 	"github.com/TecharoHQ/anubis/lib/metrics"
 	botPolicy "github.com/TecharoHQ/anubis/lib/policy"
 	"github.com/TecharoHQ/anubis/lib/thoth"
@@ -49,6 +50,8 @@ var (
 	cookieDomain             = flag.String("cookie-domain", "", "if set, the top-level domain that the Anubis cookie will be valid for")
 	cookieDynamicDomain      = flag.Bool("cookie-dynamic-domain", false, "if set, automatically set the cookie Domain value based on the request domain")
 	cookieExpiration         = flag.Duration("cookie-expiration-time", anubis.CookieDefaultExpirationTime, "The amount of time the authorization cookie is valid for")
+	cookieRenewAfter         = flag.Float64("cookie-renew-after", 0, "if set, renew the authorization cookie once this fraction of its lifetime has passed (e.g. 0.5)")
+	cookieMaxLifetime        = flag.Duration("cookie-max-lifetime", 30*24*time.Hour, "the longest renewed authorization cookies stay valid after the challenge was solved, 0 for no limit")
 	cookiePrefix             = flag.String("cookie-prefix", anubis.CookieName, "prefix for browser cookies created by Anubis")
 	cookiePartitioned        = flag.Bool("cookie-partitioned", true, "if true, sets the partitioned flag on Anubis cookies, enabling CHIPS support")
 	difficultyInJWT          = flag.Bool("difficulty-in-jwt", false, "if true, adds a difficulty field in the JWT claims")
@@ -60,6 +63,7 @@ var (
 	cookieSameSite           = flag.String("cookie-same-site", "None", "sets the same site option on Anubis cookies, will auto-downgrade None to Lax if cookie-secure is false. Valid values are None, Lax, Strict, and Default.")
 	ed25519PrivateKeyHex     = flag.String("ed25519-private-key-hex", "", "private key used to sign JWTs, if not set a random one will be assigned")
 	ed25519PrivateKeyHexFile = flag.String("ed25519-private-key-hex-file", "", "file name containing value for ed25519-private-key-hex")
+	signingKeysDir           = flag.String("signing-keys-dir", "", "directory of JWT signing and verification keys, reloaded when they change (see docs for the file format)")
 	metricsBind              = flag.String("metrics-bind", ":9090", "network address to bind metrics to")
 	metricsBindNetwork       = flag.String("metrics-bind-network", "tcp", "network family for the metrics server to bind to")
 	socketMode               = flag.String("socket-mode", "0770", "socket mode (permissions) for unix domain sockets.")
@@ -89,6 +93,10 @@ var (
 	thothInsecure        = flag.Bool("thoth-insecure", false, "if set, connect to Thoth over plain HTTP/2, don't enable this unless support told you to")
 	thothURL             = flag.String("thoth-url", "", "if set, URL for Thoth, the IP reputation database for Anubis")
 	thothToken           = flag.String("thoth-token", "", "if set, API token for Thoth, the IP reputation database for Anubis")
+	adminToken           = flag.String("admin-token", "", "if set, enables the admin API for requests that present this bearer token")
+	revocationFailClosed = flag.Bool("revocation-fail-closed", false, "if set, reject tokens when the revocation list can't be read instead of accepting them")
+	jwtIssuer            = flag.String("jwt-issuer", anubis.JWTIssuer, "iss claim of the JWTs Anubis signs")
+	jwtAudience          = flag.String("jwt-audience", "", "aud claim of the JWTs Anubis signs, defaults to the domain the cookie is set for")
 	jwtRestrictionHeader = flag.String("jwt-restriction-header", "X-Real-IP", "If set, the JWT is only valid if the current value of this header matched the value when the JWT was created")
 )
 
@@ -309,32 +317,12 @@ func run(ctx context.Context) {
 	lg.DebugContext(ctx, "swapped to new logger")
 	slog.SetDefault(lg)
 
-	if *metricsBind != "" || policy.Metrics != nil {
-		wg.Add(1)
-
-		ms := &metrics.Server{
-			Config: policy.Metrics,
-			Log:    lg,
-		}
-
-		if policy.Metrics == nil {
-			lg.DebugContext(ctx, "migrating flags to metrics config", "bind", *metricsBind, "network", *metricsBindNetwork, "socket-mode", *socketMode)
-			ms.Config = &config.Metrics{
-				Bind:       *metricsBind,
-				Network:    *metricsBindNetwork,
-				SocketMode: *socketMode,
-			}
-		}
-
-		go ms.Run(ctx, wg.Done)
-	}
-
 	// Warn if persistent storage is used without a configured signing key
 	if policy.Store.IsPersistent() {
-		if *hs512Secret == "" && *ed25519PrivateKeyHex == "" && *ed25519PrivateKeyHexFile == "" {
+		if *hs512Secret == "" && *ed25519PrivateKeyHex == "" && *ed25519PrivateKeyHexFile == "" && *signingKeysDir == "" {
 			lg.WarnContext(ctx, "[misconfiguration] persistent storage backend is configured, but no private key is set. "+
 				"Challenges will be invalidated when Anubis restarts. "+
-				"Set HS512_SECRET, ED25519_PRIVATE_KEY_HEX, or ED25519_PRIVATE_KEY_HEX_FILE to ensure challenges survive service restarts. "+
+				"Set HS512_SECRET, ED25519_PRIVATE_KEY_HEX, ED25519_PRIVATE_KEY_HEX_FILE, or SIGNING_KEYS_DIR to ensure challenges survive service restarts. "+
 				"See: https://anubis.techaro.lol/docs/admin/installation#key-generation")
 		}
 	}
@@ -368,10 +356,18 @@ func run(ctx context.Context) {
 	}
 
 	var ed25519Priv ed25519.PrivateKey
-	if *hs512Secret != "" && (*ed25519PrivateKeyHex != "" || *ed25519PrivateKeyHexFile != "") {
+	var kr *keyring.Keyring
+	if *signingKeysDir != "" && (*hs512Secret != "" || *ed25519PrivateKeyHex != "" || *ed25519PrivateKeyHexFile != "") {
+		log.Fatal("do not specify both SIGNING_KEYS_DIR and HS512 or ED25519 secrets")
+	} else if *signingKeysDir != "" {
+		kr, err = keyring.LoadDir(*signingKeysDir, keyring.DefaultCheckInterval, lg.With("subsystem", "keyring"))
+		if err != nil {
+			log.Fatalf("failed to load SIGNING_KEYS_DIR %s: %v", *signingKeysDir, err)
+		}
+	} else if *hs512Secret != "" && (*ed25519PrivateKeyHex != "" || *ed25519PrivateKeyHexFile != "") {
 		log.Fatal("do not specify both HS512 and ED25519 secrets")
 	} else if *hs512Secret != "" {
-		ed25519Priv = ed25519.PrivateKey(*hs512Secret)
+		// lib.New signs with HS512Secret, set below.
 	} else if *ed25519PrivateKeyHex != "" && *ed25519PrivateKeyHexFile != "" {
 		log.Fatal("do not specify both ED25519_PRIVATE_KEY_HEX and ED25519_PRIVATE_KEY_HEX_FILE")
 	} else if *ed25519PrivateKeyHex != "" {
@@ -412,11 +408,6 @@ func run(ctx context.Context) {
 		lg.WarnContext(ctx, "REDIRECT_DOMAINS is not set, Anubis will redirect to any domain, see https://anubis.techaro.lol/docs/admin/configuration/redirect-domains")
 	}
 
-	anubis.CookieName = *cookiePrefix + "-auth"
-	anubis.TestCookieName = *cookiePrefix + "-cookie-verification"
-	anubis.ForcedLanguage = *forcedLanguage
-	anubis.UseSimplifiedExplanation = *useSimplifiedExplanation
-
 	// If OpenGraph configuration values are not set in the config file, use the
 	// values from flags / envvars.
 	if !policy.OpenGraph.Enabled {
@@ -437,9 +428,12 @@ func run(ctx context.Context) {
 		ServeRobotsTXT:           *robotsTxt,
 		ED25519PrivateKey:        ed25519Priv,
 		HS512Secret:              []byte(*hs512Secret),
+		Keyring:                  kr,
 		CookieDomain:             *cookieDomain,
 		CookieDynamicDomain:      *cookieDynamicDomain,
 		CookieExpiration:         *cookieExpiration,
+		CookieRenewAfter:         *cookieRenewAfter,
+		CookieMaxLifetime:        *cookieMaxLifetime,
 		CookiePartitioned:        *cookiePartitioned,
 		RedirectDomains:          redirectDomainsList,
 		Target:                   *target,
@@ -450,13 +444,42 @@ func run(ctx context.Context) {
 		CookieSameSite:           parseSameSite(*cookieSameSite),
 		PublicUrl:                *publicUrl,
 		JWTRestrictionHeader:     *jwtRestrictionHeader,
+		JWTIssuer:                *jwtIssuer,
+		JWTAudience:              *jwtAudience,
 		Logger:                   policy.Logger.With("subsystem", "anubis"),
 		DifficultyInJWT:          *difficultyInJWT,
+		CookieName:               *cookiePrefix + "-auth",
+		TestCookieName:           *cookiePrefix + "-cookie-verification",
+		ForcedLanguage:           *forcedLanguage,
+		UseSimplifiedExplanation: *useSimplifiedExplanation,
+		AdminToken:               *adminToken,
+		RevocationFailClosed:     *revocationFailClosed,
 	})
 	if err != nil {
 		log.Fatalf("can't construct libanubis.Server: %v", err)
 	}
 
+	if *metricsBind != "" || policy.Metrics != nil {
+		wg.Add(1)
+
+		ms := &metrics.Server{
+			Config: policy.Metrics,
+			Log:    lg,
+			JWKS:   http.HandlerFunc(s.ServeJWKS),
+		}
+
+		if policy.Metrics == nil {
+			lg.DebugContext(ctx, "migrating flags to metrics config", "bind", *metricsBind, "network", *metricsBindNetwork, "socket-mode", *socketMode)
+			ms.Config = &config.Metrics{
+				Bind:       *metricsBind,
+				Network:    *metricsBindNetwork,
+				SocketMode: *socketMode,
+			}
+		}
+
+		go ms.Run(ctx, wg.Done)
+	}
+
 	var h http.Handler
 	h = s
 	h = internal.CustomRealIPHeader(*customRealIPHeader, h)
@@ -505,6 +528,10 @@ func run(ctx context.Context) {
 		log.Fatal(err)
 	}
 	wg.Wait()
+
+	if err := s.Close(); err != nil {
+		log.Printf("cannot close anubis: %v", err)
+	}
 }
 
 func extractEmbedFS(fsys embed.FS, root string, destDir string) error {
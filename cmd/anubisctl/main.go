@@ -0,0 +1,169 @@
+// Command anubisctl manages a running Anubis instance through its admin API,
+// and inspects and migrates the storage backends Anubis uses.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/TecharoHQ/anubis"
+	"github.com/TecharoHQ/anubis/lib/revocation"
+	"github.com/facebookgo/flagenv"
+)
+
+var (
+	anubisURL   = flag.String("anubis-url", "http://localhost:8923", "URL of the Anubis instance, including its base prefix if it has one")
+	adminToken  = flag.String("admin-token", "", "admin token of the Anubis instance, see ADMIN_TOKEN")
+	versionFlag = flag.Bool("version", false, "print Anubis version")
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"revoke": {
+		usage: "revoke tokens so that clients have to solve a challenge again",
+		run: func(args []string) error {
+			return revocations(http.MethodPost, "revoke", args)
+		},
+	},
+	"unrevoke": {
+		usage: "lift a revocation made with revoke",
+		run: func(args []string) error {
+			return revocations(http.MethodDelete, "unrevoke", args)
+		},
+	},
+	"store": {
+		usage: "inspect, dump and restore the storage backend of a policy file",
+		run:   storeCmd,
+	},
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <command> [command options]\n\nCommands:\n", os.Args[0])
+		for _, name := range []string{"revoke", "unrevoke", "store"} {
+			fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+		}
+		fmt.Fprintln(os.Stderr, "\nOptions:")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\nExamples:")
+		fmt.Fprintln(os.Stderr, "  # Revoke every token issued so far")
+		fmt.Fprintln(os.Stderr, "  anubisctl revoke -issued-before now")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "  # Revoke the tokens a single address is using")
+		fmt.Fprintln(os.Stderr, "  anubisctl revoke -ip 198.51.100.7")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "  # List the keys in the storage backend of a policy file")
+		fmt.Fprintln(os.Stderr, "  anubisctl store list -policy-fname botPolicies.yaml")
+	}
+}
+
+func main() {
+	flagenv.Parse()
+	flag.Parse()
+
+	if *versionFlag {
+		fmt.Println("anubisctl", anubis.Version)
+		return
+	}
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(flag.Args()[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func revocations(method, name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	challengeID := fs.String("challenge", "", "ID of the challenge the token was issued for")
+	ip := fs.String("ip", "", "IP address presenting the tokens")
+	issuedBefore := fs.String("issued-before", "", "RFC 3339 timestamp, or now, before which the tokens were issued")
+	fs.Parse(args) //nolint:errcheck
+
+	req := revocation.Request{
+		ChallengeID: *challengeID,
+		IP:          *ip,
+	}
+
+	switch *issuedBefore {
+	case "":
+	case "now":
+		now := time.Now()
+		req.IssuedBefore = &now
+	default:
+		t, err := time.Parse(time.RFC3339, *issuedBefore)
+		if err != nil {
+			return fmt.Errorf("-issued-before must be an RFC 3339 timestamp or now: %w", err)
+		}
+		req.IssuedBefore = &t
+	}
+
+	if err := req.Valid(); err != nil {
+		return err
+	}
+
+	return callAdmin(method, "admin/revocations", req)
+}
+
+// callAdmin sends body to the admin API endpoint and fails unless it
+// succeeds.
+func callAdmin(method, endpoint string, body any) error {
+	if *adminToken == "" {
+		return errors.New("ADMIN_TOKEN or -admin-token must be set")
+	}
+
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	u := strings.TrimSuffix(*anubisURL, "/") + anubis.APIPrefix + endpoint
+	req, err := http.NewRequest(method, u, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+*adminToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("%s %s: %s: %s", method, u, resp.Status, apiErr.Error)
+	}
+
+	return nil
+}
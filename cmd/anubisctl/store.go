@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/store"
+)
+
+var storeCommands = map[string]command{
+	"list": {
+		usage: "list keys and when they expire",
+		run:   storeList,
+	},
+	"get": {
+		usage: "print the value of a key",
+		run:   storeGet,
+	},
+	"delete": {
+		usage: "delete keys",
+		run:   storeDelete,
+	},
+	"dump": {
+		usage: "write keys, values and expiry times as JSON lines",
+		run:   storeDump,
+	},
+	"restore": {
+		usage: "read JSON lines written by dump and store them",
+		run:   storeRestore,
+	},
+}
+
+// storeCmd runs a store subcommand against the storage backend configured
+// in a policy file. It talks to the backend directly, not to Anubis.
+func storeCmd(args []string) error {
+	if len(args) == 0 {
+		storeUsage()
+		os.Exit(2)
+	}
+
+	cmd, ok := storeCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown store command %q\n\n", args[0])
+		storeUsage()
+		os.Exit(2)
+	}
+
+	return cmd.run(args[1:])
+}
+
+func storeUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s store <command> -policy-fname <policy file> [command options]\n\nCommands:\n", os.Args[0])
+	for _, name := range []string{"list", "get", "delete", "dump", "restore"} {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, storeCommands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nExamples:")
+	fmt.Fprintln(os.Stderr, "  # Show the challenges that are waiting to be solved")
+	fmt.Fprintln(os.Stderr, "  anubisctl store list -policy-fname botPolicies.yaml -prefix challenge:")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "  # Move from bbolt to valkey")
+	fmt.Fprintln(os.Stderr, "  anubisctl store dump -policy-fname old.yaml | anubisctl store restore -policy-fname new.yaml")
+}
+
+// storeFlags returns a flag set for a store subcommand with the flag that
+// picks the policy file.
+func storeFlags(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("store "+name, flag.ExitOnError)
+	policyFname := fs.String("policy-fname", os.Getenv("POLICY_FNAME"), "policy file whose store block configures the storage backend, defaults to POLICY_FNAME")
+	return fs, policyFname
+}
+
+// openStore builds the storage backend configured in the policy file fname.
+func openStore(ctx context.Context, fname string) (store.Interface, error) {
+	if fname == "" {
+		return nil, errors.New("POLICY_FNAME or -policy-fname must be set")
+	}
+
+	fin, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer fin.Close() //nolint:errcheck
+
+	c, err := config.Load(fin, fname)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Store.Backend == "memory" {
+		return nil, errors.New("the memory storage backend only exists inside the Anubis process, there is nothing to open")
+	}
+
+	fac, ok := store.Get(c.Store.Backend)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", config.ErrUnknownStoreBackend, c.Store.Backend)
+	}
+
+	// bbolt waits for as long as another process holds the database open.
+	slow := time.AfterFunc(5*time.Second, func() {
+		log.Printf("still opening the %s storage backend, if this is a bbolt database stop Anubis first", c.Store.Backend)
+	})
+	defer slow.Stop()
+
+	return fac.Build(ctx, c.Store.Parameters)
+}
+
+// storeContext returns a context that is canceled on interrupt.
+func storeContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+func storeList(args []string) error {
+	fs, policyFname := storeFlags("list")
+	prefix := fs.String("prefix", "", "only list keys starting with this prefix")
+	fs.Parse(args) //nolint:errcheck
+
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	s, err := openStore(ctx, *policyFname)
+	if err != nil {
+		return err
+	}
+
+	return store.List(ctx, s, *prefix, func(e store.Entry) error {
+		expires := "never"
+		if !e.Expires.IsZero() {
+			expires = e.Expires.Format(time.RFC3339)
+		}
+
+		_, err := fmt.Printf("%s\t%s\n", e.Key, expires)
+		return err
+	})
+}
+
+func storeGet(args []string) error {
+	fs, policyFname := storeFlags("get")
+	fs.Parse(args) //nolint:errcheck
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: anubisctl store get -policy-fname <policy file> <key>")
+	}
+
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	s, err := openStore(ctx, *policyFname)
+	if err != nil {
+		return err
+	}
+
+	value, err := s.Get(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Printf("%s\n", value)
+	return err
+}
+
+func storeDelete(args []string) error {
+	fs, policyFname := storeFlags("delete")
+	fs.Parse(args) //nolint:errcheck
+
+	if fs.NArg() == 0 {
+		return errors.New("usage: anubisctl store delete -policy-fname <policy file> <key>...")
+	}
+
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	s, err := openStore(ctx, *policyFname)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, key := range fs.Args() {
+		if err := s.Delete(ctx, key); err != nil {
+			errs = append(errs, fmt.Errorf("can't delete %q: %w", key, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func storeDump(args []string) error {
+	fs, policyFname := storeFlags("dump")
+	prefix := fs.String("prefix", "", "only dump keys starting with this prefix")
+	output := fs.String("o", "-", "file to write to, - for standard output")
+	fs.Parse(args) //nolint:errcheck
+
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	s, err := openStore(ctx, *policyFname)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		fout, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer fout.Close() //nolint:errcheck
+		w = fout
+	}
+
+	n, err := store.Dump(ctx, s, *prefix, w)
+	log.Printf("dumped %d keys", n)
+	return err
+}
+
+func storeRestore(args []string) error {
+	fs, policyFname := storeFlags("restore")
+	input := fs.String("i", "-", "file to read from, - for standard input")
+	defaultExpiry := fs.Duration("default-expiry", 24*time.Hour, "how long keys that were dumped without an expiry time are kept")
+	fs.Parse(args) //nolint:errcheck
+
+	ctx, cancel := storeContext()
+	defer cancel()
+
+	s, err := openStore(ctx, *policyFname)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		fin, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer fin.Close() //nolint:errcheck
+		r = fin
+	}
+
+	n, err := store.Restore(ctx, s, r, *defaultExpiry)
+	log.Printf("restored %d keys", n)
+	return err
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeStorePolicy writes a policy file whose store is a SQLite database in
+// a temporary directory. SQLite is used instead of bbolt as the commands
+// never close the store, and bbolt can't open the same database twice in
+// one process.
+func writeStorePolicy(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "policy.yaml")
+
+	policy := `bots:
+  - name: everyones-invited
+    remote_addresses:
+      - "0.0.0.0/0"
+      - "::/0"
+    action: ALLOW
+
+store:
+  backend: sql
+  parameters:
+    driver: sqlite
+    dsn: ` + filepath.Join(dir, "anubis.db") + "\n"
+
+	if err := os.WriteFile(fname, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return fname
+}
+
+// captureStdout returns what fn writes to standard output.
+func captureStdout(t *testing.T, fn func() error) string {
+	t.Helper()
+
+	fout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fout.Close() //nolint:errcheck
+
+	stdout := os.Stdout
+	os.Stdout = fout
+	err = fn()
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fout.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(fout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestStoreDumpRestore(t *testing.T) {
+	dir := t.TempDir()
+	dump := filepath.Join(dir, "dump.jsonl")
+	if err := os.WriteFile(dump, []byte(
+		`{"key":"challenge:one","value":"Zmlyc3Q="}`+"\n"+
+			`{"key":"honeypot:two","value":"c2Vjb25k"}`+"\n",
+	), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	src := writeStorePolicy(t)
+	if err := storeRestore([]string{"-policy-fname", src, "-i", dump}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	out := captureStdout(t, func() error {
+		return storeList([]string{"-policy-fname", src, "-prefix", "challenge:"})
+	})
+	if !strings.HasPrefix(out, "challenge:one\t") || strings.Contains(out, "honeypot:two") {
+		t.Errorf("list -prefix challenge: printed %q", out)
+	}
+
+	out = captureStdout(t, func() error {
+		return storeGet([]string{"-policy-fname", src, "challenge:one"})
+	})
+	if out != "first\n" {
+		t.Errorf("get printed %q, want %q", out, "first\n")
+	}
+
+	moved := filepath.Join(dir, "moved.jsonl")
+	if err := storeDump([]string{"-policy-fname", src, "-o", moved}); err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+
+	dst := writeStorePolicy(t)
+	if err := storeRestore([]string{"-policy-fname", dst, "-i", moved}); err != nil {
+		t.Fatalf("restore into a second store: %v", err)
+	}
+
+	out = captureStdout(t, func() error {
+		return storeGet([]string{"-policy-fname", dst, "honeypot:two"})
+	})
+	if out != "second\n" {
+		t.Errorf("get after moving stores printed %q, want %q", out, "second\n")
+	}
+
+	if err := storeDelete([]string{"-policy-fname", dst, "honeypot:two"}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := storeDelete([]string{"-policy-fname", dst, "honeypot:two"}); err == nil {
+		t.Error("deleting a missing key succeeded")
+	}
+	if err := storeGet([]string{"-policy-fname", dst, "honeypot:two"}); err == nil {
+		t.Error("getting a deleted key succeeded")
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		policy string
+		want   string
+	}{
+		{
+			name: "no policy file",
+			want: "POLICY_FNAME",
+		},
+		{
+			name: "memory backend",
+			policy: `bots:
+  - name: everyones-invited
+    remote_addresses:
+      - "0.0.0.0/0"
+    action: ALLOW
+`,
+			want: "memory storage backend",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var fname string
+			if tt.policy != "" {
+				fname = filepath.Join(t.TempDir(), "policy.yaml")
+				if err := os.WriteFile(fname, []byte(tt.policy), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := openStore(t.Context(), fname)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("openStore() = %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
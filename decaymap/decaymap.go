@@ -2,9 +2,13 @@ package decaymap
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// evictionSamples is how many entries are looked at to pick one to evict.
+const evictionSamples = 5
+
 func Zilch[T any]() T {
 	var zero T
 	return zero
@@ -12,7 +16,14 @@ func Zilch[T any]() T {
 
 // Impl is a lazy key->value map. It's a wrapper around a map and a mutex. If values exceed their time-to-live, they are pruned at Get time.
 type Impl[K comparable, V any] struct {
-	data map[K]decayMapEntry[V]
+	data   map[K]*decayMapEntry[V]
+	limits Limits[K, V]
+	bytes  int64
+
+	// protected and protectedBytes count the entries Limits.Evictable
+	// returned false for.
+	protected      int
+	protectedBytes int64
 
 	// deleteCh receives decay-deletion requests from readers.
 	deleteCh chan deleteReq[K]
@@ -22,9 +33,51 @@ type Impl[K comparable, V any] struct {
 	lock   sync.RWMutex
 }
 
+// Limits bound how much a DecayMap holds. When a write would go over a
+// limit, entries are evicted until it fits, starting with expired entries
+// and otherwise the least recently used one out of a few picked at random.
+type Limits[K comparable, V any] struct {
+	// MaxEntries is the most entries the map holds. Zero means no limit.
+	MaxEntries int
+
+	// MaxBytes is the most bytes, as counted by Size, the map holds. Zero
+	// means no limit. A single entry bigger than MaxBytes is still stored,
+	// evicting everything else.
+	MaxBytes int64
+
+	// Size returns how many bytes an entry takes up. It is required when
+	// MaxBytes is set.
+	Size func(key K, value V) int64
+
+	// OnEvict is called for every entry that had not expired yet but was
+	// evicted to stay within the limits. The map is locked while it runs.
+	OnEvict func(key K, value V)
+
+	// Evictable reports whether an entry may be evicted before it expires.
+	// Entries it returns false for are protected: they are only evicted to
+	// stay within MaxProtected and MaxProtectedBytes, and are otherwise kept
+	// until they expire, even if the map goes over its other limits because
+	// of them. Nil means every entry may be evicted.
+	Evictable func(key K, value V) bool
+
+	// MaxProtected is the most protected entries the map holds. Zero means
+	// no limit.
+	MaxProtected int
+
+	// MaxProtectedBytes is the most bytes, as counted by Size, protected
+	// entries take up. Zero means no limit.
+	MaxProtectedBytes int64
+}
+
 type decayMapEntry[V any] struct {
-	Value  V
-	expiry time.Time
+	Value     V
+	expiry    time.Time
+	size      int64
+	protected bool
+
+	// lastUsed is when the entry was last read or written, in Unix
+	// nanoseconds. It is updated by readers holding only the read lock.
+	lastUsed atomic.Int64
 }
 
 // deleteReq is a request to remove a key if its expiry timestamp still matches
@@ -38,8 +91,15 @@ type deleteReq[K comparable] struct {
 //
 // Key types must be comparable to work with maps.
 func New[K comparable, V any]() *Impl[K, V] {
+	return NewWithLimits(Limits[K, V]{})
+}
+
+// NewWithLimits creates a new DecayMap of key type K and value type V that
+// holds no more than limits allow.
+func NewWithLimits[K comparable, V any](limits Limits[K, V]) *Impl[K, V] {
 	m := &Impl[K, V]{
-		data:     make(map[K]decayMapEntry[V]),
+		data:     make(map[K]*decayMapEntry[V]),
+		limits:   limits,
 		deleteCh: make(chan deleteReq[K], 1024),
 		stopCh:   make(chan struct{}),
 	}
@@ -57,8 +117,8 @@ func (m *Impl[K, V]) expire(key K) bool {
 	if !ok {
 		return false
 	}
-	val.expiry = time.Now().Add(-1 * time.Second)
-	m.data[key] = val
+	m.remove(key)
+	m.add(key, m.newEntry(key, val.Value, -1*time.Second))
 	return true
 }
 
@@ -72,7 +132,7 @@ func (m *Impl[K, V]) Delete(key K) bool {
 	defer m.lock.Unlock()
 	_, ok := m.data[key]
 	if ok {
-		delete(m.data, key)
+		m.remove(key)
 	}
 	return ok
 }
@@ -82,17 +142,25 @@ func (m *Impl[K, V]) Delete(key K) bool {
 // If a value has expired, forcibly delete it if it was not updated.
 func (m *Impl[K, V]) Get(key K) (V, bool) {
 	m.lock.RLock()
-	value, ok := m.data[key]
+	entry, ok := m.data[key]
+	var (
+		value  V
+		expiry time.Time
+	)
+	if ok {
+		value, expiry = entry.Value, entry.expiry
+	}
 	m.lock.RUnlock()
 
 	if !ok {
 		return Zilch[V](), false
 	}
 
-	if time.Now().After(value.expiry) {
+	now := time.Now()
+	if now.After(expiry) {
 		// Defer decay deletion to the background worker to avoid convoy.
 		select {
-		case m.deleteCh <- deleteReq[K]{key: key, expiry: value.expiry}:
+		case m.deleteCh <- deleteReq[K]{key: key, expiry: expiry}:
 		default:
 			// Channel full: drop request; a future Cleanup() or Get will retry.
 		}
@@ -100,7 +168,8 @@ func (m *Impl[K, V]) Get(key K) (V, bool) {
 		return Zilch[V](), false
 	}
 
-	return value.Value, true
+	entry.lastUsed.Store(now.UnixNano())
+	return value, true
 }
 
 // Set sets a key value pair in the map.
@@ -108,9 +177,51 @@ func (m *Impl[K, V]) Set(key K, value V, ttl time.Duration) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	m.data[key] = decayMapEntry[V]{
-		Value:  value,
-		expiry: time.Now().Add(ttl),
+	m.put(key, value, ttl)
+}
+
+// Update atomically replaces the value of key with the result of fn.
+//
+// fn is called with the current value and whether it exists and has not
+// expired. If fn returns false, the map is left unchanged. Otherwise the new
+// value is stored with the given ttl. Update reports what fn returned.
+func (m *Impl[K, V]) Update(key K, ttl time.Duration, fn func(value V, ok bool) (V, bool)) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var current V
+	entry, ok := m.data[key]
+	if ok && !time.Now().After(entry.expiry) {
+		current = entry.Value
+	} else {
+		ok = false
+	}
+
+	value, store := fn(current, ok)
+	if !store {
+		return false
+	}
+
+	m.put(key, value, ttl)
+	return true
+}
+
+// Range calls fn with every entry that has not expired and the time it
+// expires, until fn returns false. The map is locked while Range runs, so fn
+// must not call other methods of the map.
+func (m *Impl[K, V]) Range(fn func(key K, value V, expiry time.Time) bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	now := time.Now()
+	for key, entry := range m.data {
+		if now.After(entry.expiry) {
+			continue
+		}
+
+		if !fn(key, entry.Value, entry.expiry) {
+			return
+		}
 	}
 }
 
@@ -122,7 +233,7 @@ func (m *Impl[K, V]) Cleanup() {
 	now := time.Now()
 	for key, entry := range m.data {
 		if now.After(entry.expiry) {
-			delete(m.data, key)
+			m.remove(key)
 		}
 	}
 }
@@ -134,6 +245,14 @@ func (m *Impl[K, V]) Len() int {
 	return len(m.data)
 }
 
+// Bytes returns the size of all entries in the DecayMap as counted by
+// Limits.Size, or zero if the map has no Size function.
+func (m *Impl[K, V]) Bytes() int64 {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.bytes
+}
+
 // Close stops the background cleanup worker. It's optional to call; maps live
 // for the process lifetime in many cases. Call in tests or when you know you no
 // longer need the map to avoid goroutine leaks.
@@ -142,6 +261,131 @@ func (m *Impl[K, V]) Close() {
 	m.wg.Wait()
 }
 
+// newEntry makes an entry for key that expires after ttl.
+func (m *Impl[K, V]) newEntry(key K, value V, ttl time.Duration) *decayMapEntry[V] {
+	now := time.Now()
+	entry := &decayMapEntry[V]{
+		Value:  value,
+		expiry: now.Add(ttl),
+	}
+	if m.limits.Size != nil {
+		entry.size = m.limits.Size(key, value)
+	}
+	if m.limits.Evictable != nil {
+		entry.protected = !m.limits.Evictable(key, value)
+	}
+	entry.lastUsed.Store(now.UnixNano())
+	return entry
+}
+
+// put stores value at key and evicts entries until the map is within its
+// limits again. m.lock must be held.
+func (m *Impl[K, V]) put(key K, value V, ttl time.Duration) {
+	entry := m.newEntry(key, value, ttl)
+
+	m.remove(key)
+	m.add(key, entry)
+
+	for m.overProtectedLimits() {
+		if !m.evictOne(key, true) {
+			break
+		}
+	}
+
+	for m.overLimits() {
+		if !m.evictOne(key, false) {
+			return
+		}
+	}
+}
+
+// overLimits reports whether the map holds more than its limits allow.
+// m.lock must be held.
+func (m *Impl[K, V]) overLimits() bool {
+	return (m.limits.MaxEntries > 0 && len(m.data) > m.limits.MaxEntries) ||
+		(m.limits.MaxBytes > 0 && m.bytes > m.limits.MaxBytes)
+}
+
+// overProtectedLimits reports whether the map holds more protected entries
+// than its limits allow. m.lock must be held.
+func (m *Impl[K, V]) overProtectedLimits() bool {
+	return (m.limits.MaxProtected > 0 && m.protected > m.limits.MaxProtected) ||
+		(m.limits.MaxProtectedBytes > 0 && m.protectedBytes > m.limits.MaxProtectedBytes)
+}
+
+// evictOne removes an expired entry, or the least recently used of a few
+// entries picked at random, other than keep. Only protected entries are
+// picked if protected is set, and only unprotected ones otherwise. It
+// reports whether there was anything to remove. m.lock must be held.
+func (m *Impl[K, V]) evictOne(keep K, protected bool) bool {
+	var (
+		victim  K
+		oldest  int64
+		found   bool
+		sampled int
+		now     = time.Now()
+	)
+
+	// Map iteration starts at a random place, which makes this a random
+	// sample. Keep going past entries of the other kind, as giving up
+	// early would stop eviction once they fill most of the map.
+	for key, entry := range m.data {
+		if key == keep {
+			continue
+		}
+
+		if now.After(entry.expiry) {
+			m.remove(key)
+			return true
+		}
+
+		if entry.protected != protected {
+			continue
+		}
+
+		if lastUsed := entry.lastUsed.Load(); !found || lastUsed < oldest {
+			victim, oldest, found = key, lastUsed, true
+		}
+
+		if sampled++; sampled == evictionSamples {
+			break
+		}
+	}
+
+	if !found {
+		return false
+	}
+
+	if m.limits.OnEvict != nil {
+		m.limits.OnEvict(victim, m.data[victim].Value)
+	}
+	m.remove(victim)
+	return true
+}
+
+// add stores entry at key and accounts for its size. key must not be in
+// the map. m.lock must be held.
+func (m *Impl[K, V]) add(key K, entry *decayMapEntry[V]) {
+	m.data[key] = entry
+	m.bytes += entry.size
+	if entry.protected {
+		m.protected++
+		m.protectedBytes += entry.size
+	}
+}
+
+// remove deletes key and accounts for its size. m.lock must be held.
+func (m *Impl[K, V]) remove(key K) {
+	if entry, ok := m.data[key]; ok {
+		m.bytes -= entry.size
+		if entry.protected {
+			m.protected--
+			m.protectedBytes -= entry.size
+		}
+		delete(m.data, key)
+	}
+}
+
 // cleanupWorker batches decay deletions to minimize lock contention.
 func (m *Impl[K, V]) cleanupWorker() {
 	defer m.wg.Done()
@@ -189,7 +433,7 @@ func (m *Impl[K, V]) applyDeletes(batch []deleteReq[K]) {
 		}
 		// Only delete if the expiry is unchanged and already past.
 		if entry.expiry.Equal(req.expiry) && now.After(entry.expiry) {
-			delete(m.data, req.key)
+			m.remove(req.key)
 		}
 	}
 	m.lock.Unlock()
@@ -1,6 +1,8 @@
 package decaymap
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 )
@@ -73,3 +75,198 @@ func TestCleanup(t *testing.T) {
 		t.Error("test3 should still be found after cleanup")
 	}
 }
+
+func TestUpdate(t *testing.T) {
+	dm := New[string, int]()
+	t.Cleanup(dm.Close)
+
+	inc := func(value int, _ bool) (int, bool) { return value + 1, true }
+
+	dm.Update("counter", time.Minute, inc)
+	dm.Update("counter", time.Minute, inc)
+
+	if val, _ := dm.Get("counter"); val != 2 {
+		t.Errorf("wanted counter to be 2, got: %d", val)
+	}
+
+	dm.expire("counter")
+	dm.Update("counter", time.Minute, func(value int, ok bool) (int, bool) {
+		if ok {
+			t.Error("expired value was passed to update as if it existed")
+		}
+		return value + 1, true
+	})
+
+	if val, _ := dm.Get("counter"); val != 1 {
+		t.Errorf("wanted counter to restart at 1 after expiring, got: %d", val)
+	}
+
+	if dm.Update("counter", time.Minute, func(int, bool) (int, bool) { return 100, false }) {
+		t.Error("update reported storing a value it was told not to store")
+	}
+
+	if val, _ := dm.Get("counter"); val != 1 {
+		t.Errorf("declined update changed the value to %d", val)
+	}
+}
+
+func TestRange(t *testing.T) {
+	dm := New[string, string]()
+	t.Cleanup(dm.Close)
+
+	dm.Set("live", "hi", time.Minute)
+	dm.Set("dead", "bye", time.Minute)
+	dm.expire("dead")
+
+	seen := map[string]string{}
+	dm.Range(func(key, value string, expiry time.Time) bool {
+		if time.Until(expiry) <= 0 {
+			t.Errorf("%s was passed to range with an expiry in the past", key)
+		}
+		seen[key] = value
+		return true
+	})
+
+	if len(seen) != 1 || seen["live"] != "hi" {
+		t.Errorf("wanted only the live entry, got: %v", seen)
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	var evicted []string
+	dm := NewWithLimits(Limits[string, string]{
+		MaxEntries: 3,
+		OnEvict:    func(key, _ string) { evicted = append(evicted, key) },
+	})
+	t.Cleanup(dm.Close)
+
+	for _, key := range []string{"a", "b", "c"} {
+		dm.Set(key, key, time.Minute)
+		time.Sleep(time.Millisecond)
+	}
+
+	// Use a so that b is the least recently used entry.
+	dm.Get("a")
+	dm.Set("d", "d", time.Minute)
+
+	if n := dm.Len(); n != 3 {
+		t.Errorf("wanted 3 entries, got: %d", n)
+	}
+	if _, ok := dm.Get("b"); ok {
+		t.Error("the least recently used entry was not evicted")
+	}
+	if len(evicted) != 1 || evicted[0] != "b" {
+		t.Errorf("wanted OnEvict to be called for b, got: %v", evicted)
+	}
+
+	// Expired entries make room before anything that is still live.
+	dm.expire("c")
+	dm.Set("e", "e", time.Minute)
+
+	if len(evicted) != 1 {
+		t.Errorf("expired entry should have been dropped instead, but evicted: %v", evicted)
+	}
+	for _, key := range []string{"a", "d", "e"} {
+		if _, ok := dm.Get(key); !ok {
+			t.Errorf("%s should still be in the map", key)
+		}
+	}
+
+	// Replacing a value does not evict anything.
+	dm.Set("a", "A", time.Minute)
+	if len(evicted) != 1 || dm.Len() != 3 {
+		t.Errorf("replacing a value evicted %v", evicted[1:])
+	}
+}
+
+func TestEvictable(t *testing.T) {
+	dm := NewWithLimits(Limits[string, string]{
+		MaxEntries: 3,
+		Evictable:  func(key, _ string) bool { return key != "pinned" },
+	})
+	t.Cleanup(dm.Close)
+
+	dm.Set("pinned", "pinned", time.Minute)
+	for i := range 100 {
+		dm.Set(fmt.Sprint(i), "flood", time.Minute)
+	}
+
+	if _, ok := dm.Get("pinned"); !ok {
+		t.Error("an entry that isn't evictable was evicted")
+	}
+	if n := dm.Len(); n != 3 {
+		t.Errorf("wanted 3 entries, got: %d", n)
+	}
+
+	// Entries that can't be evicted may take the map over its limits, but
+	// they still expire.
+	dm.Set("pinned", "pinned", time.Minute)
+	dm.expire("pinned")
+	dm.Set("flood", "flood", time.Minute)
+	if _, ok := dm.Get("pinned"); ok {
+		t.Error("expired entries should be dropped even if they aren't evictable")
+	}
+}
+
+func TestMaxProtected(t *testing.T) {
+	dm := NewWithLimits(Limits[string, string]{
+		MaxEntries:   10,
+		MaxProtected: 5,
+		Evictable:    func(key, _ string) bool { return !strings.HasPrefix(key, "pinned") },
+	})
+	t.Cleanup(dm.Close)
+
+	// A flood of protected entries is capped, and does not stop unprotected
+	// entries from being evicted.
+	for i := range 1000 {
+		dm.Set(fmt.Sprint("pinned", i), "flood", time.Minute)
+		dm.Set(fmt.Sprint(i), "flood", time.Minute)
+	}
+
+	if n := dm.Len(); n != 10 {
+		t.Errorf("wanted 10 entries, got: %d", n)
+	}
+	if dm.protected != 5 {
+		t.Errorf("wanted 5 protected entries, got: %d", dm.protected)
+	}
+	if _, ok := dm.Get("pinned999"); !ok {
+		t.Error("the newest protected entry was evicted")
+	}
+	if _, ok := dm.Get("999"); !ok {
+		t.Error("the newest entry was evicted")
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	dm := NewWithLimits(Limits[string, string]{
+		MaxBytes: 10,
+		Size:     func(key, value string) int64 { return int64(len(key) + len(value)) },
+	})
+	t.Cleanup(dm.Close)
+
+	dm.Set("a", "1234", time.Minute)
+	dm.Set("b", "1234", time.Minute)
+	if got := dm.Bytes(); got != 10 {
+		t.Errorf("wanted 10 bytes, got: %d", got)
+	}
+
+	dm.Update("c", time.Minute, func(string, bool) (string, bool) { return "1", true })
+	if got := dm.Bytes(); got > 10 {
+		t.Errorf("map holds %d bytes, over its limit of 10", got)
+	}
+	if _, ok := dm.Get("c"); !ok {
+		t.Error("the new entry was evicted instead of an old one")
+	}
+
+	dm.Delete("c")
+	dm.Cleanup()
+	if got, want := dm.Bytes(), int64(dm.Len()*5); got != want {
+		t.Errorf("wanted %d bytes after deleting, got: %d", want, got)
+	}
+
+	// A value bigger than the limit is kept, but nothing else is.
+	dm.Set("big", "0123456789", time.Minute)
+	if n := dm.Len(); n != 1 {
+		t.Errorf("wanted only the big value to be left, got %d entries", n)
+	}
+}
@@ -6,8 +6,14 @@ import (
 	"strconv"
 
 	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/scrypt"
 )
 
+// ScryptBlockSize is the scrypt r parameter used for proof-of-work challenges.
+// With r = 8 every unit of N costs 1 KiB of memory, so N is the memory cost in
+// KiB.
+const ScryptBlockSize = 8
+
 // SHA256sum computes a cryptographic hash. Still used for proof-of-work challenges
 // where we need the security properties of a cryptographic hash function.
 func SHA256sum(text string) string {
@@ -22,3 +28,11 @@ func FastHash(text string) string {
 	h := xxhash.Sum64String(text)
 	return strconv.FormatUint(h, 16)
 }
+
+// ScryptSum computes the memory-hard hash used by the scrypt proof-of-work
+// challenge. The challenge is used as the salt and the challenge followed by
+// the nonce is used as the password. memoryKiB must be a power of two and
+// iterations is the scrypt p parameter.
+func ScryptSum(challenge, nonce string, memoryKiB, iterations int) ([]byte, error) {
+	return scrypt.Key([]byte(challenge+nonce), []byte(challenge), memoryKiB, ScryptBlockSize, iterations, 32)
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -159,6 +160,31 @@ func BenchmarkXXHash_PolicyList(b *testing.B) {
 	}
 }
 
+// Benchmark a single proof-of-work attempt for the fast and scrypt algorithms,
+// which is what a client pays per nonce it tries.
+func BenchmarkPoW_Fast(b *testing.B) {
+	challenge := challengeInputs[0]
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = SHA256sum(challenge + strconv.Itoa(i))
+	}
+}
+
+func BenchmarkPoW_Scrypt(b *testing.B) {
+	challenge := challengeInputs[0]
+
+	for _, memory := range []int{1024, 4096, 16384} {
+		b.Run(fmt.Sprintf("memory=%dKiB", memory), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := ScryptSum(challenge, strconv.Itoa(i), memory, 1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 // Tests that xxhash doesn't have collisions in realistic scenarios
 func TestHashCollisions(t *testing.T) {
 	allInputs := append(append(append(append(policyInputs, challengeInputs...), botRuleInputs...), celInputs...), asnInputs...)
@@ -151,11 +151,13 @@ type Impl struct {
 }
 
 func (i *Impl) incrementNetwork(ctx context.Context, network string) int {
-	key := internal.SHA256sum(network)
-	result, _ := i.networkWeight.Get(ctx, key)
-	result++
-	_ = i.networkWeight.Set(ctx, key, result, time.Hour)
-	return result
+	// networkWeight reads these counters back as JSON integers.
+	key := i.networkWeight.Prefix + internal.SHA256sum(network)
+	result, err := store.Increment(ctx, i.st, key, 1, time.Hour)
+	if err != nil {
+		i.lg.DebugContext(ctx, "can't increment network counter", "err", err)
+	}
+	return int(result)
 }
 
 func (i *Impl) CheckNetwork() checker.Impl {
@@ -310,11 +310,6 @@ func TestPlaywrightWithBasePrefix(t *testing.T) {
 	basePrefix := "/myapp"
 	anubisURL := spawnAnubisWithOptions(t, basePrefix)
 
-	// Reset BasePrefix after test
-	t.Cleanup(func() {
-		anubis.BasePrefix = ""
-	})
-
 	browsers := []playwright.BrowserType{pw.Chromium}
 
 	for _, typ := range browsers {
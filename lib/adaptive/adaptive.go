@@ -0,0 +1,209 @@
+// Package adaptive raises challenge difficulty while Anubis is under pressure
+// and lowers it again once the pressure is gone.
+package adaptive
+
+import (
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/policy/expressions"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// minRatioSamples is how many challenges have to be issued in an interval
+// before the issued to validated ratio is considered. A handful of abandoned
+// challenges on a quiet site should not raise the difficulty.
+const minRatioSamples = 10
+
+var currentDifficulty = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "anubis_adaptive_difficulty",
+	Help: "The minimum difficulty currently enforced by each adaptive difficulty controller",
+}, []string{"controller"})
+
+// controllerIDs numbers controllers in the order they are created, so that
+// several servers in one process export their own difficulty.
+var controllerIDs atomic.Int64
+
+// adaptiveMethods are the challenge methods the controller raises the
+// difficulty of. Each step of the other methods costs far more than a step
+// of SHA-256 (scrypt) or doesn't mean more work at all (metarefresh,
+// preact), so they keep the difficulty of their rule.
+var adaptiveMethods = map[string]bool{
+	"fast": true,
+	"slow": true,
+}
+
+// Controller tracks request rate, system load and how many issued challenges
+// get solved. Every interval it raises the difficulty by one step if any of
+// them are over their configured threshold, or lowers it by one step if there
+// has been no pressure for the cooldown period.
+//
+// A nil *Controller is valid and never changes the difficulty.
+type Controller struct {
+	cfg      config.AdaptiveDifficulty
+	interval time.Duration
+	cooldown time.Duration
+	lg       *slog.Logger
+	gauge    prometheus.Gauge
+	id       string
+
+	// Overridden in tests.
+	now  func() time.Time
+	load func() float64
+
+	requests  atomic.Int64
+	issued    atomic.Int64
+	validated atomic.Int64
+	current   atomic.Int64
+	nextTick  atomic.Int64 // unix nanoseconds
+
+	mu         sync.Mutex
+	lastTick   time.Time
+	lastChange time.Time
+}
+
+// New creates a Controller that starts at cfg.Min.
+func New(cfg config.AdaptiveDifficulty, lg *slog.Logger) *Controller {
+	id := strconv.FormatInt(controllerIDs.Add(1)-1, 10)
+	result := &Controller{
+		cfg:      cfg,
+		interval: cfg.IntervalDuration(),
+		cooldown: cfg.CooldownDuration(),
+		lg:       lg.With("controller", id),
+		gauge:    currentDifficulty.WithLabelValues(id),
+		id:       id,
+		now:      time.Now,
+		load:     expressions.Load1,
+	}
+
+	now := result.now()
+	result.lastTick = now
+	result.lastChange = now
+	result.nextTick.Store(now.Add(result.interval).UnixNano())
+	result.current.Store(int64(cfg.Min))
+	result.gauge.Set(float64(cfg.Min))
+
+	return result
+}
+
+// Close stops exporting the difficulty of the controller.
+func (c *Controller) Close() {
+	if c == nil {
+		return
+	}
+
+	currentDifficulty.DeleteLabelValues(c.id)
+}
+
+// ObserveRequest records a request that was checked against the policy.
+func (c *Controller) ObserveRequest() {
+	if c == nil {
+		return
+	}
+
+	c.requests.Add(1)
+	c.maybeTick()
+}
+
+// ObserveIssued records a challenge being issued.
+func (c *Controller) ObserveIssued() {
+	if c == nil {
+		return
+	}
+
+	c.issued.Add(1)
+}
+
+// ObserveValidated records a challenge being solved.
+func (c *Controller) ObserveValidated() {
+	if c == nil {
+		return
+	}
+
+	c.validated.Add(1)
+}
+
+// Current returns the difficulty the controller currently enforces.
+func (c *Controller) Current() int {
+	if c == nil {
+		return 0
+	}
+
+	c.maybeTick()
+	return int(c.current.Load())
+}
+
+// Difficulty returns the difficulty to issue for a rule that asks for base
+// with the given challenge method. Rules that already ask for more than the
+// controller enforces keep their own difficulty, as do methods other than
+// the SHA-256 proof of work.
+func (c *Controller) Difficulty(method string, base int) int {
+	if !adaptiveMethods[method] {
+		return base
+	}
+
+	return max(base, c.Current())
+}
+
+func (c *Controller) maybeTick() {
+	if c.now().UnixNano() < c.nextTick.Load() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	elapsed := now.Sub(c.lastTick)
+	if elapsed < c.interval {
+		// Someone else already did this tick.
+		return
+	}
+
+	c.lastTick = now
+	c.nextTick.Store(now.Add(c.interval).UnixNano())
+
+	requests := c.requests.Swap(0)
+	issued := c.issued.Swap(0)
+	validated := c.validated.Swap(0)
+
+	rate := float64(requests) / elapsed.Seconds()
+	load := c.load()
+	ratio := float64(issued) / float64(max(validated, 1))
+
+	var reasons []string
+	if c.cfg.RequestRate != 0 && rate > c.cfg.RequestRate {
+		reasons = append(reasons, "request_rate")
+	}
+	if c.cfg.Load != 0 && load > c.cfg.Load {
+		reasons = append(reasons, "load")
+	}
+	if c.cfg.IssuedValidatedRatio != 0 && issued >= minRatioSamples && ratio > c.cfg.IssuedValidatedRatio {
+		reasons = append(reasons, "issued_validated_ratio")
+	}
+
+	current := int(c.current.Load())
+	next := current
+
+	switch {
+	case len(reasons) != 0:
+		c.lastChange = now
+		next = min(current+1, c.cfg.Max)
+	case current > c.cfg.Min && now.Sub(c.lastChange) >= c.cooldown:
+		c.lastChange = now
+		next = current - 1
+	}
+
+	if next == current {
+		return
+	}
+
+	c.current.Store(int64(next))
+	c.gauge.Set(float64(next))
+	c.lg.Info("adaptive difficulty changed", "from", current, "to", next, "reasons", reasons, "request_rate", rate, "load", load, "issued", issued, "validated", validated)
+}
@@ -0,0 +1,201 @@
+package adaptive
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (fc *fakeClock) now() time.Time { return fc.t }
+
+func (fc *fakeClock) advance(d time.Duration) { fc.t = fc.t.Add(d) }
+
+func newTestController(t *testing.T, cfg config.AdaptiveDifficulty, load *float64) (*Controller, *fakeClock) {
+	t.Helper()
+
+	c := New(cfg, slog.Default())
+	fc := &fakeClock{t: c.lastTick}
+	c.now = fc.now
+	c.load = func() float64 { return *load }
+
+	return c, fc
+}
+
+func TestNilController(t *testing.T) {
+	var c *Controller
+
+	c.ObserveRequest()
+	c.ObserveIssued()
+	c.ObserveValidated()
+
+	if got := c.Difficulty("fast", 4); got != 4 {
+		t.Errorf("a nil controller must not change the difficulty, got: %d", got)
+	}
+}
+
+func TestRequestRate(t *testing.T) {
+	var load float64
+	c, fc := newTestController(t, config.AdaptiveDifficulty{
+		Min:         2,
+		Max:         4,
+		Interval:    "10s",
+		Cooldown:    "1m",
+		RequestRate: 10,
+	}, &load)
+
+	if got := c.Difficulty("fast", 0); got != 2 {
+		t.Fatalf("controller should start at min, got: %d", got)
+	}
+
+	// 200 requests in 10 seconds is 20 requests per second.
+	storm := func() {
+		for range 200 {
+			c.ObserveRequest()
+		}
+		fc.advance(10 * time.Second)
+	}
+
+	for want := 3; want <= 5; want++ {
+		storm()
+		if got, wantCapped := c.Current(), min(want, 4); got != wantCapped {
+			t.Errorf("wanted difficulty %d, got: %d", wantCapped, got)
+		}
+	}
+
+	if got := c.Difficulty("fast", 6); got != 6 {
+		t.Errorf("rules that ask for more than the controller must keep their difficulty, got: %d", got)
+	}
+
+	// Quiet, but still inside the cooldown.
+	fc.advance(30 * time.Second)
+	if got := c.Current(); got != 4 {
+		t.Errorf("difficulty should not drop inside the cooldown, got: %d", got)
+	}
+
+	fc.advance(40 * time.Second)
+	if got := c.Current(); got != 3 {
+		t.Errorf("difficulty should drop one step after the cooldown, got: %d", got)
+	}
+
+	fc.advance(time.Minute)
+	c.Current()
+	fc.advance(time.Minute)
+	c.Current()
+	fc.advance(time.Minute)
+	if got := c.Current(); got != 2 {
+		t.Errorf("difficulty should decay back to min, got: %d", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	load := 8.0
+	c, fc := newTestController(t, config.AdaptiveDifficulty{
+		Min:  1,
+		Max:  3,
+		Load: 4,
+	}, &load)
+
+	fc.advance(15 * time.Second)
+	if got := c.Current(); got != 2 {
+		t.Errorf("high load should raise the difficulty, got: %d", got)
+	}
+
+	load = 1
+	fc.advance(15 * time.Second)
+	if got := c.Current(); got != 2 {
+		t.Errorf("difficulty should hold inside the cooldown, got: %d", got)
+	}
+}
+
+func TestIssuedValidatedRatio(t *testing.T) {
+	var load float64
+	c, fc := newTestController(t, config.AdaptiveDifficulty{
+		Min:                  1,
+		Max:                  5,
+		Interval:             "10s",
+		IssuedValidatedRatio: 3,
+	}, &load)
+
+	// Too few challenges to say anything.
+	for range minRatioSamples - 1 {
+		c.ObserveIssued()
+	}
+	fc.advance(10 * time.Second)
+	if got := c.Current(); got != 1 {
+		t.Errorf("a handful of unsolved challenges should not raise the difficulty, got: %d", got)
+	}
+
+	// Most challenges get solved.
+	for range 20 {
+		c.ObserveIssued()
+	}
+	for range 15 {
+		c.ObserveValidated()
+	}
+	fc.advance(10 * time.Second)
+	if got := c.Current(); got != 1 {
+		t.Errorf("a healthy ratio should not raise the difficulty, got: %d", got)
+	}
+
+	// Almost nothing gets solved.
+	for range 40 {
+		c.ObserveIssued()
+	}
+	c.ObserveValidated()
+	fc.advance(10 * time.Second)
+	if got := c.Current(); got != 2 {
+		t.Errorf("a bad ratio should raise the difficulty, got: %d", got)
+	}
+}
+
+func TestDifficultyMethods(t *testing.T) {
+	var load float64
+	c, _ := newTestController(t, config.AdaptiveDifficulty{
+		Min:         6,
+		Max:         8,
+		Interval:    "10s",
+		Cooldown:    "1m",
+		RequestRate: 10,
+	}, &load)
+
+	for _, tt := range []struct {
+		method string
+		want   int
+	}{
+		{method: "fast", want: 6},
+		{method: "slow", want: 6},
+		{method: "scrypt", want: 2},
+		{method: "metarefresh", want: 2},
+		{method: "preact", want: 2},
+	} {
+		if got := c.Difficulty(tt.method, 2); got != tt.want {
+			t.Errorf("%s: wanted difficulty %d, got: %d", tt.method, tt.want, got)
+		}
+	}
+}
+
+func TestGaugePerController(t *testing.T) {
+	var load float64
+	a, _ := newTestController(t, config.AdaptiveDifficulty{Min: 2, Max: 4, RequestRate: 10}, &load)
+	b, _ := newTestController(t, config.AdaptiveDifficulty{Min: 3, Max: 4, RequestRate: 10}, &load)
+
+	if got := testutil.ToFloat64(currentDifficulty.WithLabelValues(a.id)); got != 2 {
+		t.Errorf("wanted the first controller to export 2, got: %v", got)
+	}
+	if got := testutil.ToFloat64(currentDifficulty.WithLabelValues(b.id)); got != 3 {
+		t.Errorf("wanted the second controller to export 3, got: %v", got)
+	}
+
+	series := testutil.CollectAndCount(currentDifficulty)
+	a.Close()
+	if n := series - testutil.CollectAndCount(currentDifficulty); n != 1 {
+		t.Errorf("closing a controller removed %d series, wanted 1", n)
+	}
+}
@@ -2,7 +2,6 @@ package lib
 
 import (
 	"context"
-	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
@@ -28,12 +27,17 @@ import (
 	"github.com/TecharoHQ/anubis/internal"
 	"github.com/TecharoHQ/anubis/internal/dnsbl"
 	"github.com/TecharoHQ/anubis/internal/ogtags"
+	"github.com/TecharoHQ/anubis/lib/adaptive"
 	"github.com/TecharoHQ/anubis/lib/challenge"
+	"github.com/TecharoHQ/anubis/lib/challenge/remote"
 	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/keyring"
 	"github.com/TecharoHQ/anubis/lib/localization"
 	"github.com/TecharoHQ/anubis/lib/policy"
 	"github.com/TecharoHQ/anubis/lib/policy/checker"
+	"github.com/TecharoHQ/anubis/lib/revocation"
 	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/degraded"
 	iptoasnv1 "github.com/TecharoHQ/thoth-proto/gen/techaro/thoth/iptoasn/v1"
 
 	// challenge implementations
@@ -49,6 +53,7 @@ const asnContextKey contextKey = iota
 type asnInfo struct {
 	ASN         string
 	Description string
+	Country     string
 }
 
 func asnFromContext(ctx context.Context) (string, string) {
@@ -58,6 +63,13 @@ func asnFromContext(ctx context.Context) (string, string) {
 	return "", ""
 }
 
+func countryFromContext(ctx context.Context) string {
+	if v, ok := ctx.Value(asnContextKey).(asnInfo); ok {
+		return v.Country
+	}
+	return ""
+}
+
 var (
 	challengesIssued = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "anubis_challenges_issued",
@@ -88,35 +100,63 @@ var (
 		Name: "anubis_requests_by_asn_total",
 		Help: "Number of requests by ASN",
 	}, []string{"asn", "asn_description"})
+
+	tokenRenewals = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_token_renewals_total",
+		Help: "Requests with tokens old enough to be renewed, by whether the token was renewed or had reached the maximum session lifetime",
+	}, []string{"result"})
+
+	degradedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_degraded_requests_total",
+		Help: "Requests that would have been challenged but were let through or denied because the storage backend is unavailable, by degraded mode",
+	}, []string{"mode"})
 )
 
 type Server struct {
-	next        http.Handler
-	store       store.Interface
-	mux         *http.ServeMux
-	policy      *policy.ParsedConfig
-	OGTags      *ogtags.OGTagCache
-	logger      *slog.Logger
-	opts        Options
-	ed25519Priv ed25519.PrivateKey
-	hs512Secret []byte
+	next     http.Handler
+	store    store.Interface
+	mux      *http.ServeMux
+	policy   *policy.ParsedConfig
+	OGTags   *ogtags.OGTagCache
+	logger   *slog.Logger
+	opts     Options
+	keyring  *keyring.Keyring
+	settings *anubis.Settings
+	hooks    *hookDispatcher
+	adaptive *adaptive.Controller
+
+	revocations      *revocation.List
+	revocationErrors revocationErrorLog
+	challengePlugins map[string]*remote.Impl
+}
+
+// Close releases what the server holds on to, such as the goroutine that
+// delivers events to hooks and the connections to its challenge plugins. The
+// server must not be used afterwards.
+func (s *Server) Close() error {
+	s.hooks.close()
+	s.adaptive.Close()
+	return closeChallengePlugins(s.challengePlugins)
 }
 
 func (s *Server) getRequestLogger(r *http.Request) (*slog.Logger, *http.Request) {
 	lg := internal.GetRequestLogger(s.logger, r)
 
-	if s.policy.LogASN && s.policy.ThothClient != nil {
+	if (s.policy.LogASN || s.policy.NeedASN) && s.policy.ThothClient != nil {
 		ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
 		defer cancel()
 
 		ip := r.Header.Get("X-Real-Ip")
 		if info, err := s.policy.ThothClient.IPToASN.Lookup(ctx, &iptoasnv1.LookupRequest{IpAddress: ip}); err == nil && info.GetAnnounced() {
 			asn := strconv.FormatUint(uint64(info.GetAsNumber()), 10)
-			lg = lg.With("asn", info.GetAsNumber(), "asn_description", info.GetDescription())
+			if s.policy.LogASN {
+				lg = lg.With("asn", info.GetAsNumber(), "asn_description", info.GetDescription())
+			}
 			requestsByASN.WithLabelValues(asn, info.GetDescription()).Inc()
 			r = r.WithContext(context.WithValue(r.Context(), asnContextKey, asnInfo{
 				ASN:         asn,
 				Description: info.GetDescription(),
+				Country:     info.GetCountryCode(),
 			}))
 		}
 	}
@@ -124,21 +164,12 @@ func (s *Server) getRequestLogger(r *http.Request) (*slog.Logger, *http.Request)
 	return lg, r
 }
 
-func (s *Server) getTokenKeyfunc() jwt.Keyfunc {
-	// return ED25519 key if HS512 is not set
-	if len(s.hs512Secret) == 0 {
-		return func(token *jwt.Token) (any, error) {
-			return s.ed25519Priv.Public().(ed25519.PublicKey), nil
-		}
-	} else {
-		return func(token *jwt.Token) (any, error) {
-			return s.hs512Secret, nil
-		}
-	}
-}
-
 func (s *Server) getChallenge(r *http.Request) (*challenge.Challenge, error) {
 	id := r.FormValue("id")
+	if strings.Contains(id, ".") {
+		return s.openChallenge(id)
+	}
+
 	j := store.JSON[challenge.Challenge]{Underlying: s.store}
 
 	chall, err := j.Get(r.Context(), "challenge:"+id)
@@ -159,38 +190,89 @@ func (s *Server) issueChallenge(ctx context.Context, r *http.Request, lg *slog.L
 		}
 	}
 
+	stateless := s.statelessChallenges()
+	limit := s.policy.Challenges.MaxOutstanding
+	if stateless {
+		// Stateless challenges aren't stored, so they can't be handed out
+		// again.
+		limit = 0
+	}
+
 	id, err := uuid.NewV7()
 	if err != nil {
 		return nil, err
 	}
 	idStr := id.String()
 
+	var slot string
+	if limit > 0 {
+		outstandingKey := s.outstandingKey(r)
+		taken, claimed, err := s.claimOutstanding(ctx, outstandingKey, idStr)
+		if err != nil {
+			return nil, err
+		}
+		outstandingChallengesPerClient.Observe(float64(taken))
+
+		if claimed {
+			slot = outstandingSlot(outstandingKey, taken)
+		} else {
+			if chall := s.reissuableChallenge(ctx, r, s.loadOutstanding(ctx, outstandingKey), rule); chall != nil {
+				challengeStoreOperations.WithLabelValues("reissued").Inc()
+				lg.DebugContext(ctx, "client is at its outstanding challenge limit, reissuing challenge", "challenge", chall.ID, "outstanding", taken)
+				return chall, nil
+			}
+
+			challengeStoreOperations.WithLabelValues("limited").Inc()
+			return nil, ErrTooManyChallenges
+		}
+	}
+
 	var randomData = make([]byte, 64)
 	if _, err := rand.Read(randomData); err != nil {
 		return nil, err
 	}
 
 	chall := challenge.Challenge{
-		ID:             idStr,
-		Method:         rule.Challenge.Algorithm,
-		RandomData:     hex.EncodeToString(randomData),
-		IssuedAt:       time.Now(),
-		Difficulty:     rule.Challenge.Difficulty,
-		PolicyRuleHash: rule.Hash(),
+		ID:              idStr,
+		Method:          rule.Challenge.Algorithm,
+		RandomData:      hex.EncodeToString(randomData),
+		IssuedAt:        time.Now(),
+		Difficulty:      s.adaptive.Difficulty(rule.Challenge.Algorithm, rule.Challenge.Difficulty),
+		PolicyRuleHash:  rule.Hash(),
+		OutstandingSlot: slot,
 		Metadata: map[string]string{
 			"User-Agent": r.Header.Get("User-Agent"),
 			"X-Real-Ip":  r.Header.Get("X-Real-Ip"),
 		},
 	}
 
-	j := store.JSON[challenge.Challenge]{Underlying: s.store}
-	if err := j.Set(ctx, "challenge:"+idStr, chall, 30*time.Minute); err != nil {
-		return nil, err
+	if ja4h := r.Header.Get(internal.JA4HHeaderName); ja4h != "" {
+		chall.Metadata[internal.JA4HHeaderName] = ja4h
 	}
 
-	lg.InfoContext(ctx, "new challenge issued", "challenge", idStr, "weight", cr.Weight)
+	ttl := s.policy.Challenges.TTLDuration()
 
-	return &chall, err
+	result := chall
+	if stateless {
+		if result.ID, err = s.sealChallenge(&chall); err != nil {
+			return nil, err
+		}
+		result.Stateless = true
+		challengeStoreOperations.WithLabelValues("sealed").Inc()
+	} else {
+		j := store.JSON[challenge.Challenge]{Underlying: s.store}
+		if err := j.Set(ctx, "challenge:"+idStr, chall, ttl); err != nil {
+			s.forgetOutstanding(ctx, lg, &chall)
+			return nil, err
+		}
+		challengeStoreOperations.WithLabelValues("stored").Inc()
+	}
+
+	lg.InfoContext(ctx, "new challenge issued", "challenge", idStr, "weight", cr.Weight, "difficulty", chall.Difficulty, "stateless", stateless)
+	s.adaptive.ObserveIssued()
+	s.hooks.challengeIssued(r, cr, rule, &chall)
+
+	return &result, nil
 }
 
 func (s *Server) hydrateChallengeRule(rule *policy.Bot, chall *challenge.Challenge, lg *slog.Logger) *policy.Bot {
@@ -228,9 +310,31 @@ func (s *Server) hydrateChallengeRule(rule *policy.Bot, chall *challenge.Challen
 		rule.Challenge.Algorithm = chall.Method
 	}
 
+	// Clients have to solve the challenge they were actually issued, which is
+	// harder than the rule asks for when adaptive difficulty raised it.
+	if chall.Difficulty > rule.Challenge.Difficulty {
+		rule = ruleForChallenge(rule, chall)
+	}
+
 	return rule
 }
 
+// ruleForChallenge returns rule with the difficulty that was issued in chall.
+// The rule is copied so that the parsed policy is never modified.
+func ruleForChallenge(rule *policy.Bot, chall *challenge.Challenge) *policy.Bot {
+	if rule.Challenge == nil || rule.Challenge.Difficulty == chall.Difficulty {
+		return rule
+	}
+
+	rules := *rule.Challenge
+	rules.Difficulty = chall.Difficulty
+
+	result := *rule
+	result.Challenge = &rules
+
+	return &result
+}
+
 func (s *Server) maybeReverseProxyHttpStatusOnly(w http.ResponseWriter, r *http.Request) {
 	s.maybeReverseProxy(w, r, true)
 }
@@ -241,6 +345,8 @@ func (s *Server) maybeReverseProxyOrPage(w http.ResponseWriter, r *http.Request)
 
 func (s *Server) maybeReverseProxy(w http.ResponseWriter, r *http.Request, httpStatusOnly bool) {
 	lg, r := s.getRequestLogger(r)
+	s.adaptive.ObserveRequest()
+	stripUpstreamHeaders(r)
 
 	if s.opts.OpenGraph.Enabled {
 		if val, _ := s.store.Get(r.Context(), "ogtags:allow:"+r.Host+r.URL.String()); val != nil {
@@ -252,12 +358,15 @@ func (s *Server) maybeReverseProxy(w http.ResponseWriter, r *http.Request, httpS
 
 	// Adjust cookie path if base prefix is not empty
 	cookiePath := "/"
-	if anubis.BasePrefix != "" {
-		cookiePath = strings.TrimSuffix(anubis.BasePrefix, "/") + "/"
+	if s.opts.BasePrefix != "" {
+		cookiePath = strings.TrimSuffix(s.opts.BasePrefix, "/") + "/"
 	}
 
 	cr, rule, err := s.check(r, lg)
 	if err != nil {
+		if s.handleStoreUnavailable(w, r, lg, cr, rule) {
+			return
+		}
 		lg.ErrorContext(r.Context(), "check failed", "err", err)
 		localizer := localization.GetLocalizer(r)
 		s.respondWithError(w, r, fmt.Sprintf("%s \"maybeReverseProxy\"", localizer.T("internal_server_error")), makeCode(err))
@@ -275,6 +384,7 @@ func (s *Server) maybeReverseProxy(w http.ResponseWriter, r *http.Request, httpS
 	ip := r.Header.Get("X-Real-Ip")
 
 	if s.handleDNSBL(w, r, ip, lg) {
+		s.hooks.deny(r, cr, rule)
 		return
 	}
 
@@ -282,36 +392,46 @@ func (s *Server) maybeReverseProxy(w http.ResponseWriter, r *http.Request, httpS
 		return
 	}
 
-	ckie, err := s.getCookie(r, anubis.CookieName)
+	ckie, err := s.getCookie(r, s.opts.CookieName)
 	if err != nil {
 		// Don't clear the cookie, there is none to clear. This response can land
 		// after a concurrent pass-challenge issued a valid one and would delete
 		// it. See https://github.com/TecharoHQ/anubis/issues/1314
 		lg.DebugContext(r.Context(), "cookie not found", "path", r.URL.Path)
-		s.RenderIndex(w, r, cr, rule, httpStatusOnly)
+		s.renderIndex(w, r, lg, cr, rule, httpStatusOnly)
 		return
 	}
 
 	if err := ckie.Valid(); err != nil {
 		lg.DebugContext(r.Context(), "cookie is invalid", "err", err)
 		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
-		s.RenderIndex(w, r, cr, rule, httpStatusOnly)
+		s.renderIndex(w, r, lg, cr, rule, httpStatusOnly)
 		return
 	}
 
 	if time.Now().After(ckie.Expires) && !ckie.Expires.IsZero() {
 		lg.DebugContext(r.Context(), "cookie expired", "path", r.URL.Path)
 		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
-		s.RenderIndex(w, r, cr, rule, httpStatusOnly)
+		s.renderIndex(w, r, lg, cr, rule, httpStatusOnly)
 		return
 	}
 
-	token, err := jwt.ParseWithClaims(ckie.Value, jwt.MapClaims{}, s.getTokenKeyfunc(), jwt.WithExpirationRequired(), jwt.WithStrictDecoding())
+	token, err := jwt.ParseWithClaims(ckie.Value, jwt.MapClaims{}, s.keyring.Keyfunc, jwt.WithExpirationRequired(), jwt.WithStrictDecoding())
+
+	if err == nil && token.Header["typ"] == upstreamDecisionType {
+		err = errors.New("signed upstream decisions can't be used as auth cookies")
+	}
+
+	if err == nil {
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			err = s.checkTokenAudience(r, claims)
+		}
+	}
 
 	if err != nil || !token.Valid {
 		lg.DebugContext(r.Context(), "invalid token", "path", r.URL.Path, "err", err)
 		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
-		s.RenderIndex(w, r, cr, rule, httpStatusOnly)
+		s.renderIndex(w, r, lg, cr, rule, httpStatusOnly)
 		return
 	}
 
@@ -319,7 +439,7 @@ func (s *Server) maybeReverseProxy(w http.ResponseWriter, r *http.Request, httpS
 	if !ok {
 		lg.DebugContext(r.Context(), "invalid token claims type", "path", r.URL.Path)
 		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
-		s.RenderIndex(w, r, cr, rule, httpStatusOnly)
+		s.renderIndex(w, r, lg, cr, rule, httpStatusOnly)
 		return
 	}
 
@@ -327,33 +447,43 @@ func (s *Server) maybeReverseProxy(w http.ResponseWriter, r *http.Request, httpS
 	if !ok {
 		lg.DebugContext(r.Context(), "policyRule claim is not a string")
 		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
-		s.RenderIndex(w, r, cr, rule, httpStatusOnly)
+		s.renderIndex(w, r, lg, cr, rule, httpStatusOnly)
 		return
 	}
 
 	if policyRule != rule.Hash() {
 		lg.DebugContext(r.Context(), "user originally passed with a different rule, issuing new challenge", "old", policyRule, "new", rule.Name)
 		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
-		s.RenderIndex(w, r, cr, rule, httpStatusOnly)
+		s.renderIndex(w, r, lg, cr, rule, httpStatusOnly)
 		return
 	}
 
 	if s.opts.JWTRestrictionHeader != "" && claims["restriction"] != internal.SHA256sum(r.Header.Get(s.opts.JWTRestrictionHeader)) {
 		lg.DebugContext(r.Context(), "JWT restriction header is invalid")
 		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
-		s.RenderIndex(w, r, cr, rule, httpStatusOnly)
+		s.renderIndex(w, r, lg, cr, rule, httpStatusOnly)
 		return
 	}
 
+	if s.tokenRevoked(r, lg, claims) {
+		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
+		s.renderIndex(w, r, lg, cr, rule, httpStatusOnly)
+		return
+	}
+
+	s.maybeRenewToken(w, r, lg, claims, cookiePath)
+
 	r.Header.Add("X-Anubis-Status", "PASS")
+	s.forwardDecision(w, r, cr, claims)
+	s.hooks.allow(r, cr, rule)
 	s.ServeHTTPNext(w, r)
 }
 
 func (s *Server) checkRules(w http.ResponseWriter, r *http.Request, cr policy.CheckResult, lg *slog.Logger, rule *policy.Bot) bool {
 	// Adjust cookie path if base prefix is not empty
 	cookiePath := "/"
-	if anubis.BasePrefix != "" {
-		cookiePath = strings.TrimSuffix(anubis.BasePrefix, "/") + "/"
+	if s.opts.BasePrefix != "" {
+		cookiePath = strings.TrimSuffix(s.opts.BasePrefix, "/") + "/"
 	}
 
 	localizer := localization.GetLocalizer(r)
@@ -361,11 +491,14 @@ func (s *Server) checkRules(w http.ResponseWriter, r *http.Request, cr policy.Ch
 	switch cr.Rule {
 	case config.RuleAllow:
 		lg.DebugContext(r.Context(), "allowing traffic to origin (explicit)")
+		s.forwardDecision(w, r, cr, nil)
+		s.hooks.allow(r, cr, rule)
 		s.ServeHTTPNext(w, r)
 		return true
 	case config.RuleDeny:
 		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
 		lg.InfoContext(r.Context(), "explicit deny")
+		s.hooks.deny(r, cr, rule)
 		if rule == nil {
 			lg.ErrorContext(r.Context(), "rule is nil, cannot calculate checksum")
 			s.respondWithError(w, r, fmt.Sprintf("%s \"maybeReverseProxy.RuleDeny\"", localizer.T("internal_server_error")), makeCode(ErrActualAnubisBug))
@@ -391,6 +524,43 @@ func (s *Server) checkRules(w http.ResponseWriter, r *http.Request, cr policy.Ch
 	return false
 }
 
+// handleStoreUnavailable answers requests that need the storage backend
+// while it is unavailable, according to the configured degraded mode. It
+// reports whether it wrote a response. lg may be nil if the caller has no
+// request logger yet.
+func (s *Server) handleStoreUnavailable(w http.ResponseWriter, r *http.Request, lg *slog.Logger, cr policy.CheckResult, rule *policy.Bot) bool {
+	ds, ok := s.store.(*degraded.Store)
+	if !ok || !ds.Unavailable() {
+		return false
+	}
+
+	if lg == nil {
+		lg, r = s.getRequestLogger(r)
+	}
+
+	switch ds.Mode() {
+	case degraded.ModeOpen:
+		degradedRequests.WithLabelValues(string(degraded.ModeOpen)).Inc()
+		lg.DebugContext(r.Context(), "storage backend is unavailable, allowing traffic to origin without a challenge")
+		r.Header.Add("X-Anubis-Status", "DEGRADED")
+		s.forwardDecision(w, r, cr, nil)
+		s.hooks.allow(r, cr, rule)
+		s.ServeHTTPNext(w, r)
+		return true
+	case degraded.ModeDeny:
+		degradedRequests.WithLabelValues(string(degraded.ModeDeny)).Inc()
+		lg.DebugContext(r.Context(), "storage backend is unavailable, denying traffic")
+		s.hooks.deny(r, cr, rule)
+		localizer := localization.GetLocalizer(r)
+		w.Header().Set("Retry-After", "30")
+		s.respondWithStatus(w, r, localizer.T("temporarily_unavailable"), "", http.StatusServiceUnavailable)
+		return true
+	default:
+		// In memory mode challenges keep working from local memory.
+		return false
+	}
+}
+
 func (s *Server) handleDNSBL(w http.ResponseWriter, r *http.Request, ip string, lg *slog.Logger) bool {
 	db := &store.JSON[dnsbl.DroneBLResponse]{Underlying: s.store, Prefix: "dronebl:"}
 	if s.policy.DNSBL && ip != "" {
@@ -460,6 +630,18 @@ func (s *Server) MakeChallenge(w http.ResponseWriter, r *http.Request) {
 	lg = lg.With("check_result", cr)
 
 	chall, err := s.issueChallenge(r.Context(), r, lg, cr, rule)
+	if errors.Is(err, ErrTooManyChallenges) {
+		lg.WarnContext(r.Context(), "client has too many outstanding challenges")
+		w.WriteHeader(http.StatusTooManyRequests)
+		if err := encoder.Encode(struct {
+			Error string `json:"error"`
+		}{
+			Error: localizer.T("too_many_challenges"),
+		}); err != nil {
+			lg.ErrorContext(r.Context(), "failed to encode error response", "err", err)
+		}
+		return
+	}
 	if err != nil {
 		lg.ErrorContext(r.Context(), "failed to fetch or issue challenge", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -475,7 +657,8 @@ func (s *Server) MakeChallenge(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.SetCookie(w, CookieOpts{Host: r.Host, Name: anubis.TestCookieName, Value: chall.ID})
+	rule = ruleForChallenge(rule, chall)
+	s.SetCookie(w, CookieOpts{Host: r.Host, Name: s.opts.TestCookieName, Value: chall.ID})
 
 	err = encoder.Encode(struct {
 		Rules     *config.ChallengeRules `json:"rules"`
@@ -521,13 +704,13 @@ func (s *Server) PassChallenge(w http.ResponseWriter, r *http.Request) {
 
 	// Adjust cookie path if base prefix is not empty
 	cookiePath := "/"
-	if anubis.BasePrefix != "" {
-		cookiePath = strings.TrimSuffix(anubis.BasePrefix, "/") + "/"
+	if s.opts.BasePrefix != "" {
+		cookiePath = strings.TrimSuffix(s.opts.BasePrefix, "/") + "/"
 	}
 
-	if _, err := s.getCookie(r, anubis.TestCookieName); errors.Is(err, http.ErrNoCookie) {
+	if _, err := s.getCookie(r, s.opts.TestCookieName); errors.Is(err, http.ErrNoCookie) {
 		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
-		s.ClearCookie(w, CookieOpts{Name: anubis.TestCookieName, Host: r.Host})
+		s.ClearCookie(w, CookieOpts{Name: s.opts.TestCookieName, Host: r.Host})
 		lg.WarnContext(r.Context(), "user has cookies disabled, this is not an anubis bug")
 		s.respondWithError(w, r, localizer.T("cookies_disabled"), "")
 		return
@@ -574,24 +757,16 @@ func (s *Server) PassChallenge(w http.ResponseWriter, r *http.Request) {
 
 	rule = s.hydrateChallengeRule(rule, chall, lg)
 
-	impl, ok := challenge.Get(chall.Method)
+	impl, ok := s.challengeImpl(chall.Method)
 	if !ok {
 		lg.ErrorContext(r.Context(), "check failed", "err", err)
 		s.respondWithError(w, r, fmt.Sprintf("%s: %s", localizer.T("internal_server_error"), rule.Challenge.Algorithm), makeCode(ErrActualAnubisBug))
 		return
 	}
 
-	lg = lg.With("challenge", chall.ID)
-
-	in := &challenge.ValidateInput{
-		Challenge: chall,
-		Rule:      rule,
-		Store:     s.store,
-	}
+	lg = lg.With("challenge", challengeID(chall.ID))
 
-	if err := impl.Validate(r, lg, in); err != nil {
-		asn, asnDesc := asnFromContext(r.Context())
-		failedValidations.WithLabelValues(rule.Challenge.Algorithm, asn, asnDesc).Inc()
+	if err := s.validateSolution(r, lg, cr, rule, chall, impl); err != nil {
 		var cerr *challenge.Error
 		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
 		lg.DebugContext(r.Context(), "challenge validate call failed", "err", err)
@@ -607,56 +782,158 @@ func (s *Server) PassChallenge(w http.ResponseWriter, r *http.Request) {
 				lg.ErrorContext(r.Context(), "invalid challenge format", "err", err)
 				s.respondWithError(w, r, cerr.PublicReason, makeCode(err))
 				return
+			case errors.Is(err, challenge.ErrBusy):
+				lg.WarnContext(r.Context(), "too busy to validate challenge", "err", err)
+				w.Header().Set("Retry-After", "5")
+				s.respondWithStatus(w, r, cerr.PublicReason, makeCode(err), cerr.StatusCode)
+				return
 			}
 		}
 	}
 
-	// generate JWT cookie
-	var tokenString string
+	// From here on a stateless challenge is known by its UUID alone.
+	chall.ID = challengeID(chall.ID)
+
+	if claimed, err := s.claimChallenge(r.Context(), chall); err != nil {
+		lg.ErrorContext(r.Context(), "can't claim challenge", "err", err)
+		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
+		s.respondWithError(w, r, fmt.Sprintf("%s \"passChallenge\"", localizer.T("internal_server_error")), makeCode(err))
+		return
+	} else if !claimed {
+		lg.ErrorContext(r.Context(), "double spend prevented", "reason", "double_spend")
+		s.respondWithError(w, r, fmt.Sprintf("%s: %s", localizer.T("internal_server_error"), "double_spend"), "")
+		return
+	}
+
+	tokenString, err := s.signChallengeToken(r, cr, rule, chall)
+	if errors.Is(err, ErrMissingRestrictionHeader) {
+		lg.ErrorContext(r.Context(), "JWTRestrictionHeader is set in config but not found in request, please check your reverse proxy config.")
+		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
+		s.respondWithError(w, r, "failed to sign JWT", "")
+		return
+	}
+	if err != nil {
+		lg.ErrorContext(r.Context(), "failed to sign JWT", "err", err)
+		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
+		s.respondWithError(w, r, localizer.T("failed_to_sign_jwt"), makeCode(err))
+		return
+	}
+
+	s.SetCookie(w, CookieOpts{Path: cookiePath, Host: r.Host, Value: tokenString})
+	s.markChallengeSolved(r, lg, cr, rule, chall)
+	lg.DebugContext(r.Context(), "challenge passed, redirecting to app")
+	http.Redirect(w, r, redir, http.StatusFound)
+}
+
+// validateSolution checks the solution in r against chall, making sure that
+// the client redeeming the challenge is the one it was issued to first.
+// Failures are counted and reported to hooks before being returned.
+func (s *Server) validateSolution(r *http.Request, lg *slog.Logger, cr policy.CheckResult, rule *policy.Bot, chall *challenge.Challenge, impl challenge.Impl) error {
+	in := &challenge.ValidateInput{
+		Challenge: chall,
+		Rule:      rule,
+		Store:     s.store,
+	}
+
+	// Check the binding and count the attempt before doing any potentially
+	// expensive validation work.
+	err := challenge.CheckBinding(r, chall, s.policy.ChallengeBinding)
+	if err == nil {
+		err = s.countAttempt(r.Context(), chall)
+	}
+	if err == nil {
+		err = impl.Validate(r, lg, in)
+	}
 
-	// check if JWTRestrictionHeader is set and header is in request
+	if err != nil && !errors.Is(err, challenge.ErrBusy) {
+		asn, asnDesc := asnFromContext(r.Context())
+		failedValidations.WithLabelValues(rule.Challenge.Algorithm, asn, asnDesc).Inc()
+		s.hooks.challengeFailed(r, cr, rule, chall)
+	}
+
+	return err
+}
+
+// signChallengeToken creates the JWT that proves chall was solved.
+func (s *Server) signChallengeToken(r *http.Request, cr policy.CheckResult, rule *policy.Bot, chall *challenge.Challenge) (string, error) {
 	claims := jwt.MapClaims{
 		"challenge":  chall.ID,
 		"method":     rule.Challenge.Algorithm,
 		"policyRule": rule.Hash(),
 		"action":     string(cr.Rule),
 	}
+
 	if s.opts.JWTRestrictionHeader != "" {
-		if r.Header.Get(s.opts.JWTRestrictionHeader) == "" {
-			lg.ErrorContext(r.Context(), "JWTRestrictionHeader is set in config but not found in request, please check your reverse proxy config.")
-			s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
-			s.respondWithError(w, r, "failed to sign JWT", makeCode(err))
-			return
-		} else {
-			claims["restriction"] = internal.SHA256sum(r.Header.Get(s.opts.JWTRestrictionHeader))
+		val := r.Header.Get(s.opts.JWTRestrictionHeader)
+		if val == "" {
+			return "", ErrMissingRestrictionHeader
 		}
+		claims["restriction"] = internal.SHA256sum(val)
 	}
-	if s.opts.DifficultyInJWT {
+
+	if s.opts.DifficultyInJWT || s.policy.UpstreamHeaders.Includes(config.UpstreamDifficulty) {
 		claims["difficulty"] = rule.Challenge.Difficulty
 	}
-	tokenString, err = s.signJWT(claims)
 
+	return s.signJWT(r, claims)
+}
+
+// claimChallenge atomically records that chall is being redeemed. Only the
+// first caller for a challenge gets true, so concurrent submissions of one
+// solution can't both get a token. Checking chall.Spent alone is not enough
+// for that, as it is only set after the token is signed.
+func (s *Server) claimChallenge(ctx context.Context, chall *challenge.Challenge) (bool, error) {
+	return store.SetNX(ctx, s.store, "challenge-spent:"+chall.ID, []byte("1"), s.policy.Challenges.TTLDuration())
+}
+
+// maxChallengeAttempts is how many solutions can be submitted for one
+// challenge. Honest clients submit a solution once, but may retry when the
+// connection drops.
+const maxChallengeAttempts = 5
+
+// countAttempt counts a submitted solution for chall and fails once the
+// challenge was submitted more than maxChallengeAttempts times. A failed
+// validation doesn't spend a challenge, so without this one challenge could
+// be resubmitted forever, making Anubis redo the work of checking it each
+// time.
+func (s *Server) countAttempt(ctx context.Context, chall *challenge.Challenge) error {
+	n, err := store.Increment(ctx, s.store, "challenge-attempts:"+challengeID(chall.ID), 1, s.policy.Challenges.TTLDuration())
 	if err != nil {
-		lg.ErrorContext(r.Context(), "failed to sign JWT", "err", err)
-		s.ClearCookie(w, CookieOpts{Path: cookiePath, Host: r.Host})
-		s.respondWithError(w, r, localizer.T("failed_to_sign_jwt"), makeCode(err))
-		return
+		cerr := challenge.NewError("validate", "internal error", fmt.Errorf("%w: can't count attempt: %w", challenge.ErrFailed, err))
+		cerr.StatusCode = http.StatusInternalServerError
+		return cerr
 	}
 
-	s.SetCookie(w, CookieOpts{Path: cookiePath, Host: r.Host, Value: tokenString})
+	if n > maxChallengeAttempts {
+		cerr := challenge.NewError("validate", "too many attempts", fmt.Errorf("%w: challenge was submitted %d times", challenge.ErrFailed, n))
+		cerr.StatusCode = http.StatusTooManyRequests
+		return cerr
+	}
+
+	return nil
+}
 
+// markChallengeSolved marks chall as spent so that it can't be redeemed again
+// and records that it was solved.
+func (s *Server) markChallengeSolved(r *http.Request, lg *slog.Logger, cr policy.CheckResult, rule *policy.Bot, chall *challenge.Challenge) {
 	chall.Spent = true
-	j := store.JSON[challenge.Challenge]{Underlying: s.store}
-	if err := j.Set(r.Context(), "challenge:"+chall.ID, *chall, 30*time.Minute); err != nil {
-		lg.DebugContext(r.Context(), "can't update information about challenge", "err", err)
+
+	// Stateless challenges are only remembered in the spent set that
+	// claimChallenge wrote to.
+	if !chall.Stateless {
+		j := store.JSON[challenge.Challenge]{Underlying: s.store}
+		if err := j.Set(r.Context(), "challenge:"+chall.ID, *chall, s.policy.Challenges.TTLDuration()); err != nil {
+			lg.DebugContext(r.Context(), "can't update information about challenge", "err", err)
+		}
+		s.forgetOutstanding(r.Context(), lg, chall)
 	}
 
 	{
 		asn, asnDesc := asnFromContext(r.Context())
 		challengesValidated.WithLabelValues(rule.Challenge.Algorithm, asn, asnDesc).Inc()
 	}
-	lg.DebugContext(r.Context(), "challenge passed, redirecting to app")
-	http.Redirect(w, r, redir, http.StatusFound)
+	s.adaptive.ObserveValidated()
+	s.hooks.challengePassed(r, cr, rule, chall)
 }
 
 func cr(name string, rule config.Rule, weight int) policy.CheckResult {
@@ -681,9 +958,15 @@ func (s *Server) check(r *http.Request, lg *slog.Logger) (policy.CheckResult, *p
 
 	weight := 0
 
+	// Checkers such as webhooks can replace the weight adjustment of the rule
+	// they are part of.
+	var wo checker.WeightOverride
+	r = r.WithContext(checker.WithWeightOverride(r.Context(), &wo))
+
 	// Ranging by index keeps b from escaping to the heap on every iteration.
 	for i := range s.policy.Bots {
 		b := &s.policy.Bots[i]
+		wo.Reset()
 		match, err := b.Rules.Check(r)
 		if err != nil {
 			return decaymap.Zilch[policy.CheckResult](), nil, fmt.Errorf("can't run check %s: %w", b.Name, err)
@@ -696,10 +979,14 @@ func (s *Server) check(r *http.Request, lg *slog.Logger) (policy.CheckResult, *p
 				bot := *b
 				return cr("bot/"+b.Name, b.Action, weight), &bot, nil
 			case config.RuleWeigh:
-				lg.DebugContext(r.Context(), "adjusting weight", "name", b.Name, "delta", b.Weight.Adjust)
+				adjust := b.Weight.Adjust
+				if wo.Set {
+					adjust = wo.Adjust
+				}
+				lg.DebugContext(r.Context(), "adjusting weight", "name", b.Name, "delta", adjust)
 				asn, asnDesc := asnFromContext(r.Context())
 				policy.Applications.WithLabelValues("bot/"+b.Name, "WEIGH", asn, asnDesc).Add(1)
-				weight += b.Weight.Adjust
+				weight += adjust
 			}
 		}
 	}
@@ -2,8 +2,13 @@ package lib
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -11,6 +16,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -20,10 +26,18 @@ import (
 	"github.com/TecharoHQ/anubis/data"
 	"github.com/TecharoHQ/anubis/internal"
 	"github.com/TecharoHQ/anubis/lib/challenge"
+	"github.com/TecharoHQ/anubis/lib/client"
 	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/keyring"
 	"github.com/TecharoHQ/anubis/lib/policy"
+	"github.com/TecharoHQ/anubis/lib/policy/checker"
+	"github.com/TecharoHQ/anubis/lib/revocation"
 	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/degraded"
+	"github.com/TecharoHQ/anubis/lib/store/memory"
 	"github.com/TecharoHQ/anubis/lib/thoth/thothmock"
+	"github.com/TecharoHQ/anubis/xess"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // TLogWriter implements io.Writer by logging each line to t.Log.
@@ -547,9 +561,6 @@ func TestBasePrefix(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// Reset the global BasePrefix before each test
-			anubis.BasePrefix = ""
-
 			pol := loadPolicies(t, "", 4)
 
 			srv := spawnAnubis(t, Options{
@@ -1197,3 +1208,1717 @@ func TestXForwardedForNoDoubleComma(t *testing.T) {
 		t.Errorf("X-Forwarded-For has two leading commas: %q", xff)
 	}
 }
+
+// TestMultipleServersCoexist makes sure that two differently configured servers
+// in the same process do not leak settings into each other.
+func TestMultipleServersCoexist(t *testing.T) {
+	type instance struct {
+		srv        *Server
+		basePrefix string
+		testCookie string
+	}
+
+	var instances []instance
+	for _, prefix := range []string{"/alpha", "/beta"} {
+		testCookie := strings.TrimPrefix(prefix, "/") + "-cookie-verification"
+
+		instances = append(instances, instance{
+			srv: spawnAnubis(t, Options{
+				Next:           http.NewServeMux(),
+				Policy:         loadPolicies(t, "", 4),
+				BasePrefix:     prefix,
+				TestCookieName: testCookie,
+			}),
+			basePrefix: prefix,
+			testCookie: testCookie,
+		})
+	}
+
+	for _, inst := range instances {
+		t.Run(inst.basePrefix, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, inst.basePrefix+"/", nil)
+			req.Header.Set("User-Agent", "Mozilla/5.0")
+			req.Header.Set("Accept-Encoding", "gzip")
+			req.Header.Set("X-Real-Ip", "127.0.0.1")
+
+			rw := httptest.NewRecorder()
+			inst.srv.ServeHTTP(rw, req)
+			resp := rw.Result()
+
+			gzr, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				t.Fatalf("can't read gzipped challenge page: %v", err)
+			}
+			body, err := io.ReadAll(gzr)
+			if err != nil {
+				t.Fatalf("can't read body: %v", err)
+			}
+
+			for _, other := range instances {
+				want := other.basePrefix == inst.basePrefix
+				got := bytes.Contains(body, []byte(`href="`+other.basePrefix+xess.BasePrefix))
+				if got != want {
+					t.Errorf("challenge page references stylesheet under %q: %v, want %v", other.basePrefix, got, want)
+				}
+			}
+
+			var found bool
+			for _, ckie := range resp.Cookies() {
+				if strings.HasPrefix(ckie.Name, inst.testCookie+"-") {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("no cookie named after %q was set", inst.testCookie)
+			}
+		})
+	}
+}
+
+type weightOverrideFactory struct{}
+
+func (weightOverrideFactory) Build(context.Context, json.RawMessage) (checker.Impl, error) {
+	return checker.Func(func(r *http.Request) (bool, error) {
+		checker.SetWeight(r.Context(), 42)
+		return true, nil
+	}), nil
+}
+
+func (weightOverrideFactory) Valid(json.RawMessage) error { return nil }
+
+func TestCheckerWeightOverride(t *testing.T) {
+	checker.Register("test-weight-override", weightOverrideFactory{})
+
+	const policyYAML = `
+bots:
+  - name: static-weight
+    action: WEIGH
+    user_agent_regex: Mozilla
+    weight:
+      adjust: 5
+  - name: dynamic-weight
+    action: WEIGH
+    weight:
+      adjust: 1
+    matchers:
+      - type: test-weight-override
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 4, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := spawnAnubis(t, Options{
+		Next:   http.NewServeMux(),
+		Policy: pol,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("X-Real-Ip", "127.0.0.1")
+
+	cr, _, err := srv.check(req, srv.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cr.Weight != 47 {
+		t.Errorf("wanted weight 47, got: %d", cr.Weight)
+	}
+}
+
+func TestAdaptiveDifficultyIsIssuedAndEnforced(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: generic-browser
+    user_agent_regex: Mozilla
+    action: CHALLENGE
+    challenge:
+      algorithm: fast
+      difficulty: 0
+
+adaptive_difficulty:
+  min: 1
+  max: 4
+  load: 1000
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := spawnAnubis(t, Options{
+		Next:   http.NewServeMux(),
+		Policy: pol,
+	})
+
+	ts := httptest.NewServer(internal.RemoteXRealIP(true, "tcp", srv))
+	defer ts.Close()
+
+	cli := httpClient(t)
+	chall := makeChallenge(t, ts, cli)
+
+	j := store.JSON[challenge.Challenge]{Underlying: pol.Store}
+	stored, err := j.Get(t.Context(), "challenge:"+chall.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Difficulty != 1 {
+		t.Errorf("wanted the adaptive difficulty 1 to be stored in the challenge, got: %d", stored.Difficulty)
+	}
+
+	if pol.Bots[0].Challenge.Difficulty != 0 {
+		t.Errorf("issuing a challenge modified the policy, difficulty is now: %d", pol.Bots[0].Challenge.Difficulty)
+	}
+
+	pass := func(nonce int) *http.Response {
+		t.Helper()
+
+		q := url.Values{}
+		q.Set("response", internal.SHA256sum(fmt.Sprint(chall.Challenge, nonce)))
+		q.Set("nonce", fmt.Sprint(nonce))
+		q.Set("redir", "/")
+		q.Set("elapsedTime", "420")
+		q.Set("id", chall.ID)
+
+		resp, err := cli.Get(ts.URL + "/.within.website/x/cmd/anubis/api/pass-challenge?" + q.Encode())
+		if err != nil {
+			t.Fatalf("can't do request: %v", err)
+		}
+		resp.Body.Close() //nolint:errcheck
+
+		return resp
+	}
+
+	// Find a nonce that only solves the rule's difficulty of 0.
+	easy := -1
+	for nonce := 0; easy == -1; nonce++ {
+		if !strings.HasPrefix(internal.SHA256sum(fmt.Sprint(chall.Challenge, nonce)), "0") {
+			easy = nonce
+		}
+	}
+
+	if resp := pass(easy); resp.StatusCode == http.StatusFound {
+		t.Errorf("a solution for the rule's difficulty should not pass the issued difficulty")
+	}
+
+	// A failed attempt clears the test cookie, so start over.
+	cli = httpClient(t)
+	chall = makeChallenge(t, ts, cli)
+
+	hard := -1
+	for nonce := 0; hard == -1; nonce++ {
+		if strings.HasPrefix(internal.SHA256sum(fmt.Sprint(chall.Challenge, nonce)), "0") {
+			hard = nonce
+		}
+	}
+
+	if resp := pass(hard); resp.StatusCode != http.StatusFound {
+		t.Errorf("wanted %d, got: %d", http.StatusFound, resp.StatusCode)
+	}
+}
+
+func TestOutstandingChallengeLimit(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: generic-browser
+    user_agent_regex: Mozilla
+    action: CHALLENGE
+
+challenges:
+  ttl: 10m
+  max_outstanding: 2
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := spawnAnubis(t, Options{
+		Next:   http.NewServeMux(),
+		Policy: pol,
+	})
+
+	mkChallenge := func(ip, userAgent string) (int, string) {
+		t.Helper()
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/.within.website/x/cmd/anubis/api/make-challenge?redir=/", nil)
+		req.Header.Set("X-Real-Ip", ip)
+		req.Header.Set("User-Agent", userAgent)
+
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		var resp challengeResp
+		json.NewDecoder(rec.Body).Decode(&resp) //nolint:errcheck
+
+		return rec.Code, resp.ID
+	}
+
+	_, first := mkChallenge("198.51.100.1", "Mozilla/5.0 (first)")
+	_, second := mkChallenge("198.51.100.2", "Mozilla/5.0 (second)")
+
+	if first == "" || second == "" || first == second {
+		t.Fatalf("wanted two different challenges, got: %q and %q", first, second)
+	}
+
+	// The network is at its limit, so the same client gets its challenge back.
+	if code, id := mkChallenge("198.51.100.2", "Mozilla/5.0 (second)"); code != http.StatusOK || id != second {
+		t.Errorf("wanted challenge %s to be reissued, got %d and %q", second, code, id)
+	}
+
+	// Someone else on the same network can't get a new one.
+	if code, _ := mkChallenge("198.51.100.3", "Mozilla/5.0 (third)"); code != http.StatusTooManyRequests {
+		t.Errorf("wanted %d, got: %d", http.StatusTooManyRequests, code)
+	}
+
+	// Other networks are not affected.
+	if code, id := mkChallenge("203.0.113.1", "Mozilla/5.0 (first)"); code != http.StatusOK || id == "" {
+		t.Errorf("a client on another network should get a challenge, got %d and %q", code, id)
+	}
+
+	j := store.JSON[challenge.Challenge]{Underlying: pol.Store}
+	if _, err := j.Get(t.Context(), "challenge:"+first); err != nil {
+		t.Errorf("outstanding challenge should still be stored: %v", err)
+	}
+
+	// A flood of clients on one network racing each other still can't get
+	// more challenges than the limit.
+	var wg sync.WaitGroup
+	ids := make(chan string, 32)
+	for i := range cap(ids) {
+		wg.Go(func() {
+			if code, id := mkChallenge(fmt.Sprintf("192.0.2.%d", i+1), "Mozilla/5.0 (flood)"); code == http.StatusOK {
+				ids <- id
+			}
+		})
+	}
+	wg.Wait()
+	close(ids)
+
+	issued := map[string]bool{}
+	for id := range ids {
+		issued[id] = true
+	}
+	if len(issued) > 2 {
+		t.Errorf("wanted at most 2 challenges for the network, got %d", len(issued))
+	}
+}
+
+func TestOutstandingSlotFreedAfterIPChange(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+    challenge:
+      algorithm: fast
+      difficulty: 1
+
+challenges:
+  ttl: 10m
+  max_outstanding: 1
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := spawnAnubis(t, Options{
+		Next:             http.NewServeMux(),
+		Policy:           pol,
+		CookieExpiration: time.Hour,
+	})
+
+	apiCall := func(endpoint, ip, userAgent string, body, dst any) int {
+		t.Helper()
+
+		buf, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, anubis.APIPrefix+endpoint, bytes.NewReader(buf))
+		req.Header.Set("X-Real-Ip", ip)
+		req.Header.Set("User-Agent", userAgent)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+
+		if dst != nil {
+			json.NewDecoder(rw.Body).Decode(dst) //nolint:errcheck
+		}
+		return rw.Code
+	}
+
+	var chall challengeAPIResponse
+	if code := apiCall("v1/challenge", "198.51.100.1", "first", map[string]string{"redir": "/"}, &chall); code != http.StatusOK {
+		t.Fatalf("wanted a challenge, got: %d", code)
+	}
+
+	nonce, response, err := client.Solve(t.Context(), chall.Challenge, chall.Rules.Difficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The client moved to another network before solving the challenge.
+	if code := apiCall("v1/solve", "203.0.113.1", "first", map[string]any{
+		"id":    chall.ID,
+		"redir": "/",
+		"solution": map[string]string{
+			"nonce":       strconv.Itoa(nonce),
+			"response":    response,
+			"elapsedTime": "100",
+		},
+	}, nil); code != http.StatusOK {
+		t.Fatalf("solving the challenge failed: %d", code)
+	}
+
+	// The slot on the network the challenge was issued to is free again.
+	if code := apiCall("v1/challenge", "198.51.100.2", "second", map[string]string{"redir": "/"}, nil); code != http.StatusOK {
+		t.Errorf("wanted a new challenge after the last one was solved, got: %d", code)
+	}
+}
+
+func TestAPIKeyBypass(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+
+api_keys:
+  header: X-Anubis-Key
+  keys:
+    - name: ci
+      hash: sha256:21974faad09c41084fe7e836c08fe39d0a0f09ad32a03d21de2ea760ad72715f
+      paths:
+        - /api
+      action: ALLOW
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var upstreamHeaders http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeaders = r.Header.Clone()
+		fmt.Fprint(w, "upstream")
+	})
+
+	srv := spawnAnubis(t, Options{
+		Next:   next,
+		Policy: pol,
+	})
+
+	get := func(path, header, value string) string {
+		t.Helper()
+		upstreamHeaders = nil
+
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, path, nil)
+		req.Header.Set("X-Real-Ip", "198.51.100.1")
+		req.Header.Set("User-Agent", "ci-runner/1.0")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		return rec.Body.String()
+	}
+
+	if body := get("/api/builds", "Authorization", "Bearer ci-key"); body != "upstream" {
+		t.Errorf("a valid key should be let through, got: %q", body)
+	}
+	if upstreamHeaders.Get("Authorization") != "" {
+		t.Error("the API key must not be passed upstream")
+	}
+
+	if body := get("/api/builds", "X-Anubis-Key", "ci-key"); body != "upstream" {
+		t.Errorf("a valid key in the configured header should be let through, got: %q", body)
+	}
+	if upstreamHeaders.Get("X-Anubis-Key") != "" {
+		t.Error("the API key header must not be passed upstream")
+	}
+
+	if body := get("/admin", "Authorization", "Bearer ci-key"); body == "upstream" {
+		t.Error("a key used outside of its paths should be challenged")
+	}
+
+	if body := get("/api/builds", "Authorization", "Bearer wrong"); body == "upstream" {
+		t.Error("an unknown key should be challenged")
+	}
+}
+
+func TestChallengeAPIClient(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+    challenge:
+      algorithm: fast
+      difficulty: 2
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.URL.Path, body)
+	})
+
+	srv := spawnAnubis(t, Options{
+		Next:             next,
+		Policy:           pol,
+		CookieExpiration: time.Hour,
+	})
+
+	var solves int
+	var mu sync.Mutex
+	ts := httptest.NewServer(internal.RemoteXRealIP(true, "tcp", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/v1/solve") {
+			mu.Lock()
+			solves++
+			mu.Unlock()
+		}
+		srv.ServeHTTP(w, r)
+	})))
+	t.Cleanup(ts.Close)
+
+	cli := &http.Client{Transport: &client.Transport{}}
+
+	resp, err := cli.Get(ts.URL + "/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "GET /docs " {
+		t.Fatalf("wanted the upstream response, got %d: %q", resp.StatusCode, body)
+	}
+
+	resp, err = cli.Post(ts.URL+"/upload", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "POST /upload hello" {
+		t.Fatalf("wanted the upstream response, got %d: %q", resp.StatusCode, body)
+	}
+
+	mu.Lock()
+	if solves != 1 {
+		t.Errorf("the token should be reused for later requests, got %d solves", solves)
+	}
+	mu.Unlock()
+
+	// Ask for a challenge by hand and submit a wrong and then a right answer.
+	apiCall := func(endpoint string, body any) (int, map[string]any) {
+		t.Helper()
+
+		buf, _ := json.Marshal(body)
+		resp, err := http.Post(ts.URL+anubis.APIPrefix+endpoint, "application/json", bytes.NewReader(buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var result map[string]any
+		json.NewDecoder(resp.Body).Decode(&result) //nolint:errcheck
+		return resp.StatusCode, result
+	}
+
+	if code, _ := apiCall("v1/challenge", map[string]string{"redir": "https://example.com/"}); code != http.StatusBadRequest {
+		t.Errorf("redirects to other hosts should be rejected, got: %d", code)
+	}
+
+	code, chall := apiCall("v1/challenge", map[string]string{"redir": "/docs"})
+	if code != http.StatusOK || chall["action"] != "CHALLENGE" {
+		t.Fatalf("wanted a challenge, got %d: %v", code, chall)
+	}
+
+	id, random := chall["id"].(string), chall["challenge"].(string)
+	nonce, response, err := client.Solve(t.Context(), random, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	solve := func(response string) (int, map[string]any) {
+		return apiCall("v1/solve", map[string]any{
+			"id":    id,
+			"redir": "/docs",
+			"solution": map[string]string{
+				"nonce":       strconv.Itoa(nonce),
+				"response":    response,
+				"elapsedTime": "10",
+			},
+		})
+	}
+
+	if code, _ := solve(strings.Repeat("0", 64)); code != http.StatusForbidden {
+		t.Errorf("a wrong answer should be rejected, got: %d", code)
+	}
+
+	code, solved := solve(response)
+	if code != http.StatusOK || solved["token"] == "" || solved["cookie_name"] != srv.cookieName(anubis.CookieName) {
+		t.Fatalf("wanted a token, got %d: %v", code, solved)
+	}
+
+	if code, _ := solve(response); code != http.StatusConflict {
+		t.Errorf("a challenge should only be redeemable once, got: %d", code)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+    challenge:
+      algorithm: fast
+      difficulty: 1
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, retired, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, active, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kr, err := keyring.New(&keyring.Key{ID: "new", Ed25519: active}, &keyring.Key{ID: "old", Ed25519Public: retired.Public().(ed25519.PublicKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := spawnAnubis(t, Options{
+		Next:             http.NewServeMux(),
+		Policy:           pol,
+		CookieExpiration: time.Hour,
+		Keyring:          kr,
+		JWTAudience:      "example.com",
+	})
+
+	ts := httptest.NewServer(internal.RemoteXRealIP(true, "tcp", srv))
+	t.Cleanup(ts.Close)
+
+	resp, err := http.Get(ts.URL + anubis.JWKSPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/jwk-set+json" {
+		t.Errorf("wrong content type: %q", ct)
+	}
+
+	var jwks keyring.JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := map[string]ed25519.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.KeyType != "OKP" || k.Curve != "Ed25519" || k.Algorithm != "EdDSA" {
+			t.Errorf("wrong key parameters: %+v", k)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[k.KeyID] = x
+	}
+
+	if !keys["old"].Equal(retired.Public()) || !keys["new"].Equal(active.Public()) {
+		t.Fatalf("the JWKS should hold every public key, got: %+v", jwks)
+	}
+
+	// Get a token through the challenge API and verify it like an upstream would.
+	apiCall := func(endpoint string, body, dst any) {
+		t.Helper()
+
+		buf, _ := json.Marshal(body)
+		resp, err := http.Post(ts.URL+anubis.APIPrefix+endpoint, "application/json", bytes.NewReader(buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s returned %d", endpoint, resp.StatusCode)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var chall challengeAPIResponse
+	apiCall("v1/challenge", map[string]string{"redir": "/"}, &chall)
+
+	nonce, response, err := client.Solve(t.Context(), chall.Challenge, chall.Rules.Difficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var solved solveAPIResponse
+	apiCall("v1/solve", map[string]any{
+		"id":    chall.ID,
+		"redir": "/",
+		"solution": map[string]string{
+			"nonce":       strconv.Itoa(nonce),
+			"response":    response,
+			"elapsedTime": "100",
+		},
+	}, &solved)
+
+	token, err := jwt.Parse(solved.Token, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{"EdDSA"}),
+		jwt.WithIssuer(anubis.JWTIssuer),
+		jwt.WithAudience("example.com"),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		t.Fatalf("token should verify with the published keys: %v", err)
+	}
+
+	if token.Header["kid"] != "new" {
+		t.Errorf("token should be signed with the active key, got kid: %v", token.Header["kid"])
+	}
+}
+
+func TestUpstreamHeaders(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: allow-api
+    path_regex: ^/api/
+    action: ALLOW
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+    challenge:
+      algorithm: fast
+      difficulty: 1
+
+upstream_headers:
+  sign: true
+  include:
+    - challenge_id
+    - method
+    - difficulty
+    - issued_at
+    - weight
+    - asn
+    - country
+`
+
+	pol, err := policy.ParseConfig(thothmock.WithMockThoth(t), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	})
+
+	srv := spawnAnubis(t, Options{
+		Next:             next,
+		Policy:           pol,
+		CookieExpiration: time.Hour,
+	})
+
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req.Header.Set("X-Real-Ip", "1.1.1.1")
+		req.Header.Set("User-Agent", "Mozilla/5.0")
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	verifyDecision := func(want map[string]any) {
+		t.Helper()
+
+		token, err := jwt.Parse(got.Get("X-Anubis-Decision"), srv.keyring.Keyfunc, jwt.WithIssuer(anubis.JWTIssuer), jwt.WithExpirationRequired())
+		if err != nil {
+			t.Fatalf("signed decision should verify: %v", err)
+		}
+
+		if token.Header["typ"] != upstreamDecisionType {
+			t.Errorf("wanted decision typ %q, got: %v", upstreamDecisionType, token.Header["typ"])
+		}
+
+		claims := token.Claims.(jwt.MapClaims)
+		for k, v := range want {
+			if claims[k] != v {
+				t.Errorf("decision claim %s: wanted %v, got %v", k, v, claims[k])
+			}
+		}
+	}
+
+	// Spoofed headers are replaced by what Anubis knows.
+	req := httptest.NewRequest(http.MethodGet, "/api/v1", nil)
+	req.Header.Set("X-Anubis-Challenge-Id", "spoofed")
+	req.Header.Set("X-Anubis-Decision", "spoofed")
+	req.Header.Set("X-Anubis-Status", "PASS")
+	do(req)
+
+	for header, want := range map[string]string{
+		"X-Anubis-Action":       "ALLOW",
+		"X-Anubis-Status":       "",
+		"X-Anubis-Challenge-Id": "",
+		"X-Anubis-Weight":       "0",
+		"X-Anubis-Asn":          "13335",
+		"X-Anubis-Country":      "US",
+	} {
+		if got.Get(header) != want {
+			t.Errorf("%s: wanted %q, got %q", header, want, got.Get(header))
+		}
+	}
+	verifyDecision(map[string]any{"action": "ALLOW", "asn": "13335", "country": "US"})
+
+	// Pass a challenge and check that the token's facts are forwarded.
+	apiCall := func(endpoint string, body, dst any) {
+		t.Helper()
+
+		buf, _ := json.Marshal(body)
+		rw := do(httptest.NewRequest(http.MethodPost, anubis.APIPrefix+endpoint, bytes.NewReader(buf)))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("%s returned %d: %s", endpoint, rw.Code, rw.Body)
+		}
+
+		if err := json.NewDecoder(rw.Body).Decode(dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var chall challengeAPIResponse
+	apiCall("v1/challenge", map[string]string{"redir": "/"}, &chall)
+
+	nonce, response, err := client.Solve(t.Context(), chall.Challenge, chall.Rules.Difficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var solved solveAPIResponse
+	apiCall("v1/solve", map[string]any{
+		"id":    chall.ID,
+		"redir": "/",
+		"solution": map[string]string{
+			"nonce":       strconv.Itoa(nonce),
+			"response":    response,
+			"elapsedTime": "100",
+		},
+	}, &solved)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: solved.CookieName, Value: solved.Token})
+	req.Header.Set("X-Anubis-Challenge-Id", "spoofed")
+	got = nil
+	do(req)
+
+	if got == nil {
+		t.Fatal("request with a valid token should reach the upstream")
+	}
+
+	for header, want := range map[string]string{
+		"X-Anubis-Status":           "PASS",
+		"X-Anubis-Challenge-Id":     chall.ID,
+		"X-Anubis-Challenge-Method": "fast",
+		"X-Anubis-Difficulty":       "1",
+	} {
+		if got.Get(header) != want {
+			t.Errorf("%s: wanted %q, got %q", header, want, got.Get(header))
+		}
+	}
+
+	if _, err := time.Parse(time.RFC3339, got.Get("X-Anubis-Issued-At")); err != nil {
+		t.Errorf("X-Anubis-Issued-At should be an RFC 3339 timestamp: %v", err)
+	}
+
+	verifyDecision(map[string]any{"action": "CHALLENGE", "challenge_id": chall.ID, "method": "fast", "difficulty": float64(1)})
+
+	// A decision carries the same issuer, audience and claims as the cookie,
+	// but must not be accepted in its place.
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: solved.CookieName, Value: got.Get("X-Anubis-Decision")})
+	got = nil
+	do(req)
+
+	if got != nil {
+		t.Error("a signed decision was accepted as an auth cookie")
+	}
+}
+
+// passChallengeViaAPI solves a challenge through the JSON challenge API as the
+// client at ip and returns the token it got.
+func passChallengeViaAPI(t *testing.T, srv http.Handler, ip string) solveAPIResponse {
+	t.Helper()
+
+	apiCall := func(endpoint string, body, dst any) {
+		t.Helper()
+
+		buf, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, anubis.APIPrefix+endpoint, bytes.NewReader(buf))
+		req.Header.Set("X-Real-Ip", ip)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+
+		if rw.Code != http.StatusOK {
+			t.Fatalf("%s returned %d: %s", endpoint, rw.Code, rw.Body)
+		}
+
+		if err := json.NewDecoder(rw.Body).Decode(dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var chall challengeAPIResponse
+	apiCall("v1/challenge", map[string]string{"redir": "/"}, &chall)
+
+	nonce, response, err := client.Solve(t.Context(), chall.Challenge, chall.Rules.Difficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var solved solveAPIResponse
+	apiCall("v1/solve", map[string]any{
+		"id":    chall.ID,
+		"redir": "/",
+		"solution": map[string]string{
+			"nonce":       strconv.Itoa(nonce),
+			"response":    response,
+			"elapsedTime": "100",
+		},
+	}, &solved)
+
+	return solved
+}
+
+func TestTokenRevocation(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+    challenge:
+      algorithm: fast
+      difficulty: 1
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "upstream")
+	})
+
+	srv := spawnAnubis(t, Options{
+		Next:             next,
+		Policy:           pol,
+		CookieExpiration: time.Hour,
+		AdminToken:       "hunter2",
+	})
+
+	passes := func(tok solveAPIResponse, ip string) bool {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-Ip", ip)
+		req.AddCookie(&http.Cookie{Name: tok.CookieName, Value: tok.Token})
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+
+		return rw.Body.String() == "upstream"
+	}
+
+	admin := func(method, token string, body any) int {
+		t.Helper()
+
+		buf, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, anubis.APIPrefix+"admin/revocations", bytes.NewReader(buf))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+
+		return rw.Code
+	}
+
+	first := passChallengeViaAPI(t, srv, "198.51.100.7")
+	second := passChallengeViaAPI(t, srv, "203.0.113.1")
+
+	if !passes(first, "198.51.100.7") || !passes(second, "203.0.113.1") {
+		t.Fatal("fresh tokens should be accepted")
+	}
+
+	firstClaims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(first.Token, firstClaims); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := admin(http.MethodPost, "wrong", map[string]string{"challenge_id": firstClaims["challenge"].(string)}); code != http.StatusUnauthorized {
+		t.Errorf("admin API should require the admin token, got: %d", code)
+	}
+
+	if code := admin(http.MethodPost, "hunter2", map[string]string{"challenge_id": "a", "ip": "198.51.100.7"}); code != http.StatusBadRequest {
+		t.Errorf("invalid revocations should be rejected, got: %d", code)
+	}
+
+	if code := admin(http.MethodPost, "hunter2", map[string]string{"challenge_id": firstClaims["challenge"].(string)}); code != http.StatusNoContent {
+		t.Fatalf("revoking by challenge failed: %d", code)
+	}
+
+	if passes(first, "198.51.100.7") {
+		t.Error("revoked token should be rejected")
+	}
+	if !passes(second, "203.0.113.1") {
+		t.Error("other tokens should still be accepted")
+	}
+
+	if code := admin(http.MethodDelete, "hunter2", map[string]string{"challenge_id": firstClaims["challenge"].(string)}); code != http.StatusNoContent {
+		t.Fatalf("lifting the revocation failed: %d", code)
+	}
+	if !passes(first, "198.51.100.7") {
+		t.Error("token should be accepted after its revocation was lifted")
+	}
+
+	if code := admin(http.MethodPost, "hunter2", map[string]string{"issued_before": time.Now().Add(time.Second).Format(time.RFC3339)}); code != http.StatusBadRequest {
+		t.Errorf("revoking future tokens should be rejected, got: %d", code)
+	}
+
+	if code := admin(http.MethodPost, "hunter2", map[string]string{"issued_before": time.Now().Format(time.RFC3339)}); code != http.StatusNoContent {
+		t.Fatalf("revoking by issue time failed: %d", code)
+	}
+
+	if passes(first, "198.51.100.7") || passes(second, "203.0.113.1") {
+		t.Error("every token issued before the cutoff should be rejected")
+	}
+}
+
+func TestTokenIssuerAndAudience(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+    challenge:
+      algorithm: fast
+      difficulty: 1
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "upstream")
+	})
+
+	srv := spawnAnubis(t, Options{
+		Next:             next,
+		Policy:           pol,
+		CookieExpiration: time.Hour,
+	})
+
+	tok := passChallengeViaAPI(t, srv, "198.51.100.7")
+	orig := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tok.Token, orig); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		edit   jwt.MapClaims
+		remove []string
+		passes bool
+	}{
+		{
+			name:   "as issued",
+			passes: true,
+		},
+		{
+			name: "wrong issuer",
+			edit: jwt.MapClaims{"iss": "someone-else"},
+		},
+		{
+			name: "wrong audience",
+			edit: jwt.MapClaims{"aud": "git.techaro.lol"},
+		},
+		{
+			name:   "issued before iss and aud were set",
+			remove: []string{"iss", "aud"},
+			passes: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{}
+			for k, v := range orig {
+				claims[k] = v
+			}
+			for k, v := range tt.edit {
+				claims[k] = v
+			}
+			for _, k := range tt.remove {
+				delete(claims, k)
+			}
+
+			token, err := srv.keyring.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-Ip", "198.51.100.7")
+			req.AddCookie(&http.Cookie{Name: tok.CookieName, Value: token})
+			rw := httptest.NewRecorder()
+			srv.ServeHTTP(rw, req)
+
+			if passes := rw.Body.String() == "upstream"; passes != tt.passes {
+				t.Errorf("wanted token to pass: %v, got %d: %s", tt.passes, rw.Code, rw.Body)
+			}
+		})
+	}
+}
+
+func TestAdminAPIDisabledWithoutToken(t *testing.T) {
+	srv := spawnAnubis(t, Options{Next: http.NewServeMux()})
+
+	req := httptest.NewRequest(http.MethodPost, anubis.APIPrefix+"admin/revocations", strings.NewReader(`{"ip":"198.51.100.7"}`))
+	req.Header.Set("Authorization", "Bearer ")
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, req)
+
+	if rw.Code == http.StatusNoContent {
+		t.Error("admin API should not be served without an admin token")
+	}
+}
+
+func TestTokenRenewal(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+    challenge:
+      algorithm: fast
+      difficulty: 1
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "upstream")
+	})
+
+	srv := spawnAnubis(t, Options{
+		Next:              next,
+		Policy:            pol,
+		CookieExpiration:  time.Hour,
+		CookieRenewAfter:  0.5,
+		CookieMaxLifetime: 3 * time.Hour,
+	})
+
+	tok := passChallengeViaAPI(t, srv, "198.51.100.7")
+	orig := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tok.Token, orig); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	// request sends a token with the claims of tok changed by edit and returns
+	// the claims of the renewed token, if any.
+	request := func(edit jwt.MapClaims) jwt.MapClaims {
+		t.Helper()
+
+		claims := jwt.MapClaims{}
+		for k, v := range orig {
+			claims[k] = v
+		}
+		for k, v := range edit {
+			claims[k] = v
+		}
+
+		token, err := srv.keyring.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-Ip", "198.51.100.7")
+		req.AddCookie(&http.Cookie{Name: tok.CookieName, Value: token})
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+
+		if rw.Body.String() != "upstream" {
+			t.Fatalf("token should be accepted, got %d: %s", rw.Code, rw.Body)
+		}
+
+		for _, ckie := range rw.Result().Cookies() {
+			if ckie.Name != tok.CookieName {
+				continue
+			}
+
+			renewed := jwt.MapClaims{}
+			if _, err := jwt.ParseWithClaims(ckie.Value, renewed, srv.keyring.Keyfunc); err != nil {
+				t.Fatalf("renewed token should be valid: %v", err)
+			}
+			return renewed
+		}
+
+		return nil
+	}
+
+	if renewed := request(nil); renewed != nil {
+		t.Error("fresh tokens should not be renewed")
+	}
+
+	issued := now.Add(-40 * time.Minute)
+	renewed := request(jwt.MapClaims{"iat": issued.Unix(), "exp": now.Add(20 * time.Minute).Unix()})
+	if renewed == nil {
+		t.Fatal("tokens past the renewal point should be renewed")
+	}
+
+	if renewed["challenge"] != orig["challenge"] || renewed["policyRule"] != orig["policyRule"] {
+		t.Errorf("renewal should keep the challenge claims, got: %v", renewed)
+	}
+	if renewed[authTimeClaim] != float64(issued.Unix()) {
+		t.Errorf("auth_time should be when the challenge was solved, got: %v", renewed[authTimeClaim])
+	}
+	if exp, _ := renewed.GetExpirationTime(); exp == nil || exp.Sub(now) < 59*time.Minute {
+		t.Errorf("renewed token should be valid for the full cookie lifetime, expires: %v", exp)
+	}
+
+	// Near the maximum lifetime, the token is only extended up to it.
+	authTime := now.Add(-170 * time.Minute)
+	renewed = request(jwt.MapClaims{authTimeClaim: authTime.Unix(), "iat": issued.Unix(), "exp": now.Add(5 * time.Minute).Unix()})
+	if renewed == nil {
+		t.Fatal("token should be extended up to the maximum lifetime")
+	}
+	if exp, _ := renewed.GetExpirationTime(); exp == nil || !exp.Equal(authTime.Add(3*time.Hour).Truncate(time.Second)) {
+		t.Errorf("renewed token should expire at the maximum lifetime, expires: %v", exp)
+	}
+
+	if renewed := request(jwt.MapClaims{authTimeClaim: authTime.Unix(), "iat": issued.Unix(), "exp": authTime.Add(3 * time.Hour).Unix()}); renewed != nil {
+		t.Error("tokens at the maximum lifetime should not be renewed")
+	}
+}
+
+func TestRevokeRenewedToken(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+    challenge:
+      algorithm: fast
+      difficulty: 1
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "upstream")
+	})
+
+	srv := spawnAnubis(t, Options{
+		Next:              next,
+		Policy:            pol,
+		CookieExpiration:  time.Hour,
+		CookieRenewAfter:  0.5,
+		CookieMaxLifetime: 3 * time.Hour,
+		AdminToken:        "hunter2",
+	})
+
+	tok := passChallengeViaAPI(t, srv, "198.51.100.7")
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tok.Token, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pretend the challenge was solved 40 minutes ago so that the token is
+	// renewed right away.
+	now := time.Now()
+	solved := now.Add(-40 * time.Minute)
+	claims["iat"] = solved.Unix()
+	claims["exp"] = now.Add(20 * time.Minute).Unix()
+	old, err := srv.keyring.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(token string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Real-Ip", "198.51.100.7")
+		req.AddCookie(&http.Cookie{Name: tok.CookieName, Value: token})
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	var renewed string
+	for _, ckie := range request(old).Result().Cookies() {
+		if ckie.Name == tok.CookieName {
+			renewed = ckie.Value
+		}
+	}
+	if renewed == "" {
+		t.Fatal("token should have been renewed")
+	}
+
+	// Revoke every session started before a cutoff between the solve and the
+	// renewal.
+	buf, _ := json.Marshal(map[string]string{"issued_before": now.Add(-20 * time.Minute).Format(time.RFC3339)})
+	req := httptest.NewRequest(http.MethodPost, anubis.APIPrefix+"admin/revocations", bytes.NewReader(buf))
+	req.Header.Set("Authorization", "Bearer hunter2")
+	rw := httptest.NewRecorder()
+	srv.ServeHTTP(rw, req)
+	if rw.Code != http.StatusNoContent {
+		t.Fatalf("revoking by issue time failed: %d", rw.Code)
+	}
+
+	if rw := request(renewed); rw.Body.String() == "upstream" {
+		t.Error("renewed token for a session started before the cutoff should be rejected")
+	}
+}
+
+func TestConcurrentDoubleSpend(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+    challenge:
+      algorithm: fast
+      difficulty: 1
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Slow down reading challenges so that every submission below sees the
+	// challenge as unspent before any of them can mark it spent.
+	pol.Store = slowChallengeStore{Interface: pol.Store}
+
+	srv := spawnAnubis(t, Options{
+		Next:             http.NewServeMux(),
+		Policy:           pol,
+		CookieExpiration: time.Hour,
+	})
+
+	apiCall := func(endpoint string, body any) *httptest.ResponseRecorder {
+		buf, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, anubis.APIPrefix+endpoint, bytes.NewReader(buf))
+		req.Header.Set("X-Real-Ip", "198.51.100.7")
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	var chall challengeAPIResponse
+	if err := json.NewDecoder(apiCall("v1/challenge", map[string]string{"redir": "/"}).Body).Decode(&chall); err != nil {
+		t.Fatal(err)
+	}
+
+	nonce, response, err := client.Solve(t.Context(), chall.Challenge, chall.Rules.Difficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Submit the same solution many times at once. Only one submission may
+	// get a token, even though they all see the challenge as unspent.
+	var wg sync.WaitGroup
+	codes := make(chan int, 16)
+	for range cap(codes) {
+		wg.Go(func() {
+			codes <- apiCall("v1/solve", map[string]any{
+				"id":    chall.ID,
+				"redir": "/",
+				"solution": map[string]string{
+					"nonce":       strconv.Itoa(nonce),
+					"response":    response,
+					"elapsedTime": "100",
+				},
+			}).Code
+		})
+	}
+	wg.Wait()
+	close(codes)
+
+	tokens := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			tokens++
+		case http.StatusConflict, http.StatusTooManyRequests:
+		default:
+			t.Errorf("unexpected status: %d", code)
+		}
+	}
+
+	if tokens != 1 {
+		t.Errorf("wanted exactly one token to be minted, got %d", tokens)
+	}
+}
+
+func TestChallengeAttemptLimit(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+    challenge:
+      algorithm: scrypt
+      difficulty: 0
+      memory: 16
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := spawnAnubis(t, Options{
+		Next:             http.NewServeMux(),
+		Policy:           pol,
+		CookieExpiration: time.Hour,
+	})
+
+	apiCall := func(endpoint string, body any) *httptest.ResponseRecorder {
+		buf, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, anubis.APIPrefix+endpoint, bytes.NewReader(buf))
+		req.Header.Set("X-Real-Ip", "198.51.100.7")
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	var chall challengeAPIResponse
+	if err := json.NewDecoder(apiCall("v1/challenge", map[string]string{"redir": "/"}).Body).Decode(&chall); err != nil {
+		t.Fatal(err)
+	}
+
+	solve := func(response string) int {
+		return apiCall("v1/solve", map[string]any{
+			"id":    chall.ID,
+			"redir": "/",
+			"solution": map[string]string{
+				"nonce":       "0",
+				"response":    response,
+				"elapsedTime": "100",
+			},
+		}).Code
+	}
+
+	// With a difficulty of 0 every wrong response gets past the cheap prefix
+	// check, so each of these makes Anubis compute a scrypt hash.
+	for i := range maxChallengeAttempts {
+		if code := solve("wrong"); code != http.StatusForbidden {
+			t.Fatalf("attempt %d: wanted %d, got: %d", i+1, http.StatusForbidden, code)
+		}
+	}
+
+	sum, err := internal.ScryptSum(chall.Challenge, "0", 16, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := solve(hex.EncodeToString(sum)); code != http.StatusTooManyRequests {
+		t.Errorf("wanted a challenge that was submitted too often to be refused with %d, got: %d", http.StatusTooManyRequests, code)
+	}
+}
+
+// slowChallengeStore delays reading challenges to widen race windows in tests.
+type slowChallengeStore struct {
+	store.Interface
+}
+
+func (s slowChallengeStore) Get(ctx context.Context, key string) ([]byte, error) {
+	result, err := s.Interface.Get(ctx, key)
+
+	if strings.HasPrefix(key, "challenge:") {
+		//nosleep:bypass widens the window between reading and spending a challenge.
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return result, err
+}
+
+// downStore is a storage backend that can't be reached.
+type downStore struct{}
+
+var errStoreDown = errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+
+func (downStore) Get(context.Context, string) ([]byte, error) { return nil, errStoreDown }
+func (downStore) Set(context.Context, string, []byte, time.Duration) error {
+	return errStoreDown
+}
+func (downStore) Delete(context.Context, string) error { return errStoreDown }
+func (downStore) IsPersistent() bool                   { return true }
+
+func TestStoreUnavailable(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: generic-browser
+    user_agent_regex: Mozilla
+    action: CHALLENGE
+
+upstream_headers:
+  include:
+    - weight
+`
+
+	for _, tt := range []struct {
+		mode  degraded.Mode
+		want  int
+		event string
+	}{
+		{mode: degraded.ModeOpen, want: http.StatusOK, event: "allow"},
+		{mode: degraded.ModeDeny, want: http.StatusServiceUnavailable, event: "deny"},
+	} {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ds := degraded.New(t.Context(), downStore{}, degraded.Config{Mode: tt.mode, FailureThreshold: 1, ProbeInterval: "1h"})
+			if err := ds.Set(t.Context(), "challenge:1", []byte("{}"), time.Minute); err == nil {
+				t.Fatal("wanted the backend to fail")
+			}
+			if !ds.Unavailable() {
+				t.Fatal("backend is not unavailable")
+			}
+			pol.Store = ds
+
+			var weight string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				weight = r.Header.Get("X-Anubis-Weight")
+				fmt.Fprintln(w, "upstream") //nolint:errcheck
+			})
+
+			hr := newHookRecorder()
+			srv := spawnAnubis(t, Options{
+				Next:   next,
+				Policy: pol,
+				Hooks:  hr.hooks(),
+			})
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-Ip", "198.51.100.1")
+			req.Header.Set("User-Agent", "Mozilla/5.0")
+			req.Header.Set("Accept-Encoding", "gzip")
+
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("wanted %d, got: %d", tt.want, rec.Code)
+			}
+
+			if tt.mode == degraded.ModeOpen && !strings.Contains(rec.Body.String(), "upstream") {
+				t.Errorf("request was not sent upstream: %q", rec.Body.String())
+			}
+
+			if tt.mode == degraded.ModeOpen && weight == "" {
+				t.Error("decision headers were not forwarded upstream")
+			}
+
+			if tt.mode == degraded.ModeDeny && rec.Header().Get("Retry-After") == "" {
+				t.Error("503 response has no Retry-After header")
+			}
+
+			hr.expect(t, tt.event)
+		})
+	}
+}
+
+// challengeRecordStore fails the test if challenges are read from or written
+// to it.
+type challengeRecordStore struct {
+	store.Interface
+	t *testing.T
+}
+
+func (s challengeRecordStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if strings.HasPrefix(key, "challenge:") {
+		s.t.Errorf("stateless challenge was read from the store: %s", key)
+	}
+	return s.Interface.Get(ctx, key)
+}
+
+func (s challengeRecordStore) Set(ctx context.Context, key string, value []byte, expiry time.Duration) error {
+	if strings.HasPrefix(key, "challenge:") {
+		s.t.Errorf("stateless challenge was written to the store: %s", key)
+	}
+	return s.Interface.Set(ctx, key, value, expiry)
+}
+
+func TestStatelessChallenges(t *testing.T) {
+	const policyYAML = `
+bots:
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+    challenge:
+      algorithm: fast
+      difficulty: 1
+
+challenges:
+  stateless: true
+`
+
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every replica shares the signing key and the spent set, but nothing
+	// else.
+	spent := challengeRecordStore{Interface: memory.New(t.Context()), t: t}
+
+	replica := func(priv ed25519.PrivateKey) *Server {
+		pol, err := policy.ParseConfig(t.Context(), strings.NewReader(policyYAML), "inline.yaml", 0, "info", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pol.Store = spent
+
+		return spawnAnubis(t, Options{
+			Next:              http.NewServeMux(),
+			Policy:            pol,
+			ED25519PrivateKey: priv,
+			CookieExpiration:  time.Hour,
+		})
+	}
+
+	issuer, solver := replica(priv), replica(priv)
+
+	apiCall := func(srv *Server, endpoint string, body any) *httptest.ResponseRecorder {
+		buf, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, anubis.APIPrefix+endpoint, bytes.NewReader(buf))
+		req.Header.Set("X-Real-Ip", "198.51.100.7")
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	var chall challengeAPIResponse
+	if err := json.NewDecoder(apiCall(issuer, "v1/challenge", map[string]string{"redir": "/"}).Body).Decode(&chall); err != nil {
+		t.Fatal(err)
+	}
+
+	nonce, response, err := client.Solve(t.Context(), chall.Challenge, chall.Rules.Difficulty)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	solve := func(srv *Server, id string) int {
+		return apiCall(srv, "v1/solve", map[string]any{
+			"id":    id,
+			"redir": "/",
+			"solution": map[string]string{
+				"nonce":       strconv.Itoa(nonce),
+				"response":    response,
+				"elapsedTime": "100",
+			},
+		}).Code
+	}
+
+	// A replica with other keys can't read the challenge.
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := solve(replica(otherPriv), chall.ID); code != http.StatusNotFound {
+		t.Errorf("replica with other keys: wanted %d, got: %d", http.StatusNotFound, code)
+	}
+
+	// Swapping in another UUID breaks the seal.
+	uuid, sealed, _ := strings.Cut(chall.ID, ".")
+	forged := strings.Replace(uuid, uuid[:8], "00000000", 1) + "." + sealed
+	if code := solve(solver, forged); code != http.StatusNotFound {
+		t.Errorf("forged challenge: wanted %d, got: %d", http.StatusNotFound, code)
+	}
+
+	if code := solve(solver, chall.ID); code != http.StatusOK {
+		t.Fatalf("wanted another replica to accept the solution, got: %d", code)
+	}
+
+	if code := solve(issuer, chall.ID); code != http.StatusConflict {
+		t.Errorf("replayed solution: wanted %d, got: %d", http.StatusConflict, code)
+	}
+
+	if _, err := spent.Get(t.Context(), "challenge-spent:"+uuid); err != nil {
+		t.Errorf("solved challenge is not in the spent set: %v", err)
+	}
+}
+
+func TestTokenRevokedStoreDown(t *testing.T) {
+	claims := jwt.MapClaims{"challenge": "01997e6e-8f3e-7b2a-9a2e-2f0f7f6c1b2d", "iat": time.Now().Unix()}
+
+	for _, failClosed := range []bool{false, true} {
+		t.Run(fmt.Sprint("failClosed=", failClosed), func(t *testing.T) {
+			var buf bytes.Buffer
+			lg := slog.New(slog.NewTextHandler(&buf, nil))
+
+			srv := &Server{
+				opts:        Options{RevocationFailClosed: failClosed},
+				revocations: revocation.New(downStore{}, time.Hour),
+			}
+
+			for range 10 {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				if got := srv.tokenRevoked(req, lg, claims); got != failClosed {
+					t.Fatalf("wanted the token to be revoked: %v, got: %v", failClosed, got)
+				}
+			}
+
+			if n := strings.Count(buf.String(), "can't check if token was revoked"); n != 1 {
+				t.Errorf("wanted the store error to be logged once, got %d times", n)
+			}
+		})
+	}
+}
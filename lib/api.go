@@ -0,0 +1,276 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/challenge"
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/localization"
+	"github.com/TecharoHQ/anubis/lib/store"
+)
+
+// maxAPIRequestSize is the largest request body the JSON challenge API reads.
+const maxAPIRequestSize = 64 * 1024
+
+// challengeAPIRequest asks for a challenge for the page at Redir.
+type challengeAPIRequest struct {
+	Redir string `json:"redir"`
+}
+
+// challengeAPIResponse tells a client what it has to do to access the page it
+// asked about. Challenge details are only set when Action is CHALLENGE.
+type challengeAPIResponse struct {
+	Action    config.Rule            `json:"action"`
+	ID        string                 `json:"id,omitempty"`
+	Method    string                 `json:"method,omitempty"`
+	Challenge string                 `json:"challenge,omitempty"`
+	Rules     *config.ChallengeRules `json:"rules,omitempty"`
+}
+
+// solveAPIRequest submits the solution to a challenge. Solution holds the
+// same fields the challenge method reads from the pass-challenge form, such
+// as nonce, response and elapsedTime for proof of work.
+type solveAPIRequest struct {
+	ID       string            `json:"id"`
+	Redir    string            `json:"redir"`
+	Solution map[string]string `json:"solution"`
+}
+
+// solveAPIResponse holds the signed token a client presents in the cookie
+// named CookieName to access pages.
+type solveAPIResponse struct {
+	Token      string    `json:"token"`
+	CookieName string    `json:"cookie_name"`
+	Expires    time.Time `json:"expires"`
+}
+
+// apiError is the body of every error response from the JSON challenge API.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) respondWithJSON(w http.ResponseWriter, r *http.Request, lg *slog.Logger, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		lg.DebugContext(r.Context(), "can't write API response to client, did they disconnect?", "err", err)
+	}
+}
+
+func (s *Server) respondWithAPIError(w http.ResponseWriter, r *http.Request, lg *slog.Logger, status int, msg string) {
+	s.respondWithJSON(w, r, lg, status, apiError{Error: msg})
+}
+
+// decodeAPIRequest reads the JSON body of r into dst and makes r refer to the
+// page in redir so that path based rules match it.
+func decodeAPIRequest[T any](w http.ResponseWriter, r *http.Request, dst *T, redir func(*T) string) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return fmt.Errorf("%w: %w", challenge.ErrInvalidFormat, err)
+	}
+
+	// Only pages on this host can be asked about, so redir has to be a path.
+	u, err := url.ParseRequestURI(redir(dst))
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, "/") {
+		return fmt.Errorf("%w: redir must be an absolute path", challenge.ErrInvalidFormat)
+	}
+
+	r.URL = u
+	return nil
+}
+
+// ChallengeAPI issues a challenge for the page a non-browser client asked
+// about. Clients that don't need a challenge are told so without one being
+// issued.
+func (s *Server) ChallengeAPI(w http.ResponseWriter, r *http.Request) {
+	lg, r := s.getRequestLogger(r)
+	localizer := localization.GetLocalizer(r)
+
+	var req challengeAPIRequest
+	if err := decodeAPIRequest(w, r, &req, func(req *challengeAPIRequest) string { return req.Redir }); err != nil {
+		lg.DebugContext(r.Context(), "invalid challenge API request", "err", err)
+		s.respondWithAPIError(w, r, lg, http.StatusBadRequest, localizer.T("invalid_invocation"))
+		return
+	}
+
+	cr, rule, err := s.check(r, lg)
+	if err != nil {
+		lg.ErrorContext(r.Context(), "check failed", "err", err)
+		s.respondWithAPIError(w, r, lg, http.StatusInternalServerError, fmt.Sprintf("%s \"challengeAPI\"", localizer.T("internal_server_error")))
+		return
+	}
+	lg = lg.With("check_result", cr)
+
+	switch cr.Rule {
+	case config.RuleAllow:
+		s.respondWithJSON(w, r, lg, http.StatusOK, challengeAPIResponse{Action: cr.Rule})
+		return
+	case config.RuleDeny:
+		s.hooks.deny(r, cr, rule)
+		s.respondWithAPIError(w, r, lg, http.StatusForbidden, fmt.Sprintf("%s %s", localizer.T("access_denied"), rule.Hash()))
+		return
+	}
+
+	chall, err := s.issueChallenge(r.Context(), r, lg, cr, rule)
+	if errors.Is(err, ErrTooManyChallenges) {
+		lg.WarnContext(r.Context(), "client has too many outstanding challenges")
+		s.respondWithAPIError(w, r, lg, http.StatusTooManyRequests, localizer.T("too_many_challenges"))
+		return
+	}
+	if err != nil {
+		lg.ErrorContext(r.Context(), "failed to fetch or issue challenge", "err", err)
+		s.respondWithAPIError(w, r, lg, http.StatusInternalServerError, fmt.Sprintf("%s \"challengeAPI\"", localizer.T("internal_server_error")))
+		return
+	}
+
+	rule = ruleForChallenge(rule, chall)
+	{
+		asn, asnDesc := asnFromContext(r.Context())
+		challengesIssued.WithLabelValues("api", asn, asnDesc).Inc()
+	}
+
+	s.respondWithJSON(w, r, lg, http.StatusOK, challengeAPIResponse{
+		Action:    config.RuleChallenge,
+		ID:        chall.ID,
+		Method:    chall.Method,
+		Challenge: chall.RandomData,
+		Rules:     rule.Challenge,
+	})
+}
+
+// SolveAPI validates the solution to a challenge issued by ChallengeAPI and
+// returns the signed token for it. The token is also set as a cookie.
+func (s *Server) SolveAPI(w http.ResponseWriter, r *http.Request) {
+	lg, r := s.getRequestLogger(r)
+	localizer := localization.GetLocalizer(r)
+
+	var req solveAPIRequest
+	if err := decodeAPIRequest(w, r, &req, func(req *solveAPIRequest) string { return req.Redir }); err != nil {
+		lg.DebugContext(r.Context(), "invalid solve API request", "err", err)
+		s.respondWithAPIError(w, r, lg, http.StatusBadRequest, localizer.T("invalid_invocation"))
+		return
+	}
+
+	// Challenge methods read their inputs as form values.
+	form := url.Values{}
+	for k, v := range req.Solution {
+		form.Set(k, v)
+	}
+	form.Set("id", req.ID)
+	form.Set("redir", req.Redir)
+	r.Form = form
+	r.PostForm = url.Values{}
+
+	cr, rule, err := s.check(r, lg)
+	if err != nil {
+		lg.ErrorContext(r.Context(), "check failed", "err", err)
+		s.respondWithAPIError(w, r, lg, http.StatusInternalServerError, fmt.Sprintf("%s \"solveAPI\"", localizer.T("internal_server_error")))
+		return
+	}
+	lg = lg.With("check_result", cr)
+
+	chall, err := s.getChallenge(r)
+	if errors.Is(err, store.ErrNotFound) {
+		lg.DebugContext(r.Context(), "unknown challenge", "id", req.ID)
+		s.respondWithAPIError(w, r, lg, http.StatusNotFound, localizer.T("invalid_invocation"))
+		return
+	}
+	if err != nil {
+		lg.ErrorContext(r.Context(), "getChallenge failed", "err", err)
+		s.respondWithAPIError(w, r, lg, http.StatusInternalServerError, fmt.Sprintf("%s \"solveAPI\"", localizer.T("internal_server_error")))
+		return
+	}
+
+	if chall.Spent {
+		lg.ErrorContext(r.Context(), "double spend prevented", "reason", "double_spend")
+		s.respondWithAPIError(w, r, lg, http.StatusConflict, fmt.Sprintf("%s: %s", localizer.T("internal_server_error"), "double_spend"))
+		return
+	}
+
+	rule = s.hydrateChallengeRule(rule, chall, lg)
+	lg = lg.With("challenge", challengeID(chall.ID))
+
+	impl, ok := s.challengeImpl(chall.Method)
+	if !ok {
+		lg.ErrorContext(r.Context(), "challenge method is not registered", "method", chall.Method)
+		s.respondWithAPIError(w, r, lg, http.StatusInternalServerError, fmt.Sprintf("%s: %s", localizer.T("internal_server_error"), chall.Method))
+		return
+	}
+
+	if err := s.validateSolution(r, lg, cr, rule, chall, impl); err != nil {
+		lg.DebugContext(r.Context(), "challenge validate call failed", "err", err)
+
+		status := http.StatusForbidden
+		msg := localizer.T("invalid_invocation")
+		var cerr *challenge.Error
+		if errors.As(err, &cerr) {
+			status, msg = cerr.StatusCode, cerr.PublicReason
+		}
+
+		if errors.Is(err, challenge.ErrInvalidFormat) || errors.Is(err, challenge.ErrMissingField) {
+			status = http.StatusBadRequest
+		}
+		if errors.Is(err, challenge.ErrBusy) {
+			w.Header().Set("Retry-After", "5")
+		}
+
+		s.respondWithAPIError(w, r, lg, status, msg)
+		return
+	}
+
+	// From here on a stateless challenge is known by its UUID alone.
+	chall.ID = challengeID(chall.ID)
+
+	if claimed, err := s.claimChallenge(r.Context(), chall); err != nil {
+		lg.ErrorContext(r.Context(), "can't claim challenge", "err", err)
+		s.respondWithAPIError(w, r, lg, http.StatusInternalServerError, fmt.Sprintf("%s \"solveAPI\"", localizer.T("internal_server_error")))
+		return
+	} else if !claimed {
+		lg.ErrorContext(r.Context(), "double spend prevented", "reason", "double_spend")
+		s.respondWithAPIError(w, r, lg, http.StatusConflict, fmt.Sprintf("%s: %s", localizer.T("internal_server_error"), "double_spend"))
+		return
+	}
+
+	token, err := s.signChallengeToken(r, cr, rule, chall)
+	if err != nil {
+		lg.ErrorContext(r.Context(), "failed to sign JWT", "err", err)
+		s.respondWithAPIError(w, r, lg, http.StatusInternalServerError, localizer.T("failed_to_sign_jwt"))
+		return
+	}
+
+	cookiePath := "/"
+	if s.opts.BasePrefix != "" {
+		cookiePath = strings.TrimSuffix(s.opts.BasePrefix, "/") + "/"
+	}
+	s.SetCookie(w, CookieOpts{Path: cookiePath, Host: r.Host, Value: token})
+	s.markChallengeSolved(r, lg, cr, rule, chall)
+	lg.DebugContext(r.Context(), "challenge passed through the API")
+
+	s.respondWithJSON(w, r, lg, http.StatusOK, solveAPIResponse{
+		Token:      token,
+		CookieName: s.cookieName(s.opts.CookieName),
+		Expires:    time.Now().Add(s.opts.CookieExpiration),
+	})
+}
+
+// ServeJWKS publishes the public keys tokens are signed with, so that
+// upstreams can verify Anubis tokens without sharing its private key.
+func (s *Server) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	// Keep this short so that rotated keys are picked up quickly.
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if err := json.NewEncoder(w).Encode(s.keyring.JWKS()); err != nil {
+		s.logger.DebugContext(r.Context(), "can't write JWKS to client, did they disconnect?", "err", err)
+	}
+}
@@ -0,0 +1,61 @@
+package challenge
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/lib/config"
+)
+
+var ErrBindingMismatch = errors.New("challenge: challenge was issued to a different client")
+
+// CheckBinding makes sure that r comes from the same client that chall was
+// issued to, as far as each of the bindings can tell. This stops a challenge
+// that was solved on one machine from being redeemed on another.
+func CheckBinding(r *http.Request, chall *Challenge, bindings []config.ChallengeBinding) error {
+	for _, binding := range bindings {
+		var issued, got string
+
+		switch binding {
+		case config.BindingIP:
+			issued, got = chall.Metadata["X-Real-Ip"], r.Header.Get("X-Real-Ip")
+		case config.BindingNetwork:
+			issued, got = clampedNetwork(chall.Metadata["X-Real-Ip"]), clampedNetwork(r.Header.Get("X-Real-Ip"))
+		case config.BindingUserAgent:
+			issued, got = chall.Metadata["User-Agent"], r.Header.Get("User-Agent")
+		case config.BindingJA4H:
+			issued, got = chall.Metadata[internal.JA4HHeaderName], r.Header.Get(internal.JA4HHeaderName)
+		default:
+			// Validated when the policy is loaded.
+			continue
+		}
+
+		if issued == got {
+			continue
+		}
+
+		BindingMismatches.WithLabelValues(string(binding)).Inc()
+		return NewError("validate", "challenge was issued to a different client", fmt.Errorf("%w: %w: %s: issued to %q, solved by %q", ErrFailed, ErrBindingMismatch, binding, issued, got))
+	}
+
+	return nil
+}
+
+// clampedNetwork returns the network that ip is in. Addresses that can't be
+// parsed are returned as-is so that they only match themselves.
+func clampedNetwork(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+
+	prefix, ok := internal.ClampIP(addr)
+	if !ok {
+		return ip
+	}
+
+	return prefix.String()
+}
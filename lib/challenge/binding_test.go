@@ -0,0 +1,94 @@
+package challenge
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/lib/config"
+)
+
+func TestCheckBinding(t *testing.T) {
+	chall := &Challenge{
+		ID: "foo",
+		Metadata: map[string]string{
+			"User-Agent":            "Mozilla/5.0",
+			"X-Real-Ip":             "198.51.100.1",
+			internal.JA4HHeaderName: "ge11nn050000_4740ae6347b0_000000000000_000000000000",
+		},
+	}
+
+	for _, tt := range []struct {
+		name     string
+		bindings []config.ChallengeBinding
+		ip       string
+		ua       string
+		ja4h     string
+		err      error
+	}{
+		{
+			name: "no bindings",
+			ip:   "203.0.113.1",
+			ua:   "curl/8.0",
+		},
+		{
+			name:     "same client",
+			bindings: []config.ChallengeBinding{config.BindingIP, config.BindingNetwork, config.BindingUserAgent, config.BindingJA4H},
+			ip:       "198.51.100.1",
+			ua:       "Mozilla/5.0",
+			ja4h:     "ge11nn050000_4740ae6347b0_000000000000_000000000000",
+		},
+		{
+			name:     "different ip",
+			bindings: []config.ChallengeBinding{config.BindingIP},
+			ip:       "198.51.100.2",
+			err:      ErrBindingMismatch,
+		},
+		{
+			name:     "same network",
+			bindings: []config.ChallengeBinding{config.BindingNetwork},
+			ip:       "198.51.100.2",
+		},
+		{
+			name:     "different network",
+			bindings: []config.ChallengeBinding{config.BindingNetwork},
+			ip:       "198.51.101.1",
+			err:      ErrBindingMismatch,
+		},
+		{
+			name:     "different user agent",
+			bindings: []config.ChallengeBinding{config.BindingUserAgent},
+			ua:       "curl/8.0",
+			err:      ErrBindingMismatch,
+		},
+		{
+			name:     "different ja4h",
+			bindings: []config.ChallengeBinding{config.BindingJA4H},
+			ja4h:     "ge11nn010000_000000000000_000000000000_000000000000",
+			err:      ErrBindingMismatch,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Real-Ip", tt.ip)
+			req.Header.Set("User-Agent", tt.ua)
+			req.Header.Set(internal.JA4HHeaderName, tt.ja4h)
+
+			err := CheckBinding(req, chall, tt.bindings)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("wanted error %v, got: %v", tt.err, err)
+			}
+
+			if err == nil {
+				return
+			}
+
+			var cerr *Error
+			if !errors.As(err, &cerr) || !errors.Is(err, ErrFailed) {
+				t.Errorf("binding mismatches must be a *Error wrapping ErrFailed, got: %v", err)
+			}
+		})
+	}
+}
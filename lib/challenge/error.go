@@ -11,6 +11,7 @@ var (
 	ErrMissingField  = errors.New("challenge: missing field")
 	ErrInvalidFormat = errors.New("challenge: field has invalid format")
 	ErrInvalidInput  = errors.New("challenge: input is nil or missing required fields")
+	ErrBusy          = errors.New("challenge: server is too busy to validate the challenge")
 )
 
 func NewError(verb, publicReason string, privateReason error) *Error {
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/TecharoHQ/anubis/lib/config"
 	"github.com/TecharoHQ/anubis/lib/policy"
@@ -49,6 +50,18 @@ type IssueInput struct {
 	Challenge *Challenge
 	OGTags    map[string]string
 	Store     store.Interface
+
+	// BasePrefix is the prefix the issuing server is mounted under, without a
+	// trailing slash. Links to Anubis endpoints and assets must start with it.
+	BasePrefix string
+
+	// UseSimplifiedExplanation is set when the issuing server wants challenge
+	// pages to show the simplified "Why am I seeing this?" text.
+	UseSimplifiedExplanation bool
+
+	// ChallengeTTL is how long the challenge can be solved for. Anything kept
+	// for the challenge must be kept at least this long.
+	ChallengeTTL time.Duration
 }
 
 func (in *IssueInput) Valid() error {
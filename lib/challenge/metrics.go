@@ -12,3 +12,8 @@ var TimeTaken = promauto.NewHistogramVec(prometheus.HistogramOpts{
 	Help:    "The time taken for a browser to generate a response (milliseconds)",
 	Buckets: prometheus.ExponentialBucketsRange(1, math.Pow(2, 20), 20),
 }, []string{"method"})
+
+var BindingMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "anubis_challenge_binding_mismatches_total",
+	Help: "The number of challenge solutions rejected because they came from a different client than the challenge was issued to",
+}, []string{"binding"})
@@ -1,26 +1,48 @@
 package proofofwork
 
 import (
+	"context"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/TecharoHQ/anubis/internal"
 	chall "github.com/TecharoHQ/anubis/lib/challenge"
 	"github.com/TecharoHQ/anubis/lib/localization"
 	"github.com/a-h/templ"
+	"golang.org/x/sync/semaphore"
 )
 
+const (
+	// scryptMemoryBudget is how much memory, in KiB, all scrypt validations
+	// running at the same time may use. It fits 16 validations at the
+	// largest memory cost.
+	scryptMemoryBudget = 16 * 16384 // 256 MiB
+
+	// scryptBudgetWait is how long a validation waits for memory to become
+	// available before the client is asked to try again later.
+	scryptBudgetWait = 2 * time.Second
+)
+
+// scryptBudget bounds the memory used by scrypt validations. Clients choose
+// the response they send, so nothing short of computing the hash tells a
+// valid submission apart from a flood of fake ones.
+var scryptBudget = semaphore.NewWeighted(scryptMemoryBudget)
+
 //go:generate ./build.sh
 //go:generate go tool github.com/a-h/templ/cmd/templ generate
 
 func init() {
 	chall.Register("fast", &Impl{Algorithm: "fast"})
 	chall.Register("slow", &Impl{Algorithm: "slow"})
+	chall.Register("scrypt", &Impl{Algorithm: "scrypt"})
 }
 
 type Impl struct {
@@ -31,7 +53,7 @@ func (i *Impl) Setup(mux *http.ServeMux) {}
 
 func (i *Impl) Issue(w http.ResponseWriter, r *http.Request, lg *slog.Logger, in *chall.IssueInput) (templ.Component, error) {
 	loc := localization.GetLocalizer(r)
-	return page(loc), nil
+	return page(in.BasePrefix, in.UseSimplifiedExplanation, loc), nil
 }
 
 func (i *Impl) Validate(r *http.Request, lg *slog.Logger, in *chall.ValidateInput) error {
@@ -68,15 +90,37 @@ func (i *Impl) Validate(r *http.Request, lg *slog.Logger, in *chall.ValidateInpu
 		return chall.NewError("validate", "invalid response", fmt.Errorf("%w response", chall.ErrMissingField))
 	}
 
-	// Stream the challenge and nonce into a single sha256 hasher to avoid
-	// the intermediate "challenge + nonceStr" concatenation. Hex-encode
-	// the digest into a stack buffer so the comparison runs without
-	// allocating a heap string.
-	h := sha256.New()
-	h.Write([]byte(challenge))
-	h.Write([]byte(nonceStr))
 	var sumBuf [sha256.Size]byte
-	sum := h.Sum(sumBuf[:0])
+	var sum []byte
+	switch i.Algorithm {
+	case "scrypt":
+		// Skip the expensive work for responses that can't be valid. This
+		// doesn't stop an attacker sending zeros, the memory budget does.
+		if !strings.HasPrefix(response, strings.Repeat("0", rule.Challenge.Difficulty)) {
+			return chall.NewError("validate", "invalid response", fmt.Errorf("%w: wanted %d leading zeros but got %s", chall.ErrFailed, rule.Challenge.Difficulty, response))
+		}
+
+		memory, iterations := rule.Challenge.ScryptParams()
+		sum, err = scryptSum(r.Context(), challenge, nonceStr, memory, iterations)
+		if errors.Is(err, chall.ErrBusy) {
+			cerr := chall.NewError("validate", "server is busy, try again later", err)
+			cerr.StatusCode = http.StatusServiceUnavailable
+			return cerr
+		}
+		if err != nil {
+			return chall.NewError("validate", "internal error", fmt.Errorf("%w: can't compute scrypt hash: %w", chall.ErrFailed, err))
+		}
+	default:
+		// Stream the challenge and nonce into a single sha256 hasher to avoid
+		// the intermediate "challenge + nonceStr" concatenation.
+		h := sha256.New()
+		h.Write([]byte(challenge))
+		h.Write([]byte(nonceStr))
+		sum = h.Sum(sumBuf[:0])
+	}
+
+	// Hex-encode the digest into a stack buffer so the comparison runs
+	// without allocating a heap string.
 	var hexBuf [sha256.Size * 2]byte
 	hex.Encode(hexBuf[:], sum)
 
@@ -94,3 +138,17 @@ func (i *Impl) Validate(r *http.Request, lg *slog.Logger, in *chall.ValidateInpu
 
 	return nil
 }
+
+// scryptSum computes the scrypt hash once the memory it needs fits in
+// scryptBudget, waiting up to scryptBudgetWait for it.
+func scryptSum(ctx context.Context, challenge, nonce string, memoryKiB, iterations int) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, scryptBudgetWait)
+	defer cancel()
+
+	if err := scryptBudget.Acquire(ctx, int64(memoryKiB)); err != nil {
+		return nil, fmt.Errorf("%w: scrypt memory budget is exhausted: %w", chall.ErrBusy, err)
+	}
+	defer scryptBudget.Release(int64(memoryKiB))
+
+	return internal.ScryptSum(challenge, nonce, memoryKiB, iterations)
+}
@@ -204,3 +204,112 @@ func TestBasic(t *testing.T) {
 		})
 	}
 }
+
+func TestScrypt(t *testing.T) {
+	i := &Impl{Algorithm: "scrypt"}
+	const challengeStr = "hunter"
+
+	for _, cs := range []struct {
+		name  string
+		rules config.ChallengeRules
+		nonce string
+		resp  string
+		err   error
+	}{
+		{
+			name:  "allgood",
+			rules: config.ChallengeRules{Algorithm: "scrypt", Memory: 16, Iterations: 1},
+			nonce: "0",
+			resp:  "3a8970af64395799011cb6afbac4c42164c14e543b4a951d79355d81aa1c811a",
+		},
+		{
+			name:  "more-iterations",
+			rules: config.ChallengeRules{Algorithm: "scrypt", Memory: 16, Iterations: 2},
+			nonce: "0",
+			resp:  "3b10605eb59175785b27b04c2693d95df7a5d5919efe556ac5a3176d9c9a24bd",
+		},
+		{
+			name:  "defaults",
+			rules: config.ChallengeRules{Algorithm: "scrypt"},
+			nonce: "0",
+			resp:  "34894f8c493b7f8f2339f055f4e55d0e2cc208f0ff227131b1c6a47b31404d9f",
+		},
+		{
+			name:  "difficulty",
+			rules: config.ChallengeRules{Algorithm: "scrypt", Difficulty: 1, Memory: 16, Iterations: 1},
+			nonce: "10",
+			resp:  "0188babaa9bf2f8e9b20529857d0e3dad60fa3b165f6409bf1e111aa10ad4f6a",
+		},
+		{
+			name:  "not-enough-leading-zeros",
+			rules: config.ChallengeRules{Algorithm: "scrypt", Difficulty: 1, Memory: 16, Iterations: 1},
+			nonce: "0",
+			resp:  "3a8970af64395799011cb6afbac4c42164c14e543b4a951d79355d81aa1c811a",
+			err:   challenge.ErrFailed,
+		},
+		{
+			name:  "wrong-memory",
+			rules: config.ChallengeRules{Algorithm: "scrypt", Memory: 32, Iterations: 1},
+			nonce: "0",
+			resp:  "3a8970af64395799011cb6afbac4c42164c14e543b4a951d79355d81aa1c811a",
+			err:   challenge.ErrFailed,
+		},
+		{
+			name:  "sha256-response",
+			rules: config.ChallengeRules{Algorithm: "scrypt", Memory: 16, Iterations: 1},
+			nonce: "0",
+			resp:  "2652bdba8fb4d2ab39ef28d8534d7694c557a4ae146c1e9237bd8d950280500e",
+			err:   challenge.ErrFailed,
+		},
+	} {
+		t.Run(cs.name, func(t *testing.T) {
+			req := mkRequest(t, map[string]string{
+				"nonce":       cs.nonce,
+				"elapsedTime": "69",
+				"response":    cs.resp,
+			})
+
+			if err := i.Validate(req, slog.With(), &challenge.ValidateInput{
+				Rule:      &policy.Bot{Challenge: &cs.rules},
+				Challenge: &challenge.Challenge{RandomData: challengeStr},
+			}); !errors.Is(err, cs.err) {
+				t.Errorf("got wrong error from Validate, got %v but wanted %v", err, cs.err)
+			}
+		})
+	}
+}
+
+func TestScryptBudget(t *testing.T) {
+	i := &Impl{Algorithm: "scrypt"}
+
+	// Take up the whole budget, as a flood of submissions would.
+	if err := scryptBudget.Acquire(t.Context(), scryptMemoryBudget); err != nil {
+		t.Fatal(err)
+	}
+
+	req := mkRequest(t, map[string]string{
+		"nonce":       "0",
+		"elapsedTime": "69",
+		"response":    "3a8970af64395799011cb6afbac4c42164c14e543b4a951d79355d81aa1c811a",
+	})
+	in := &challenge.ValidateInput{
+		Rule:      &policy.Bot{Challenge: &config.ChallengeRules{Algorithm: "scrypt", Memory: 16, Iterations: 1}},
+		Challenge: &challenge.Challenge{RandomData: "hunter"},
+	}
+
+	err := i.Validate(req, slog.With(), in)
+	if !errors.Is(err, challenge.ErrBusy) {
+		t.Fatalf("wanted ErrBusy, got: %v", err)
+	}
+
+	var cerr *challenge.Error
+	if !errors.As(err, &cerr) || cerr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("wanted status %d, got: %v", http.StatusServiceUnavailable, err)
+	}
+
+	scryptBudget.Release(scryptMemoryBudget)
+
+	if err := i.Validate(req, slog.With(), in); err != nil {
+		t.Errorf("validation failed once memory was available: %v", err)
+	}
+}
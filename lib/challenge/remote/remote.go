@@ -0,0 +1,246 @@
+// Package remote implements challenge methods that are provided by external
+// gRPC services, so that new challenges can be written without changing Anubis.
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/a-h/templ"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/TecharoHQ/anubis"
+	"github.com/TecharoHQ/anubis/lib/challenge"
+	"github.com/TecharoHQ/anubis/lib/challenge/remote/remotev1"
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/policy"
+	"github.com/TecharoHQ/anubis/lib/store"
+)
+
+var (
+	ErrShadowsBuiltin = errors.New("remote: challenge plugin name is already used by a built-in challenge method")
+	ErrUnknownResult  = errors.New("remote: plugin returned an unknown validation result")
+)
+
+// defaultStateTTL is how long plugin state is kept when the issuing server
+// does not say how long its challenges last.
+const defaultStateTTL = 30 * time.Minute
+
+// defaultHeaders are the request headers every plugin gets. Other headers
+// may carry credentials, such as the Anubis cookie or the admin API token,
+// so they are only sent if the plugin configuration lists them.
+var defaultHeaders = []string{"Accept", "Accept-Language", "User-Agent"}
+
+// Impl is a challenge.Impl that forwards Issue and Validate calls to a
+// ChallengeService.
+type Impl struct {
+	name    string
+	client  remotev1.ChallengeServiceClient
+	conn    *grpc.ClientConn
+	timeout time.Duration
+	headers []string
+}
+
+// New connects to the plugin described by cfg. The connection is made lazily,
+// so a plugin that is down when Anubis starts does not stop it from starting.
+// Plugins can't replace built-in challenge methods. Close the Impl when it is
+// no longer used.
+func New(cfg config.ChallengePlugin) (*Impl, error) {
+	if _, ok := challenge.Get(cfg.Name); ok {
+		return nil, fmt.Errorf("%w: %q", ErrShadowsBuiltin, cfg.Name)
+	}
+
+	do := []grpc.DialOption{
+		grpc.WithUserAgent(fmt.Sprint("Techaro/anubis:", anubis.Version)),
+	}
+
+	if cfg.Plaintext {
+		do = append(do, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	} else {
+		do = append(do, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
+	}
+
+	conn, err := grpc.NewClient(cfg.Address, do...)
+	if err != nil {
+		return nil, fmt.Errorf("can't dial challenge plugin %s at %s: %w", cfg.Name, cfg.Address, err)
+	}
+
+	result := NewWithClient(cfg.Name, remotev1.NewChallengeServiceClient(conn), cfg.TimeoutDuration())
+	result.conn = conn
+	result.headers = append(result.headers, cfg.Headers...)
+
+	return result, nil
+}
+
+// NewWithClient creates an Impl that uses an existing client. It only sends
+// the default headers to the plugin.
+func NewWithClient(name string, client remotev1.ChallengeServiceClient, timeout time.Duration) *Impl {
+	return &Impl{
+		name:    name,
+		client:  client,
+		timeout: timeout,
+		headers: slices.Clone(defaultHeaders),
+	}
+}
+
+// Close closes the connection to the plugin if New made it.
+func (i *Impl) Close() error {
+	if i.conn == nil {
+		return nil
+	}
+
+	return i.conn.Close()
+}
+
+func (i *Impl) Setup(mux *http.ServeMux) {}
+
+func (i *Impl) Issue(w http.ResponseWriter, r *http.Request, lg *slog.Logger, in *challenge.IssueInput) (templ.Component, error) {
+	if err := in.Valid(); err != nil {
+		return nil, err
+	}
+
+	u, err := r.URL.Parse(in.BasePrefix + anubis.APIPrefix + "pass-challenge")
+	if err != nil {
+		return nil, fmt.Errorf("can't render page: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), i.timeout)
+	defer cancel()
+
+	resp, err := i.client.Issue(ctx, &remotev1.IssueRequest{
+		Request:          i.requestFor(r),
+		Challenge:        challengeFor(in.Challenge),
+		Rule:             ruleFor(in.Rule),
+		BasePrefix:       in.BasePrefix,
+		PassChallengeUrl: u.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("challenge plugin %s can't issue challenge: %w", i.name, err)
+	}
+
+	if len(resp.GetState()) != 0 {
+		if in.Store == nil {
+			return nil, fmt.Errorf("challenge plugin %s returned state but there is no store to keep it in", i.name)
+		}
+
+		ttl := in.ChallengeTTL
+		if ttl <= 0 {
+			ttl = defaultStateTTL
+		}
+
+		if err := in.Store.Set(r.Context(), i.stateKey(in.Challenge.ID), resp.GetState(), ttl); err != nil {
+			return nil, fmt.Errorf("can't store state for challenge plugin %s: %w", i.name, err)
+		}
+	}
+
+	return templ.Raw(resp.GetHtml()), nil
+}
+
+func (i *Impl) Validate(r *http.Request, lg *slog.Logger, in *challenge.ValidateInput) error {
+	if err := in.Valid(); err != nil {
+		return challenge.NewError("validate", "invalid input", err)
+	}
+
+	var state []byte
+	if in.Store != nil {
+		var err error
+		state, err = in.Store.Get(r.Context(), i.stateKey(in.Challenge.ID))
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return internalError(fmt.Errorf("can't load state for challenge plugin %s: %w", i.name, err))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), i.timeout)
+	defer cancel()
+
+	resp, err := i.client.Validate(ctx, &remotev1.ValidateRequest{
+		Request:   i.requestFor(r),
+		Challenge: challengeFor(in.Challenge),
+		Rule:      ruleFor(in.Rule),
+		State:     state,
+	})
+	if err != nil {
+		return internalError(fmt.Errorf("challenge plugin %s can't validate challenge: %w", i.name, err))
+	}
+
+	reason := errors.New(resp.GetPrivateReason())
+
+	switch resp.GetResult() {
+	case remotev1.Result_RESULT_PASSED:
+		if in.Store != nil && state != nil {
+			if err := in.Store.Delete(r.Context(), i.stateKey(in.Challenge.ID)); err != nil {
+				lg.DebugContext(r.Context(), "can't delete challenge plugin state", "err", err)
+			}
+		}
+		return nil
+	case remotev1.Result_RESULT_FAILED:
+		return challenge.NewError("validate", resp.GetPublicReason(), fmt.Errorf("%w: %w", challenge.ErrFailed, reason))
+	case remotev1.Result_RESULT_MISSING_FIELD:
+		return challenge.NewError("validate", resp.GetPublicReason(), fmt.Errorf("%w: %w", challenge.ErrMissingField, reason))
+	case remotev1.Result_RESULT_INVALID_FORMAT:
+		return challenge.NewError("validate", resp.GetPublicReason(), fmt.Errorf("%w: %w", challenge.ErrInvalidFormat, reason))
+	default:
+		return internalError(fmt.Errorf("%w from %s: %s", ErrUnknownResult, i.name, resp.GetResult()))
+	}
+}
+
+func (i *Impl) stateKey(id string) string {
+	return "challenge-plugin:" + i.name + ":" + id
+}
+
+// internalError makes sure that problems talking to the plugin never let the
+// client pass the challenge.
+func internalError(err error) error {
+	result := challenge.NewError("validate", "internal error", fmt.Errorf("%w: %w", challenge.ErrFailed, err))
+	result.StatusCode = http.StatusInternalServerError
+	return result
+}
+
+func (i *Impl) requestFor(r *http.Request) *remotev1.HTTPRequest {
+	headers := make(map[string]string, len(i.headers))
+	for _, name := range i.headers {
+		if v := r.Header.Values(name); len(v) != 0 {
+			headers[http.CanonicalHeaderKey(name)] = strings.Join(v, ", ")
+		}
+	}
+
+	return &remotev1.HTTPRequest{
+		Method:   r.Method,
+		Host:     r.Host,
+		Path:     r.URL.Path,
+		Query:    r.URL.RawQuery,
+		RemoteIp: r.Header.Get("X-Real-Ip"),
+		Headers:  headers,
+	}
+}
+
+func challengeFor(chall *challenge.Challenge) *remotev1.Challenge {
+	return &remotev1.Challenge{
+		Id:             chall.ID,
+		Method:         chall.Method,
+		RandomData:     chall.RandomData,
+		IssuedAt:       timestamppb.New(chall.IssuedAt),
+		Difficulty:     int32(chall.Difficulty),
+		PolicyRuleHash: chall.PolicyRuleHash,
+		Metadata:       chall.Metadata,
+	}
+}
+
+func ruleFor(rule *policy.Bot) *remotev1.Rule {
+	return &remotev1.Rule{
+		Name:       rule.Name,
+		Algorithm:  rule.Challenge.Algorithm,
+		Difficulty: int32(rule.Challenge.Difficulty),
+		Hash:       rule.Hash(),
+	}
+}
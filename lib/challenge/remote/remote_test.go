@@ -0,0 +1,259 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/TecharoHQ/anubis/lib/challenge"
+	"github.com/TecharoHQ/anubis/lib/challenge/remote/remotev1"
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/policy"
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/memory"
+)
+
+type fakePlugin struct {
+	remotev1.UnimplementedChallengeServiceServer
+}
+
+func (fakePlugin) Issue(_ context.Context, req *remotev1.IssueRequest) (*remotev1.IssueResponse, error) {
+	return &remotev1.IssueResponse{
+		Html:  `<form action="` + req.GetPassChallengeUrl() + `"><input name="answer"></form>`,
+		State: []byte("expected=" + req.GetChallenge().GetRandomData()),
+	}, nil
+}
+
+func (fakePlugin) Validate(_ context.Context, req *remotev1.ValidateRequest) (*remotev1.ValidateResponse, error) {
+	q, err := url.ParseQuery(req.GetRequest().GetQuery())
+	if err != nil {
+		return &remotev1.ValidateResponse{Result: remotev1.Result_RESULT_INVALID_FORMAT}, nil
+	}
+
+	answer := q.Get("answer")
+	switch {
+	case answer == "":
+		return &remotev1.ValidateResponse{Result: remotev1.Result_RESULT_MISSING_FIELD, PublicReason: "no answer"}, nil
+	case "expected="+answer != string(req.GetState()):
+		return &remotev1.ValidateResponse{Result: remotev1.Result_RESULT_FAILED, PublicReason: "wrong answer", PrivateReason: "answer does not match state"}, nil
+	default:
+		return &remotev1.ValidateResponse{Result: remotev1.Result_RESULT_PASSED}, nil
+	}
+}
+
+func startPlugin(t *testing.T) *Impl {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	remotev1.RegisterChallengeServiceServer(srv, fakePlugin{})
+	go srv.Serve(lis) //nolint:errcheck
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() }) //nolint:errcheck
+
+	return NewWithClient("test-plugin", remotev1.NewChallengeServiceClient(conn), 5*time.Second)
+}
+
+func TestIssueAndValidate(t *testing.T) {
+	impl := startPlugin(t)
+	st := memory.New(t.Context())
+	lg := slog.Default()
+
+	rule := &policy.Bot{
+		Name:      "test",
+		Challenge: &config.ChallengeRules{Algorithm: "test-plugin", Difficulty: 1},
+	}
+
+	chall := &challenge.Challenge{
+		ID:         "01234567-89ab-cdef-0123-456789abcdef",
+		Method:     "test-plugin",
+		RandomData: "hunter2",
+		IssuedAt:   time.Now(),
+	}
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+	component, err := impl.Issue(httptest.NewRecorder(), req, lg, &challenge.IssueInput{
+		Rule:       rule,
+		Challenge:  chall,
+		Store:      st,
+		BasePrefix: "/prefix",
+	})
+	if err != nil {
+		t.Fatalf("can't issue challenge: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := component.Render(t.Context(), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), `action="/prefix/.within.website/x/cmd/anubis/api/pass-challenge"`) {
+		t.Errorf("plugin HTML was not rendered as-is: %s", buf.String())
+	}
+
+	for _, tt := range []struct {
+		name   string
+		answer string
+		err    error
+	}{
+		{
+			name: "missing answer",
+			err:  challenge.ErrMissingField,
+		},
+		{
+			name:   "wrong answer",
+			answer: "hunter3",
+			err:    challenge.ErrFailed,
+		},
+		{
+			name:   "right answer",
+			answer: "hunter2",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			q := url.Values{}
+			if tt.answer != "" {
+				q.Set("answer", tt.answer)
+			}
+
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/?"+q.Encode(), nil)
+			err := impl.Validate(req, lg, &challenge.ValidateInput{
+				Rule:      rule,
+				Challenge: chall,
+				Store:     st,
+			})
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("wanted error %v, got: %v", tt.err, err)
+			}
+
+			var cerr *challenge.Error
+			if err != nil && !errors.As(err, &cerr) {
+				t.Errorf("validation errors must be *challenge.Error, got: %T", err)
+			}
+		})
+	}
+}
+
+func TestValidateUnreachablePluginFails(t *testing.T) {
+	impl, err := New(config.ChallengePlugin{
+		Name:      "unreachable",
+		Address:   "127.0.0.1:1",
+		Plaintext: true,
+		Timeout:   "250ms",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+	err = impl.Validate(req, slog.Default(), &challenge.ValidateInput{
+		Rule:      &policy.Bot{Challenge: &config.ChallengeRules{Algorithm: "unreachable"}},
+		Challenge: &challenge.Challenge{ID: "foo"},
+	})
+
+	if !errors.Is(err, challenge.ErrFailed) {
+		t.Errorf("an unreachable plugin must fail validation, got: %v", err)
+	}
+}
+
+type builtinImpl struct{ challenge.Impl }
+
+func TestNewCantShadowBuiltin(t *testing.T) {
+	challenge.Register("builtin-for-test", builtinImpl{})
+
+	if _, err := New(config.ChallengePlugin{Name: "builtin-for-test", Address: "localhost:1", Plaintext: true}); !errors.Is(err, ErrShadowsBuiltin) {
+		t.Errorf("wanted %v, got: %v", ErrShadowsBuiltin, err)
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	impl, err := New(config.ChallengePlugin{
+		Name:      "headers",
+		Address:   "127.0.0.1:1",
+		Plaintext: true,
+		Headers:   []string{"x-account-id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { impl.Close() }) //nolint:errcheck
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Header.Set("X-Account-Id", "1234")
+	req.Header.Set("Cookie", "techaro.lol-anubis-auth=secret")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Proxy-Authorization", "Basic secret")
+
+	got := impl.requestFor(req).GetHeaders()
+
+	if got["User-Agent"] != "Mozilla/5.0" || got["X-Account-Id"] != "1234" {
+		t.Errorf("default and configured headers were not sent: %v", got)
+	}
+
+	for _, name := range []string{"Cookie", "Authorization", "Proxy-Authorization"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("%s was sent to the plugin", name)
+		}
+	}
+}
+
+func TestStateTTL(t *testing.T) {
+	impl := startPlugin(t)
+	st := memory.New(t.Context())
+
+	chall := &challenge.Challenge{
+		ID:         "01234567-89ab-cdef-0123-456789abcdef",
+		Method:     "test-plugin",
+		RandomData: "hunter2",
+	}
+
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+	if _, err := impl.Issue(httptest.NewRecorder(), req, slog.Default(), &challenge.IssueInput{
+		Rule:         &policy.Bot{Challenge: &config.ChallengeRules{Algorithm: "test-plugin"}},
+		Challenge:    chall,
+		Store:        st,
+		ChallengeTTL: 2 * time.Hour,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	if err := store.List(t.Context(), st, impl.stateKey(chall.ID), func(e store.Entry) error {
+		found = true
+		if left := time.Until(e.Expires); left < time.Hour {
+			t.Errorf("state expires in %s, before the challenge does", left)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !found {
+		t.Fatal("plugin state was not stored")
+	}
+}
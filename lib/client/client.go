@@ -0,0 +1,309 @@
+// Package client lets Go programs access sites protected by Anubis without a
+// browser. It solves proof of work challenges through the JSON challenge API
+// and retries the original request with the token it gets back.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TecharoHQ/anubis"
+)
+
+// DefaultMaxDifficulty is the hardest challenge a Transport solves unless
+// told otherwise. Every step makes a challenge take about 16 times longer.
+const DefaultMaxDifficulty = 6
+
+var (
+	ErrUnsupportedMethod = errors.New("client: challenge method is not supported")
+	ErrTooDifficult      = errors.New("client: challenge is more difficult than allowed")
+	ErrDenied            = errors.New("client: access was denied")
+)
+
+// APIError is returned when the challenge API responds with an error.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("client: challenge API returned %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	if e.StatusCode == http.StatusForbidden {
+		return ErrDenied
+	}
+	return nil
+}
+
+// Transport is an http.RoundTripper that passes Anubis challenges. When a
+// response is an Anubis challenge page, Transport solves the challenge and
+// sends the request again with the resulting token. Tokens are reused for
+// later requests to the same host until they expire.
+//
+// Requests with a body are only retried if their GetBody is set, as it is
+// for requests made with http.NewRequest and a bytes, strings or similar
+// reader.
+type Transport struct {
+	// Base makes the actual requests. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// MaxDifficulty is the hardest challenge to try solving. If zero,
+	// DefaultMaxDifficulty is used.
+	MaxDifficulty int
+
+	mu     sync.Mutex
+	tokens map[string]token
+}
+
+type token struct {
+	cookie  string
+	value   string
+	expires time.Time
+}
+
+type challengeResponse struct {
+	Action    string `json:"action"`
+	ID        string `json:"id"`
+	Method    string `json:"method"`
+	Challenge string `json:"challenge"`
+	Rules     struct {
+		Difficulty int `json:"difficulty"`
+	} `json:"rules"`
+}
+
+type solveResponse struct {
+	Token      string    `json:"token"`
+	CookieName string    `json:"cookie_name"`
+	Expires    time.Time `json:"expires"`
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base().RoundTrip(t.withToken(req))
+	if err != nil {
+		return nil, err
+	}
+
+	apiPath := resp.Header.Get(anubis.ChallengeAPIHeader)
+	if apiPath == "" {
+		return resp, nil
+	}
+
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		// The body was already sent and can't be sent again.
+		return resp, nil
+	}
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20)) //nolint:errcheck
+	resp.Body.Close()
+
+	if err := t.pass(req, apiPath); err != nil {
+		return nil, err
+	}
+
+	retry := t.withToken(req)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+
+	return t.base().RoundTrip(retry)
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// withToken returns a copy of req carrying the token for its host, if there
+// is one. The copy is made either way, as a RoundTripper must not modify the
+// requests it is given. A cookie of the same name that the caller sent, such
+// as an expired token, is replaced.
+func (t *Transport) withToken(req *http.Request) *http.Request {
+	result := req.Clone(req.Context())
+
+	t.mu.Lock()
+	tok, ok := t.tokens[req.URL.Host]
+	t.mu.Unlock()
+
+	if !ok || time.Now().After(tok.expires) {
+		return result
+	}
+
+	cookies := result.Cookies()
+	result.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != tok.cookie {
+			result.AddCookie(c)
+		}
+	}
+
+	result.AddCookie(&http.Cookie{Name: tok.cookie, Value: tok.value})
+	return result
+}
+
+// pass solves a challenge for req through the API at apiPath and stores the
+// resulting token.
+func (t *Transport) pass(req *http.Request, apiPath string) error {
+	ctx := req.Context()
+	redir := req.URL.RequestURI()
+	challengeURL := req.URL.ResolveReference(&url.URL{Path: apiPath})
+	solveURL := req.URL.ResolveReference(&url.URL{Path: path.Join(path.Dir(apiPath), "solve")})
+
+	var chall challengeResponse
+	if err := t.call(ctx, req, challengeURL, map[string]any{"redir": redir}, &chall); err != nil {
+		return err
+	}
+
+	if chall.Action != "CHALLENGE" {
+		// Nothing to solve, the request is let through as it is.
+		return nil
+	}
+
+	maxDifficulty := t.MaxDifficulty
+	if maxDifficulty == 0 {
+		maxDifficulty = DefaultMaxDifficulty
+	}
+	if chall.Rules.Difficulty > maxDifficulty {
+		return fmt.Errorf("%w: %d > %d", ErrTooDifficult, chall.Rules.Difficulty, maxDifficulty)
+	}
+
+	switch chall.Method {
+	case "fast", "slow":
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedMethod, chall.Method)
+	}
+
+	start := time.Now()
+	nonce, response, err := Solve(ctx, chall.Challenge, chall.Rules.Difficulty)
+	if err != nil {
+		return err
+	}
+
+	var solved solveResponse
+	if err := t.call(ctx, req, solveURL, map[string]any{
+		"id":    chall.ID,
+		"redir": redir,
+		"solution": map[string]string{
+			"nonce":       strconv.Itoa(nonce),
+			"response":    response,
+			"elapsedTime": strconv.FormatInt(time.Since(start).Milliseconds(), 10),
+		},
+	}, &solved); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tokens == nil {
+		t.tokens = map[string]token{}
+	}
+	t.tokens[req.URL.Host] = token{
+		cookie:  solved.CookieName,
+		value:   solved.Token,
+		expires: solved.Expires,
+	}
+
+	return nil
+}
+
+// call posts body to the challenge API at u and decodes the response into
+// dst. It sends the headers of orig along so that the API sees the same
+// client as the page did.
+func (t *Transport) call(ctx context.Context, orig *http.Request, u *url.URL, body, dst any) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header = orig.Header.Clone()
+	req.Header.Del("Content-Length")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Host = orig.Host
+
+	resp, err := t.base().RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr) //nolint:errcheck
+		return &APIError{StatusCode: resp.StatusCode, Message: apiErr.Error}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		return fmt.Errorf("client: can't decode challenge API response: %w", err)
+	}
+
+	return nil
+}
+
+// Solve finds a nonce for a fast or slow proof of work challenge, such that
+// the hex encoded SHA-256 of the challenge followed by the nonce starts with
+// difficulty zeroes. It returns the nonce and that hash. Difficulties longer
+// than the hash can never be solved and are rejected with ErrTooDifficult.
+func Solve(ctx context.Context, challenge string, difficulty int) (int, string, error) {
+	if difficulty > 2*sha256.Size {
+		return 0, "", fmt.Errorf("%w: %d > %d", ErrTooDifficult, difficulty, 2*sha256.Size)
+	}
+
+	h := sha256.New()
+	var sum [sha256.Size]byte
+	buf := make([]byte, 0, len(challenge)+20)
+
+	for nonce := 0; ; nonce++ {
+		if nonce%4096 == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, "", err
+			}
+		}
+
+		buf = strconv.AppendInt(append(buf[:0], challenge...), int64(nonce), 10)
+		h.Reset()
+		h.Write(buf)
+		h.Sum(sum[:0])
+
+		if leadingZeroes(sum[:], difficulty) {
+			return nonce, hex.EncodeToString(sum[:]), nil
+		}
+	}
+}
+
+// leadingZeroes reports whether the hex encoding of sum starts with n zeroes.
+func leadingZeroes(sum []byte, n int) bool {
+	for i := 0; i < n/2; i++ {
+		if sum[i] != 0 {
+			return false
+		}
+	}
+
+	return n%2 == 0 || sum[n/2]>>4 == 0
+}
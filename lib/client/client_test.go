@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSolve(t *testing.T) {
+	for difficulty := range 5 {
+		t.Run(strconv.Itoa(difficulty), func(t *testing.T) {
+			nonce, response, err := Solve(t.Context(), "hunter2", difficulty)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sum := sha256.Sum256([]byte("hunter2" + strconv.Itoa(nonce)))
+			if want := hex.EncodeToString(sum[:]); response != want {
+				t.Errorf("wanted response %s, got: %s", want, response)
+			}
+
+			if !strings.HasPrefix(response, strings.Repeat("0", difficulty)) {
+				t.Errorf("response %s does not have %d leading zeroes", response, difficulty)
+			}
+		})
+	}
+}
+
+func TestSolveCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if _, _, err := Solve(ctx, "hunter2", 64); !errors.Is(err, context.Canceled) {
+		t.Errorf("wanted %v, got: %v", context.Canceled, err)
+	}
+}
+
+func TestSolveTooDifficult(t *testing.T) {
+	for _, difficulty := range []int{65, 1000} {
+		if _, _, err := Solve(t.Context(), "hunter2", difficulty); !errors.Is(err, ErrTooDifficult) {
+			t.Errorf("difficulty %d: wanted %v, got: %v", difficulty, ErrTooDifficult, err)
+		}
+	}
+}
+
+func TestLeadingZeroes(t *testing.T) {
+	for _, tt := range []struct {
+		sum  []byte
+		n    int
+		want bool
+	}{
+		{sum: []byte{0x00, 0x0f, 0xff}, n: 3, want: true},
+		{sum: []byte{0x00, 0x1f, 0xff}, n: 3, want: false},
+		{sum: []byte{0x00, 0x00, 0xff}, n: 4, want: true},
+		{sum: []byte{0x01, 0x00, 0xff}, n: 2, want: false},
+		{sum: []byte{0xff}, n: 0, want: true},
+	} {
+		if got := leadingZeroes(tt.sum, tt.n); got != tt.want {
+			t.Errorf("leadingZeroes(%x, %d) = %v, want %v", tt.sum, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestWithToken(t *testing.T) {
+	tr := &Transport{tokens: map[string]token{
+		"example.com": {cookie: "anubis-auth", value: "fresh", expires: time.Now().Add(time.Hour)},
+		"stale.com":   {cookie: "anubis-auth", value: "stale", expires: time.Now().Add(-time.Hour)},
+	}}
+
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	req.AddCookie(&http.Cookie{Name: "anubis-auth", Value: "old"})
+	req.AddCookie(&http.Cookie{Name: "session", Value: "hunter2"})
+
+	got := tr.withToken(req)
+	if got == req {
+		t.Fatal("withToken must not return the caller's request")
+	}
+
+	var values []string
+	for _, c := range got.Cookies() {
+		if c.Name == "anubis-auth" {
+			values = append(values, c.Value)
+		}
+	}
+	if len(values) != 1 || values[0] != "fresh" {
+		t.Errorf("wanted only the stored token, got: %v", values)
+	}
+	if c, err := got.Cookie("session"); err != nil || c.Value != "hunter2" {
+		t.Errorf("other cookies should be kept, got: %v, %v", c, err)
+	}
+	if c, _ := req.Cookie("anubis-auth"); c.Value != "old" || len(req.Cookies()) != 2 {
+		t.Errorf("the caller's request was modified: %v", req.Cookies())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "https://stale.com/", nil)
+	if got := tr.withToken(req); got == req {
+		t.Error("withToken must copy the request without a valid token too")
+	}
+}
@@ -1,10 +1,10 @@
 package lib
 
 import (
+	"cmp"
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
-	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -18,10 +18,12 @@ import (
 	"github.com/TecharoHQ/anubis/internal"
 	"github.com/TecharoHQ/anubis/internal/honeypot/naive"
 	"github.com/TecharoHQ/anubis/internal/ogtags"
-	"github.com/TecharoHQ/anubis/lib/challenge"
+	"github.com/TecharoHQ/anubis/lib/adaptive"
 	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/keyring"
 	"github.com/TecharoHQ/anubis/lib/localization"
 	"github.com/TecharoHQ/anubis/lib/policy"
+	"github.com/TecharoHQ/anubis/lib/revocation"
 	"github.com/TecharoHQ/anubis/web"
 	"github.com/TecharoHQ/anubis/xess"
 	"github.com/a-h/templ"
@@ -43,6 +45,7 @@ type Options struct {
 	RedirectDomains          []string
 	ED25519PrivateKey        ed25519.PrivateKey
 	HS512Secret              []byte
+	Keyring                  *keyring.Keyring
 	StripBasePrefix          bool
 	OpenGraph                config.OpenGraph
 	ServeRobotsTXT           bool
@@ -53,7 +56,30 @@ type Options struct {
 	LogLevel                 string
 	PublicUrl                string
 	JWTRestrictionHeader     string
+	JWTIssuer                string
+	JWTAudience              string
 	DifficultyInJWT          bool
+	CookieName               string
+	TestCookieName           string
+	ForcedLanguage           string
+	UseSimplifiedExplanation bool
+	Hooks                    Hooks
+
+	// CookieRenewAfter is the fraction of CookieExpiration after which a
+	// valid token is replaced with a fresh one. Zero disables renewal.
+	CookieRenewAfter float64
+
+	// CookieMaxLifetime limits how long renewed tokens stay valid after the
+	// challenge was solved. Zero means no limit.
+	CookieMaxLifetime time.Duration
+
+	// AdminToken enables the admin API for requests that present it as a
+	// bearer token.
+	AdminToken string
+
+	// RevocationFailClosed makes tokens count as revoked when the revocation
+	// list can't be read. By default they are accepted.
+	RevocationFailClosed bool
 }
 
 func LoadPoliciesOrDefault(ctx context.Context, fname string, defaultDifficulty int, logLevel string, subrequestMode bool) (*policy.ParsedConfig, error) {
@@ -84,19 +110,21 @@ func LoadPoliciesOrDefault(ctx context.Context, fname string, defaultDifficulty
 	if err != nil {
 		return nil, fmt.Errorf("can't parse policy file %s: %w", fname, err)
 	}
-	var validationErrs []error
-
-	for _, b := range anubisPolicy.Bots {
-		if _, ok := challenge.Get(b.Challenge.Algorithm); !ok {
-			validationErrs = append(validationErrs, fmt.Errorf("%w %s", policy.ErrChallengeRuleHasWrongAlgorithm, b.Challenge.Algorithm))
-		}
+	if err := checkChallengeMethods(anubisPolicy); err != nil {
+		return nil, fmt.Errorf("can't do final validation of Anubis config: %w", err)
 	}
 
-	if len(validationErrs) != 0 {
-		return nil, fmt.Errorf("can't do final validation of Anubis config: %w", errors.Join(validationErrs...))
+	return anubisPolicy, err
+}
+
+// newAdaptiveController returns nil if the policy does not enable adaptive
+// difficulty.
+func newAdaptiveController(pol *policy.ParsedConfig, lg *slog.Logger) *adaptive.Controller {
+	if pol.AdaptiveDifficulty == nil {
+		return nil
 	}
 
-	return anubisPolicy, err
+	return adaptive.New(*pol.AdaptiveDifficulty, lg.With("subsystem", "adaptive-difficulty"))
 }
 
 func New(opts Options) (*Server, error) {
@@ -104,35 +132,87 @@ func New(opts Options) (*Server, error) {
 		opts.Logger = slog.With("subsystem", "anubis")
 	}
 
-	if opts.ED25519PrivateKey == nil && opts.HS512Secret == nil {
-		opts.Logger.Debug("opts.PrivateKey not set, generating a new one")
-		_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if opts.Keyring == nil {
+		if opts.ED25519PrivateKey == nil && len(opts.HS512Secret) == 0 {
+			opts.Logger.Debug("opts.PrivateKey not set, generating a new one")
+			_, priv, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, fmt.Errorf("lib: can't generate private key: %v", err)
+			}
+			opts.ED25519PrivateKey = priv
+		}
+
+		var key *keyring.Key
+		if len(opts.HS512Secret) != 0 {
+			key = keyring.HS512Key(opts.HS512Secret)
+		} else {
+			key = keyring.Ed25519Key(opts.ED25519PrivateKey)
+		}
+
+		kr, err := keyring.New(key)
 		if err != nil {
-			return nil, fmt.Errorf("lib: can't generate private key: %v", err)
+			return nil, fmt.Errorf("lib: can't create keyring: %w", err)
 		}
-		opts.ED25519PrivateKey = priv
+		opts.Keyring = kr
+	}
+
+	if opts.CookieRenewAfter < 0 || opts.CookieRenewAfter >= 1 {
+		return nil, fmt.Errorf("lib: cookie renewal fraction must be at least 0 and less than 1, got: %v", opts.CookieRenewAfter)
+	}
+
+	opts.BasePrefix = strings.TrimRight(opts.BasePrefix, "/")
+
+	if opts.CookieName == "" {
+		opts.CookieName = anubis.CookieName
+	}
+
+	if opts.TestCookieName == "" {
+		opts.TestCookieName = anubis.TestCookieName
+	}
+
+	if opts.JWTIssuer == "" {
+		opts.JWTIssuer = anubis.JWTIssuer
 	}
 
-	anubis.BasePrefix = strings.TrimRight(opts.BasePrefix, "/")
-	anubis.PublicUrl = opts.PublicUrl
+	if err := checkChallengeMethods(opts.Policy); err != nil {
+		return nil, fmt.Errorf("lib: %w", err)
+	}
+
+	plugins, err := newChallengePlugins(opts.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("lib: can't set up challenge plugins: %w", err)
+	}
 
 	result := &Server{
-		next:        opts.Next,
-		ed25519Priv: opts.ED25519PrivateKey,
-		hs512Secret: opts.HS512Secret,
-		policy:      opts.Policy,
-		opts:        opts,
+		next:    opts.Next,
+		keyring: opts.Keyring,
+		policy:  opts.Policy,
+		opts:    opts,
+
+		challengePlugins: plugins,
 		OGTags: ogtags.NewOGTagCache(opts.Target, opts.Policy.OpenGraph, opts.Policy.Store, ogtags.TargetOptions{
 			Host:               opts.TargetHost,
 			SNI:                opts.TargetSNI,
 			InsecureSkipVerify: opts.TargetInsecureSkipVerify,
 		}),
-		store:  opts.Policy.Store,
-		logger: opts.Logger,
+		store:    opts.Policy.Store,
+		logger:   opts.Logger,
+		hooks:    newHookDispatcher(opts.Hooks, opts.Logger),
+		adaptive: newAdaptiveController(opts.Policy, opts.Logger),
+
+		revocations: revocation.New(opts.Policy.Store, cmp.Or(opts.CookieExpiration, anubis.CookieDefaultExpirationTime)),
+		settings: &anubis.Settings{
+			BasePrefix:               opts.BasePrefix,
+			PublicUrl:                opts.PublicUrl,
+			CookieName:               opts.CookieName,
+			TestCookieName:           opts.TestCookieName,
+			ForcedLanguage:           opts.ForcedLanguage,
+			UseSimplifiedExplanation: opts.UseSimplifiedExplanation,
+		},
 	}
 
 	mux := http.NewServeMux()
-	xess.Mount(mux)
+	xess.MountWithPrefix(mux, opts.BasePrefix)
 
 	// Helper to add global prefix
 	registerWithPrefix := func(pattern string, handler http.Handler, method string) {
@@ -141,7 +221,7 @@ func New(opts Options) (*Server, error) {
 		}
 
 		// Ensure there's no double slash when concatenating BasePrefix and pattern
-		basePrefix := strings.TrimSuffix(anubis.BasePrefix, "/")
+		basePrefix := strings.TrimSuffix(opts.BasePrefix, "/")
 		prefix := method + basePrefix
 
 		// If pattern doesn't start with a slash, add one
@@ -153,7 +233,7 @@ func New(opts Options) (*Server, error) {
 	}
 
 	// Ensure there's no double slash when concatenating BasePrefix and StaticPath
-	stripPrefix := strings.TrimSuffix(anubis.BasePrefix, "/") + anubis.StaticPath
+	stripPrefix := strings.TrimSuffix(opts.BasePrefix, "/") + anubis.StaticPath
 	registerWithPrefix(anubis.StaticPath, internal.UnchangingCache(internal.NoBrowsing(http.StripPrefix(stripPrefix, http.FileServerFS(web.Static)))), "")
 
 	if opts.ServeRobotsTXT {
@@ -175,6 +255,15 @@ func New(opts Options) (*Server, error) {
 
 	registerWithPrefix(anubis.APIPrefix+"pass-challenge", http.HandlerFunc(result.PassChallenge), "GET")
 	registerWithPrefix(anubis.APIPrefix+"check", http.HandlerFunc(result.maybeReverseProxyHttpStatusOnly), "")
+	registerWithPrefix(anubis.APIPrefix+"v1/challenge", http.HandlerFunc(result.ChallengeAPI), "POST")
+	registerWithPrefix(anubis.APIPrefix+"v1/solve", http.HandlerFunc(result.SolveAPI), "POST")
+	registerWithPrefix(anubis.JWKSPath, http.HandlerFunc(result.ServeJWKS), "GET")
+
+	if opts.AdminToken != "" {
+		revocations := result.requireAdmin(http.HandlerFunc(result.RevocationsAPI))
+		registerWithPrefix(anubis.APIPrefix+"admin/revocations", revocations, "POST")
+		registerWithPrefix(anubis.APIPrefix+"admin/revocations", revocations, "DELETE")
+	}
 	registerWithPrefix("/", http.HandlerFunc(result.maybeReverseProxyOrPage), "")
 
 	if opts.Policy.Honeypot != nil && opts.Policy.Honeypot.Enabled {
@@ -204,8 +293,8 @@ func New(opts Options) (*Server, error) {
 		registerWithPrefix(anubis.APIPrefix+"make-challenge", http.HandlerFunc(result.MakeChallenge), "POST")
 	}
 
-	for _, implKind := range challenge.Methods() {
-		impl, _ := challenge.Get(implKind)
+	for _, implKind := range result.challengeMethods() {
+		impl, _ := result.challengeImpl(implKind)
 		impl.Setup(mux)
 	}
 
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrAdaptiveDifficultyBadBounds    = errors.New("config.AdaptiveDifficulty: min and max must be between 0 and 64 and min must not be more than max")
+	ErrAdaptiveDifficultyBadInterval  = errors.New("config.AdaptiveDifficulty: interval is invalid")
+	ErrAdaptiveDifficultyBadCooldown  = errors.New("config.AdaptiveDifficulty: cooldown is invalid")
+	ErrAdaptiveDifficultyNoSignals    = errors.New("config.AdaptiveDifficulty: must set at least one of request_rate, load or issued_validated_ratio")
+	ErrAdaptiveDifficultyBadThreshold = errors.New("config.AdaptiveDifficulty: thresholds must not be negative")
+)
+
+// AdaptiveDifficulty raises the difficulty of issued challenges while Anubis
+// is under pressure and lowers it back to Min once things calm down.
+type AdaptiveDifficulty struct {
+	Min      int    `json:"min" yaml:"min"`
+	Max      int    `json:"max" yaml:"max"`
+	Interval string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Cooldown string `json:"cooldown,omitempty" yaml:"cooldown,omitempty"`
+
+	// Difficulty goes up one step for every interval where any of these are
+	// exceeded. Zero disables a signal.
+	RequestRate          float64 `json:"request_rate,omitempty" yaml:"request_rate,omitempty"`
+	Load                 float64 `json:"load,omitempty" yaml:"load,omitempty"`
+	IssuedValidatedRatio float64 `json:"issued_validated_ratio,omitempty" yaml:"issued_validated_ratio,omitempty"`
+}
+
+func (ad AdaptiveDifficulty) Valid() error {
+	var errs []error
+
+	if ad.Min < 0 || ad.Max > 64 || ad.Min > ad.Max {
+		errs = append(errs, fmt.Errorf("%w, got min %d and max %d", ErrAdaptiveDifficultyBadBounds, ad.Min, ad.Max))
+	}
+
+	if ad.Interval != "" {
+		if d, err := time.ParseDuration(ad.Interval); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrAdaptiveDifficultyBadInterval, ad.Interval))
+		}
+	}
+
+	if ad.Cooldown != "" {
+		if d, err := time.ParseDuration(ad.Cooldown); err != nil || d < 0 {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrAdaptiveDifficultyBadCooldown, ad.Cooldown))
+		}
+	}
+
+	if ad.RequestRate < 0 || ad.Load < 0 || ad.IssuedValidatedRatio < 0 {
+		errs = append(errs, ErrAdaptiveDifficultyBadThreshold)
+	}
+
+	if ad.RequestRate == 0 && ad.Load == 0 && ad.IssuedValidatedRatio == 0 {
+		errs = append(errs, ErrAdaptiveDifficultyNoSignals)
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("config: adaptive difficulty is not valid:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// IntervalDuration returns how often the pressure signals are sampled.
+func (ad AdaptiveDifficulty) IntervalDuration() time.Duration {
+	if d, err := time.ParseDuration(ad.Interval); err == nil && d > 0 {
+		return d
+	}
+
+	return 15 * time.Second
+}
+
+// CooldownDuration returns how long there must be no pressure before the
+// difficulty is lowered by one step.
+func (ad AdaptiveDifficulty) CooldownDuration() time.Duration {
+	if d, err := time.ParseDuration(ad.Cooldown); err == nil && d >= 0 {
+		return d
+	}
+
+	return 5 * time.Minute
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrAPIKeyMustHaveName       = errors.New("config.APIKey: must set name")
+	ErrAPIKeyDuplicateName      = errors.New("config.APIKeys: duplicate key name")
+	ErrAPIKeyBadName            = errors.New("config.APIKey: name must not contain dots or whitespace")
+	ErrAPIKeyUnknownType        = errors.New("config.APIKey: type must be static or hmac")
+	ErrAPIKeyNeedsOneSource     = errors.New("config.APIKey: must set exactly one of hash, file or env")
+	ErrAPIKeyHMACNeedsSecret    = errors.New("config.APIKey: hmac keys must set exactly one of file or env and no hash")
+	ErrAPIKeyBadHash            = errors.New("config.APIKey: hash must be sha256: followed by 64 hex characters")
+	ErrAPIKeyBadExpires         = errors.New("config.APIKey: expires must be an RFC 3339 timestamp")
+	ErrAPIKeyBadAction          = errors.New("config.APIKey: action must be ALLOW or WEIGH")
+	ErrAPIKeyWeighNeedsWeight   = errors.New("config.APIKey: WEIGH keys must set weight")
+	ErrAPIKeyBadPath            = errors.New("config.APIKey: paths must start with /")
+	ErrAPIKeysBadHeader         = errors.New("config.APIKeys: header is not a valid HTTP header name")
+	ErrAPIKeysMustHaveKeys      = errors.New("config.APIKeys: must define at least one key")
+	ErrAPIKeysHeaderIsAuthorize = errors.New("config.APIKeys: Authorization is always checked, header must name a different header")
+)
+
+const (
+	APIKeyStatic = "static"
+	APIKeyHMAC   = "hmac"
+)
+
+// APIKeys lets automated clients that can't solve challenges skip them by
+// presenting a key, either as "Authorization: Bearer <key>" or in Header.
+type APIKeys struct {
+	Header string   `json:"header,omitempty" yaml:"header,omitempty"`
+	Keys   []APIKey `json:"keys" yaml:"keys"`
+}
+
+// APIKey is a single named key.
+//
+// Static keys are compared against Hash, or against the plain key read from
+// File or Env. HMAC keys read their secret from File or Env and accept tokens
+// of the form "<name>.<unix expiry>.<base64url HMAC-SHA256 signature>".
+type APIKey struct {
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+
+	Hash string `json:"hash,omitempty" yaml:"hash,omitempty"`
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+	Env  string `json:"env,omitempty" yaml:"env,omitempty"`
+
+	Expires string   `json:"expires,omitempty" yaml:"expires,omitempty"`
+	Paths   []string `json:"paths,omitempty" yaml:"paths,omitempty"`
+
+	Action Rule    `json:"action" yaml:"action"`
+	Weight *Weight `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+func (ak APIKeys) Valid() error {
+	var errs []error
+
+	if ak.Header != "" {
+		switch {
+		case strings.ContainsAny(ak.Header, " \t\r\n:"):
+			errs = append(errs, fmt.Errorf("%w: %q", ErrAPIKeysBadHeader, ak.Header))
+		case http.CanonicalHeaderKey(ak.Header) == "Authorization":
+			errs = append(errs, ErrAPIKeysHeaderIsAuthorize)
+		}
+	}
+
+	if len(ak.Keys) == 0 {
+		errs = append(errs, ErrAPIKeysMustHaveKeys)
+	}
+
+	names := map[string]bool{}
+	for i, k := range ak.Keys {
+		if err := k.Valid(); err != nil {
+			errs = append(errs, fmt.Errorf("key %d: %w", i, err))
+		}
+
+		if names[k.Name] {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrAPIKeyDuplicateName, k.Name))
+		}
+		names[k.Name] = true
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("config: api keys are not valid:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+func (k APIKey) Valid() error {
+	var errs []error
+
+	if k.Name == "" {
+		errs = append(errs, ErrAPIKeyMustHaveName)
+	}
+
+	if strings.ContainsAny(k.Name, ". \t\r\n") {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrAPIKeyBadName, k.Name))
+	}
+
+	sources := 0
+	for _, s := range []string{k.Hash, k.File, k.Env} {
+		if s != "" {
+			sources++
+		}
+	}
+
+	switch k.Type {
+	case "", APIKeyStatic:
+		if sources != 1 {
+			errs = append(errs, ErrAPIKeyNeedsOneSource)
+		}
+
+		if k.Hash != "" {
+			if _, err := k.HashBytes(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	case APIKeyHMAC:
+		if sources != 1 || k.Hash != "" {
+			errs = append(errs, ErrAPIKeyHMACNeedsSecret)
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%w, got: %q", ErrAPIKeyUnknownType, k.Type))
+	}
+
+	if k.Expires != "" {
+		if _, err := time.Parse(time.RFC3339, k.Expires); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrAPIKeyBadExpires, k.Expires))
+		}
+	}
+
+	for _, p := range k.Paths {
+		if !strings.HasPrefix(p, "/") {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrAPIKeyBadPath, p))
+		}
+	}
+
+	switch k.Action {
+	case RuleAllow:
+	case RuleWeigh:
+		if k.Weight == nil {
+			errs = append(errs, ErrAPIKeyWeighNeedsWeight)
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%w, got: %q", ErrAPIKeyBadAction, k.Action))
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("config: api key %q is not valid:\n%w", k.Name, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// HashBytes decodes Hash into the SHA-256 digest of the key.
+func (k APIKey) HashBytes() ([]byte, error) {
+	hexHash, ok := strings.CutPrefix(k.Hash, "sha256:")
+	if !ok {
+		return nil, fmt.Errorf("%w, got: %q", ErrAPIKeyBadHash, k.Hash)
+	}
+
+	result, err := hex.DecodeString(hexHash)
+	if err != nil || len(result) != 32 {
+		return nil, fmt.Errorf("%w, got: %q", ErrAPIKeyBadHash, k.Hash)
+	}
+
+	return result, nil
+}
+
+// ExpiresAt returns when the key stops working, or the zero time if it never
+// expires.
+func (k APIKey) ExpiresAt() time.Time {
+	t, _ := time.Parse(time.RFC3339, k.Expires)
+	return t
+}
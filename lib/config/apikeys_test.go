@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAPIKeysValid(t *testing.T) {
+	const goodHash = "sha256:21974faad09c41084fe7e836c08fe39d0a0f09ad32a03d21de2ea760ad72715f"
+
+	for _, cs := range []struct {
+		err  error
+		name string
+		inp  APIKeys
+	}{
+		{
+			name: "static hash",
+			inp: APIKeys{Keys: []APIKey{
+				{Name: "ci", Hash: goodHash, Action: RuleAllow},
+			}},
+		},
+		{
+			name: "hmac from env with weight",
+			inp: APIKeys{Header: "X-Api-Key", Keys: []APIKey{
+				{Name: "partner", Type: APIKeyHMAC, Env: "PARTNER_SECRET", Action: RuleWeigh, Weight: &Weight{Adjust: -5}},
+			}},
+		},
+		{
+			name: "no keys",
+			inp:  APIKeys{},
+			err:  ErrAPIKeysMustHaveKeys,
+		},
+		{
+			name: "authorization as header",
+			inp: APIKeys{Header: "authorization", Keys: []APIKey{
+				{Name: "ci", Hash: goodHash, Action: RuleAllow},
+			}},
+			err: ErrAPIKeysHeaderIsAuthorize,
+		},
+		{
+			name: "duplicate names",
+			inp: APIKeys{Keys: []APIKey{
+				{Name: "ci", Hash: goodHash, Action: RuleAllow},
+				{Name: "ci", Env: "CI_KEY", Action: RuleAllow},
+			}},
+			err: ErrAPIKeyDuplicateName,
+		},
+		{
+			name: "name with dot",
+			inp: APIKeys{Keys: []APIKey{
+				{Name: "ci.prod", Hash: goodHash, Action: RuleAllow},
+			}},
+			err: ErrAPIKeyBadName,
+		},
+		{
+			name: "two sources",
+			inp: APIKeys{Keys: []APIKey{
+				{Name: "ci", Hash: goodHash, Env: "CI_KEY", Action: RuleAllow},
+			}},
+			err: ErrAPIKeyNeedsOneSource,
+		},
+		{
+			name: "hmac with hash",
+			inp: APIKeys{Keys: []APIKey{
+				{Name: "partner", Type: APIKeyHMAC, Hash: goodHash, Action: RuleAllow},
+			}},
+			err: ErrAPIKeyHMACNeedsSecret,
+		},
+		{
+			name: "bad hash",
+			inp: APIKeys{Keys: []APIKey{
+				{Name: "ci", Hash: "md5:abcd", Action: RuleAllow},
+			}},
+			err: ErrAPIKeyBadHash,
+		},
+		{
+			name: "bad expiry",
+			inp: APIKeys{Keys: []APIKey{
+				{Name: "ci", Hash: goodHash, Expires: "tomorrow", Action: RuleAllow},
+			}},
+			err: ErrAPIKeyBadExpires,
+		},
+		{
+			name: "relative path",
+			inp: APIKeys{Keys: []APIKey{
+				{Name: "ci", Hash: goodHash, Paths: []string{"api"}, Action: RuleAllow},
+			}},
+			err: ErrAPIKeyBadPath,
+		},
+		{
+			name: "deny action",
+			inp: APIKeys{Keys: []APIKey{
+				{Name: "ci", Hash: goodHash, Action: RuleDeny},
+			}},
+			err: ErrAPIKeyBadAction,
+		},
+		{
+			name: "weigh without weight",
+			inp: APIKeys{Keys: []APIKey{
+				{Name: "ci", Hash: goodHash, Action: RuleWeigh},
+			}},
+			err: ErrAPIKeyWeighNeedsWeight,
+		},
+	} {
+		t.Run(cs.name, func(t *testing.T) {
+			if err := cs.inp.Valid(); !errors.Is(err, cs.err) {
+				t.Logf("want: %v", cs.err)
+				t.Logf("got:  %v", err)
+				t.Error("validation returned an unexpected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownChallengeBinding = errors.New("config.ChallengeBinding: unknown binding")
+
+// ChallengeBinding is a property of the client that a challenge was issued
+// to. When a challenge is solved, the client solving it must have the same
+// value or the solution is rejected.
+type ChallengeBinding string
+
+const (
+	BindingIP        ChallengeBinding = "ip"         // exact IP address
+	BindingNetwork   ChallengeBinding = "network"    // same /24 (IPv4) or /48 (IPv6)
+	BindingUserAgent ChallengeBinding = "user_agent" // exact User-Agent header
+	BindingJA4H      ChallengeBinding = "ja4h"       // JA4H HTTP fingerprint
+)
+
+func (cb ChallengeBinding) Valid() error {
+	switch cb {
+	case BindingIP, BindingNetwork, BindingUserAgent, BindingJA4H:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownChallengeBinding, cb)
+	}
+}
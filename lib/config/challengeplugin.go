@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrChallengePluginMustHaveName    = errors.New("config.ChallengePlugin: must set name")
+	ErrChallengePluginMustHaveAddress = errors.New("config.ChallengePlugin: must set address")
+	ErrChallengePluginBadTimeout      = errors.New("config.ChallengePlugin: timeout is invalid")
+	ErrChallengePluginDuplicateName   = errors.New("config.ChallengePlugin: name is used more than once")
+)
+
+// ChallengePlugin is a challenge method implemented by an external gRPC service.
+// Bot rules and thresholds use it by setting their challenge algorithm to Name.
+type ChallengePlugin struct {
+	Name      string `json:"name" yaml:"name"`
+	Address   string `json:"address" yaml:"address"`
+	Plaintext bool   `json:"plaintext,omitempty" yaml:"plaintext,omitempty"`
+	Timeout   string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// Headers are the request headers sent to the plugin in addition to
+	// Accept, Accept-Language and User-Agent.
+	Headers []string `json:"headers,omitempty" yaml:"headers,omitempty"`
+}
+
+func (cp ChallengePlugin) Valid() error {
+	var errs []error
+
+	if cp.Name == "" {
+		errs = append(errs, ErrChallengePluginMustHaveName)
+	}
+
+	if cp.Address == "" {
+		errs = append(errs, ErrChallengePluginMustHaveAddress)
+	}
+
+	if cp.Timeout != "" {
+		if d, err := time.ParseDuration(cp.Timeout); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrChallengePluginBadTimeout, cp.Timeout))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("config: challenge plugin %q is not valid:\n%w", cp.Name, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// TimeoutDuration returns how long Anubis waits for the plugin to respond.
+func (cp ChallengePlugin) TimeoutDuration() time.Duration {
+	if d, err := time.ParseDuration(cp.Timeout); err == nil && d > 0 {
+		return d
+	}
+
+	return 5 * time.Second
+}
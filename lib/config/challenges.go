@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrChallengesBadTTL            = errors.New("config.Challenges: ttl is invalid")
+	ErrChallengesBadMaxOutstanding = errors.New("config.Challenges: max_outstanding must not be negative")
+	ErrChallengesBadLimitBy        = errors.New("config.Challenges: limit_by must be ip or network")
+	ErrChallengesStatelessLimit    = errors.New("config.Challenges: max_outstanding can't be used with stateless challenges")
+)
+
+const (
+	LimitByIP      = "ip"
+	LimitByNetwork = "network"
+)
+
+// Challenges controls how long issued challenges are kept, how many unsolved
+// challenges a single client can have at once and whether challenges are
+// kept in the store at all.
+type Challenges struct {
+	TTL            string `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	MaxOutstanding int    `json:"max_outstanding,omitempty" yaml:"max_outstanding,omitempty"`
+	LimitBy        string `json:"limit_by,omitempty" yaml:"limit_by,omitempty"`
+
+	// Stateless hands challenges to the client in a sealed token instead of
+	// storing them, so that any instance sharing the signing keys can check
+	// the solution. Only solved challenges are written to the store.
+	Stateless bool `json:"stateless,omitempty" yaml:"stateless,omitempty"`
+}
+
+func (c Challenges) Valid() error {
+	var errs []error
+
+	if c.TTL != "" {
+		if d, err := time.ParseDuration(c.TTL); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrChallengesBadTTL, c.TTL))
+		}
+	}
+
+	if c.MaxOutstanding < 0 {
+		errs = append(errs, fmt.Errorf("%w, got: %d", ErrChallengesBadMaxOutstanding, c.MaxOutstanding))
+	}
+
+	if c.Stateless && c.MaxOutstanding > 0 {
+		errs = append(errs, ErrChallengesStatelessLimit)
+	}
+
+	switch c.LimitBy {
+	case "", LimitByIP, LimitByNetwork:
+	default:
+		errs = append(errs, fmt.Errorf("%w, got: %q", ErrChallengesBadLimitBy, c.LimitBy))
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("config: challenges is not valid:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// TTLDuration returns how long an issued challenge can be solved for.
+func (c Challenges) TTLDuration() time.Duration {
+	if d, err := time.ParseDuration(c.TTL); err == nil && d > 0 {
+		return d
+	}
+
+	return 30 * time.Minute
+}
@@ -16,7 +16,7 @@ import (
 var (
 	ErrNoBotRulesDefined                 = errors.New("config: must define at least one (1) bot rule")
 	ErrBotMustHaveName                   = errors.New("config.Bot: must set name")
-	ErrBotMustHaveUserAgentOrPath        = errors.New("config.Bot: must set one of user_agent_regex, path_regex, headers_regex, remote_addresses, expression, or Thoth keyword")
+	ErrBotMustHaveUserAgentOrPath        = errors.New("config.Bot: must set one of user_agent_regex, path_regex, headers_regex, remote_addresses, expression, matchers, or Thoth keyword")
 	ErrBotMustHaveUserAgentOrPathNotBoth = errors.New("config.Bot: must set either user_agent_regex, path_regex, and not both")
 	ErrUnknownAction                     = errors.New("config.Bot: unknown action")
 	ErrInvalidUserAgentRegex             = errors.New("config.Bot: invalid user agent regex")
@@ -58,6 +58,7 @@ type BotConfig struct {
 	Expression     *ExpressionOrList `json:"expression,omitempty" yaml:"expression,omitempty"`
 	Challenge      *ChallengeRules   `json:"challenge,omitempty" yaml:"challenge,omitempty"`
 	Weight         *Weight           `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Matchers       []Matcher         `json:"matchers,omitempty" yaml:"matchers,omitempty"`
 
 	// Thoth features
 	GeoIP *GeoIP `json:"geoip,omitempty"`
@@ -76,6 +77,7 @@ func (b BotConfig) Zero() bool {
 		len(b.HeadersRegex) != 0,
 		b.Action != "",
 		len(b.RemoteAddr) != 0,
+		len(b.Matchers) != 0,
 		b.Challenge != nil,
 		b.GeoIP != nil,
 		b.ASNs != nil,
@@ -99,6 +101,7 @@ func (b *BotConfig) Valid() error {
 		b.PathRegex == nil &&
 		len(b.RemoteAddr) == 0 &&
 		len(b.HeadersRegex) == 0 &&
+		len(b.Matchers) == 0 &&
 		b.ASNs == nil &&
 		b.GeoIP == nil
 
@@ -160,6 +163,12 @@ func (b *BotConfig) Valid() error {
 		}
 	}
 
+	for i, m := range b.Matchers {
+		if err := m.Valid(); err != nil {
+			errs = append(errs, fmt.Errorf("matcher %d: %w", i, err))
+		}
+	}
+
 	switch b.Action {
 	case RuleAllow, RuleBenchmark, RuleChallenge, RuleDeny, RuleWeigh:
 		// okay
@@ -188,14 +197,49 @@ type ChallengeRules struct {
 	Algorithm  string `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
 	Difficulty int    `json:"difficulty,omitempty" yaml:"difficulty,omitempty"`
 	ReportAs   int    `json:"report_as,omitempty" yaml:"report_as,omitempty"`
+
+	// Tunables for memory-hard algorithms such as scrypt. Memory is how many
+	// KiB each hash attempt needs and Iterations is how many times that memory
+	// is filled per attempt. Zero means the default for the algorithm.
+	Memory     int `json:"memory,omitempty" yaml:"memory,omitempty"`
+	Iterations int `json:"iterations,omitempty" yaml:"iterations,omitempty"`
 }
 
+const (
+	DefaultScryptMemory     = 4096 // 4 MiB
+	DefaultScryptIterations = 1
+
+	// Anubis has to compute one hash with these costs to validate every
+	// submitted solution, so they are kept low enough that validation can't
+	// be used to exhaust the server.
+	MaxChallengeMemory     = 16384 // 16 MiB
+	MaxChallengeIterations = 4
+)
+
 var (
 	ErrChallengeDifficultyTooLow  = errors.New("config.ChallengeRules: difficulty is too low (must be >= 0)")
 	ErrChallengeDifficultyTooHigh = errors.New("config.ChallengeRules: difficulty is too high (must be <= 64)")
 	ErrChallengeMustHaveAlgorithm = errors.New("config.ChallengeRules: must have algorithm name set")
+	ErrChallengeMemoryInvalid     = errors.New("config.ChallengeRules: memory must be a power of two between 2 and 16384 KiB")
+	ErrChallengeIterationsInvalid = errors.New("config.ChallengeRules: iterations must be between 1 and 4")
 )
 
+// ScryptParams returns the memory (in KiB) and iteration costs for the scrypt
+// algorithm, using the defaults for anything that is not set.
+func (cr ChallengeRules) ScryptParams() (memory, iterations int) {
+	memory, iterations = cr.Memory, cr.Iterations
+
+	if memory == 0 {
+		memory = DefaultScryptMemory
+	}
+
+	if iterations == 0 {
+		iterations = DefaultScryptIterations
+	}
+
+	return memory, iterations
+}
+
 func (cr ChallengeRules) Valid() error {
 	var errs []error
 
@@ -211,6 +255,14 @@ func (cr ChallengeRules) Valid() error {
 		errs = append(errs, fmt.Errorf("%w, got: %d", ErrChallengeDifficultyTooHigh, cr.Difficulty))
 	}
 
+	if cr.Memory != 0 && (cr.Memory < 2 || cr.Memory > MaxChallengeMemory || cr.Memory&(cr.Memory-1) != 0) {
+		errs = append(errs, fmt.Errorf("%w, got: %d", ErrChallengeMemoryInvalid, cr.Memory))
+	}
+
+	if cr.Iterations < 0 || cr.Iterations > MaxChallengeIterations {
+		errs = append(errs, fmt.Errorf("%w, got: %d", ErrChallengeIterationsInvalid, cr.Iterations))
+	}
+
 	if len(errs) != 0 {
 		return fmt.Errorf("config: challenge rules entry is not valid:\n%w", errors.Join(errs...))
 	}
@@ -274,6 +326,13 @@ type fileConfig struct {
 	Logging     *Logging            `json:"logging"`
 	Metrics     *Metrics            `json:"metrics,omitempty"`
 	Honeypot    *Honeypot           `json:"honeypot"`
+
+	ChallengePlugins   []ChallengePlugin   `json:"challenge_plugins,omitempty"`
+	AdaptiveDifficulty *AdaptiveDifficulty `json:"adaptive_difficulty,omitempty"`
+	ChallengeBinding   []ChallengeBinding  `json:"challenge_binding,omitempty"`
+	Challenges         *Challenges         `json:"challenges,omitempty"`
+	APIKeys            *APIKeys            `json:"api_keys,omitempty"`
+	UpstreamHeaders    *UpstreamHeaders    `json:"upstream_headers,omitempty"`
 }
 
 func (c *fileConfig) Valid() error {
@@ -327,6 +386,48 @@ func (c *fileConfig) Valid() error {
 		}
 	}
 
+	pluginNames := map[string]bool{}
+	for i, cp := range c.ChallengePlugins {
+		if err := cp.Valid(); err != nil {
+			errs = append(errs, fmt.Errorf("challenge plugin %d: %w", i, err))
+		}
+
+		if pluginNames[cp.Name] {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrChallengePluginDuplicateName, cp.Name))
+		}
+		pluginNames[cp.Name] = true
+	}
+
+	if c.AdaptiveDifficulty != nil {
+		if err := c.AdaptiveDifficulty.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, cb := range c.ChallengeBinding {
+		if err := cb.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Challenges != nil {
+		if err := c.Challenges.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.APIKeys != nil {
+		if err := c.APIKeys.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.UpstreamHeaders != nil {
+		if err := c.UpstreamHeaders.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if len(errs) != 0 {
 		return fmt.Errorf("config is not valid:\n%w", errors.Join(errs...))
 	}
@@ -372,6 +473,13 @@ func Load(fin io.Reader, fname string) (*Config, error) {
 		Logging:     c.Logging,
 		Metrics:     c.Metrics,
 		Honeypot:    c.Honeypot,
+
+		ChallengePlugins:   c.ChallengePlugins,
+		AdaptiveDifficulty: c.AdaptiveDifficulty,
+		ChallengeBinding:   c.ChallengeBinding,
+		Challenges:         c.Challenges,
+		APIKeys:            c.APIKeys,
+		UpstreamHeaders:    c.UpstreamHeaders,
 	}
 
 	if c.OpenGraph.TimeToLive != "" {
@@ -465,6 +573,13 @@ type Config struct {
 	DNSTTL      DnsTTL
 	Metrics     *Metrics
 	Honeypot    *Honeypot
+
+	ChallengePlugins   []ChallengePlugin
+	AdaptiveDifficulty *AdaptiveDifficulty
+	ChallengeBinding   []ChallengeBinding
+	Challenges         *Challenges
+	APIKeys            *APIKeys
+	UpstreamHeaders    *UpstreamHeaders
 }
 
 func (c Config) Valid() error {
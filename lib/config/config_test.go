@@ -126,6 +126,34 @@ func TestBotValid(t *testing.T) {
 			},
 			err: ErrChallengeDifficultyTooHigh,
 		},
+		{
+			name: "challenge memory not a power of two",
+			bot: BotConfig{
+				Name:      "mozilla-ua",
+				Action:    RuleChallenge,
+				PathRegex: p("Mozilla"),
+				Challenge: &ChallengeRules{
+					Difficulty: 1,
+					Algorithm:  "scrypt",
+					Memory:     1000,
+				},
+			},
+			err: ErrChallengeMemoryInvalid,
+		},
+		{
+			name: "challenge iterations too high",
+			bot: BotConfig{
+				Name:      "mozilla-ua",
+				Action:    RuleChallenge,
+				PathRegex: p("Mozilla"),
+				Challenge: &ChallengeRules{
+					Difficulty: 1,
+					Algorithm:  "scrypt",
+					Iterations: 100,
+				},
+			},
+			err: ErrChallengeIterationsInvalid,
+		},
 		{
 			name: "invalid cidr range",
 			bot: BotConfig{
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/TecharoHQ/anubis/lib/policy/checker"
+)
+
+var (
+	ErrMatcherMustHaveType = errors.New("config.Matcher: must set type")
+	ErrUnknownMatcherType  = errors.New("config.Matcher: unknown type")
+)
+
+// Matcher is a bot rule condition implemented by a checker type that was
+// registered with checker.Register.
+type Matcher struct {
+	Type   string          `json:"type" yaml:"type"`
+	Params json.RawMessage `json:"params,omitempty" yaml:"params,omitempty"`
+}
+
+func (m Matcher) Valid() error {
+	var errs []error
+
+	if len(m.Type) == 0 {
+		errs = append(errs, ErrMatcherMustHaveType)
+	}
+
+	fac, ok := checker.Get(m.Type)
+	switch ok {
+	case true:
+		if err := fac.Valid(m.Params); err != nil {
+			errs = append(errs, err)
+		}
+	case false:
+		if len(m.Type) != 0 {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrUnknownMatcherType, m.Type))
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
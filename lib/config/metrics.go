@@ -34,6 +34,7 @@ type Metrics struct {
 	TLS        *MetricsTLS       `json:"tls" yaml:"tls"`
 	Debug      bool              `json:"debug" yaml:"debug"`
 	BasicAuth  *MetricsBasicAuth `json:"basicAuth" yaml:"basicAuth"`
+	JWKS       bool              `json:"jwks" yaml:"jwks"`
 }
 
 func (m *Metrics) Valid() error {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/TecharoHQ/anubis/lib/store"
 	_ "github.com/TecharoHQ/anubis/lib/store/all"
+	"github.com/TecharoHQ/anubis/lib/store/degraded"
 )
 
 var (
@@ -17,6 +18,10 @@ var (
 type Store struct {
 	Backend    string          `json:"backend"`
 	Parameters json.RawMessage `json:"parameters"`
+
+	// Degraded sets what Anubis does while the backend is unavailable. When
+	// it is not set, requests that need the backend fail.
+	Degraded *degraded.Config `json:"degraded,omitempty"`
 }
 
 func (s *Store) Valid() error {
@@ -36,6 +41,12 @@ func (s *Store) Valid() error {
 		errs = append(errs, fmt.Errorf("%w: %q", ErrUnknownStoreBackend, s.Backend))
 	}
 
+	if s.Degraded != nil {
+		if err := s.Degraded.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if len(errs) != 0 {
 		return errors.Join(errs...)
 	}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/TecharoHQ/anubis/lib/config"
 	"github.com/TecharoHQ/anubis/lib/store/bbolt"
+	"github.com/TecharoHQ/anubis/lib/store/degraded"
+	"github.com/TecharoHQ/anubis/lib/store/encrypted"
 	"github.com/TecharoHQ/anubis/lib/store/valkey"
 )
 
@@ -65,6 +67,53 @@ func TestStoreValid(t *testing.T) {
 			},
 			err: bbolt.ErrMissingPath,
 		},
+		{
+			name: "cache in front of valkey",
+			input: config.Store{
+				Backend:    "cache",
+				Parameters: json.RawMessage(`{"backend": "valkey", "parameters": {"url": "redis://valkey:6379/0"}, "maxTTL": "30s"}`),
+			},
+		},
+		{
+			name: "cache in front of invalid valkey",
+			input: config.Store{
+				Backend:    "cache",
+				Parameters: json.RawMessage(`{"backend": "valkey", "parameters": {}}`),
+			},
+			err: valkey.ErrNoURL,
+		},
+		{
+			name: "encrypted s3api",
+			input: config.Store{
+				Backend:    "encrypted",
+				Parameters: json.RawMessage(`{"backend": "s3api", "parameters": {"bucketName": "anubis"}, "keyFile": "/run/secrets/anubis-store-keys"}`),
+			},
+		},
+		{
+			name: "encrypted without keyFile",
+			input: config.Store{
+				Backend:    "encrypted",
+				Parameters: json.RawMessage(`{"backend": "memory"}`),
+			},
+			err: encrypted.ErrNoKeyFile,
+		},
+		{
+			name: "valkey with degraded mode",
+			input: config.Store{
+				Backend:    "valkey",
+				Parameters: json.RawMessage(`{"url": "redis://valkey:6379/0"}`),
+				Degraded:   &degraded.Config{Mode: degraded.ModeMemory, ProbeInterval: "2s"},
+			},
+		},
+		{
+			name: "unknown degraded mode",
+			input: config.Store{
+				Backend:    "valkey",
+				Parameters: json.RawMessage(`{"url": "redis://valkey:6379/0"}`),
+				Degraded:   &degraded.Config{Mode: "yolo"},
+			},
+			err: degraded.ErrUnknownMode,
+		},
 		{
 			name: "unknown backend",
 			input: config.Store{
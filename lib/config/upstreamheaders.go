@@ -0,0 +1,85 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUpstreamHeadersUnknownField   = errors.New("config.UpstreamHeaders: unknown field")
+	ErrUpstreamHeadersDuplicateField = errors.New("config.UpstreamHeaders: duplicate field")
+	ErrUpstreamHeadersEmpty          = errors.New("config.UpstreamHeaders: must include at least one field")
+)
+
+// UpstreamHeaderField is a fact about how a request was let through that can
+// be forwarded to the upstream.
+type UpstreamHeaderField string
+
+const (
+	UpstreamChallengeID UpstreamHeaderField = "challenge_id" // ID of the solved challenge
+	UpstreamMethod      UpstreamHeaderField = "method"       // challenge method that was solved
+	UpstreamDifficulty  UpstreamHeaderField = "difficulty"   // difficulty the challenge was solved at
+	UpstreamIssuedAt    UpstreamHeaderField = "issued_at"    // when the client passed the challenge
+	UpstreamWeight      UpstreamHeaderField = "weight"       // weight of the current request
+	UpstreamASN         UpstreamHeaderField = "asn"          // autonomous system number of the client
+	UpstreamCountry     UpstreamHeaderField = "country"      // ISO 3166-1 country code of the client
+)
+
+func (f UpstreamHeaderField) Valid() error {
+	switch f {
+	case UpstreamChallengeID, UpstreamMethod, UpstreamDifficulty, UpstreamIssuedAt, UpstreamWeight, UpstreamASN, UpstreamCountry:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUpstreamHeadersUnknownField, f)
+	}
+}
+
+// UpstreamHeaders adds headers describing the decision Anubis made to requests
+// it passes to the upstream. When Sign is set, the same facts are also sent as
+// a compact JWS signed with the token signing key, so that the upstream can
+// trust them even if it can be reached without going through Anubis.
+type UpstreamHeaders struct {
+	Include []UpstreamHeaderField `json:"include" yaml:"include"`
+	Sign    bool                  `json:"sign,omitempty" yaml:"sign,omitempty"`
+}
+
+func (uh UpstreamHeaders) Valid() error {
+	var errs []error
+
+	if len(uh.Include) == 0 {
+		errs = append(errs, ErrUpstreamHeadersEmpty)
+	}
+
+	seen := map[UpstreamHeaderField]bool{}
+	for _, f := range uh.Include {
+		if err := f.Valid(); err != nil {
+			errs = append(errs, err)
+		}
+
+		if seen[f] {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrUpstreamHeadersDuplicateField, f))
+		}
+		seen[f] = true
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("config: upstream headers are not valid:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// Includes reports whether f is forwarded.
+func (uh *UpstreamHeaders) Includes(f UpstreamHeaderField) bool {
+	if uh == nil {
+		return false
+	}
+
+	for _, inc := range uh.Include {
+		if inc == f {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpstreamHeadersValid(t *testing.T) {
+	for _, cs := range []struct {
+		err  error
+		name string
+		inp  UpstreamHeaders
+	}{
+		{
+			name: "every field",
+			inp: UpstreamHeaders{Include: []UpstreamHeaderField{
+				UpstreamChallengeID, UpstreamMethod, UpstreamDifficulty, UpstreamIssuedAt, UpstreamWeight, UpstreamASN, UpstreamCountry,
+			}},
+		},
+		{
+			name: "signed",
+			inp:  UpstreamHeaders{Include: []UpstreamHeaderField{UpstreamWeight}, Sign: true},
+		},
+		{
+			name: "empty",
+			inp:  UpstreamHeaders{Sign: true},
+			err:  ErrUpstreamHeadersEmpty,
+		},
+		{
+			name: "unknown field",
+			inp:  UpstreamHeaders{Include: []UpstreamHeaderField{"user_agent"}},
+			err:  ErrUpstreamHeadersUnknownField,
+		},
+		{
+			name: "duplicate field",
+			inp:  UpstreamHeaders{Include: []UpstreamHeaderField{UpstreamASN, UpstreamASN}},
+			err:  ErrUpstreamHeadersDuplicateField,
+		},
+	} {
+		t.Run(cs.name, func(t *testing.T) {
+			err := cs.inp.Valid()
+			if !errors.Is(err, cs.err) {
+				t.Errorf("wanted error %v, got: %v", cs.err, err)
+			}
+		})
+	}
+}
+
+func TestUpstreamHeadersIncludes(t *testing.T) {
+	var uh *UpstreamHeaders
+	if uh.Includes(UpstreamASN) {
+		t.Error("nil UpstreamHeaders should include nothing")
+	}
+
+	uh = &UpstreamHeaders{Include: []UpstreamHeaderField{UpstreamASN}}
+	if !uh.Includes(UpstreamASN) || uh.Includes(UpstreamCountry) {
+		t.Errorf("wrong fields included: %v", uh.Include)
+	}
+}
@@ -2,11 +2,14 @@ package lib
 
 import (
 	"errors"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/TecharoHQ/anubis"
+	"github.com/TecharoHQ/anubis/lib/keyring"
 	"github.com/TecharoHQ/anubis/lib/policy"
 	"github.com/TecharoHQ/anubis/lib/thoth/thothmock"
 )
@@ -57,3 +60,76 @@ func TestGoodConfigs(t *testing.T) {
 		})
 	}
 }
+
+func TestNewWithHS512Secret(t *testing.T) {
+	// Secrets of any length must work, not only ones long enough to be
+	// mistaken for an ed25519 key.
+	for _, secret := range []string{"hunter2", "a much longer secret that is well over 32 bytes"} {
+		t.Run(secret, func(t *testing.T) {
+			s, err := New(Options{
+				Next:        http.NewServeMux(),
+				Policy:      loadPolicies(t, "", anubis.DefaultDifficulty),
+				HS512Secret: []byte(secret),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := s.keyring.ActiveKeyID(), keyring.HS512Key([]byte(secret)).ID; got != want {
+				t.Errorf("wanted the HS512 key %s to sign tokens, got: %s", want, got)
+			}
+		})
+	}
+}
+
+func TestChallengePluginsPerServer(t *testing.T) {
+	const withPlugin = `
+challenge_plugins:
+  - name: login-check
+    address: localhost:1
+    plaintext: true
+
+bots:
+  - name: everyone
+    path_regex: .*
+    action: CHALLENGE
+    challenge:
+      algorithm: login-check
+`
+
+	pol, err := policy.ParseConfig(t.Context(), strings.NewReader(withPlugin), "inline.yaml", 0, "info", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withPlugins, err := New(Options{Next: http.NewServeMux(), Policy: pol})
+	if err != nil {
+		t.Fatalf("a policy parsed with policy.ParseConfig should get its plugins: %v", err)
+	}
+	t.Cleanup(func() { withPlugins.Close() }) //nolint:errcheck
+
+	if _, ok := withPlugins.challengeImpl("login-check"); !ok {
+		t.Error("the server should know its challenge plugin")
+	}
+
+	// Plugins are not shared with other servers.
+	other, err := New(Options{Next: http.NewServeMux(), Policy: loadPolicies(t, "", anubis.DefaultDifficulty)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { other.Close() }) //nolint:errcheck
+
+	if _, ok := other.challengeImpl("login-check"); ok {
+		t.Error("a plugin of one server leaked into another")
+	}
+
+	// A policy that uses a plugin it doesn't set up is rejected.
+	pol.ChallengePlugins = nil
+	if _, err := New(Options{Next: http.NewServeMux(), Policy: pol}); !errors.Is(err, policy.ErrChallengeRuleHasWrongAlgorithm) {
+		t.Errorf("wanted %v, got: %v", policy.ErrChallengeRuleHasWrongAlgorithm, err)
+	}
+
+	if err := withPlugins.Close(); err != nil {
+		t.Errorf("can't close plugin connections: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package lib
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/TecharoHQ/anubis/lib/challenge"
+	"github.com/TecharoHQ/anubis/lib/policy"
+)
+
+// DefaultHookBufferSize is the number of events that can be waiting for
+// delivery to hooks before new events are dropped.
+const DefaultHookBufferSize = 1024
+
+var hookEventsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "anubis_hook_events_dropped_total",
+	Help: "The total number of events that were not delivered to hooks because the hook buffer was full",
+}, []string{"event"})
+
+// Event describes a decision Anubis made about a request. Events are delivered
+// to hooks after the response has been decided, so hooks cannot change the
+// outcome.
+type Event struct {
+	// Time is when the decision was made.
+	Time time.Time
+
+	// Request is a copy of the request that triggered the event. Its body must
+	// not be read, it is owned by the request handler.
+	Request *http.Request
+
+	// CheckResult is the result of evaluating the policy against the request.
+	CheckResult policy.CheckResult
+
+	// Rule is the policy rule that matched the request, if any.
+	Rule *policy.Bot
+
+	// Challenge is the challenge that was issued or validated, if any.
+	Challenge *challenge.Challenge
+
+	// ASN and ASNDescription are the autonomous system the client is in, if
+	// ASN logging is enabled.
+	ASN            string
+	ASNDescription string
+}
+
+// Hooks are functions that are called when Anubis makes a decision about a
+// request. Hooks are called one at a time in a background goroutine so that
+// a slow hook can't stall request handling. If hooks fall behind by more than
+// BufferSize events, new events are dropped and counted in the
+// anubis_hook_events_dropped_total metric. Events that are still waiting when
+// the Server is closed are dropped as well.
+type Hooks struct {
+	OnChallengeIssued func(Event)
+	OnChallengePassed func(Event)
+	OnChallengeFailed func(Event)
+	OnDeny            func(Event)
+	OnAllow           func(Event)
+
+	// BufferSize is the number of pending events, defaults to DefaultHookBufferSize.
+	BufferSize int
+}
+
+func (h Hooks) enabled() bool {
+	return h.OnChallengeIssued != nil ||
+		h.OnChallengePassed != nil ||
+		h.OnChallengeFailed != nil ||
+		h.OnDeny != nil ||
+		h.OnAllow != nil
+}
+
+type hookCall struct {
+	name string
+	fn   func(Event)
+	ev   Event
+}
+
+type hookDispatcher struct {
+	hooks  Hooks
+	queue  chan hookCall
+	logger *slog.Logger
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newHookDispatcher(hooks Hooks, lg *slog.Logger) *hookDispatcher {
+	if !hooks.enabled() {
+		return nil
+	}
+
+	if hooks.BufferSize <= 0 {
+		hooks.BufferSize = DefaultHookBufferSize
+	}
+
+	result := &hookDispatcher{
+		hooks:  hooks,
+		queue:  make(chan hookCall, hooks.BufferSize),
+		logger: lg.With("subsystem", "hooks"),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go result.run()
+
+	return result
+}
+
+func (hd *hookDispatcher) run() {
+	defer close(hd.done)
+
+	for {
+		select {
+		case <-hd.stop:
+			return
+		case call := <-hd.queue:
+			hd.call(call)
+		}
+	}
+}
+
+// close stops delivering events and waits for the hook that is running, if
+// any, to return. Events dispatched afterwards are never delivered.
+func (hd *hookDispatcher) close() {
+	if hd == nil {
+		return
+	}
+
+	hd.stopOnce.Do(func() { close(hd.stop) })
+	<-hd.done
+}
+
+func (hd *hookDispatcher) call(call hookCall) {
+	defer func() {
+		if err := recover(); err != nil {
+			hd.logger.Error("hook panicked", "event", call.name, "err", err)
+		}
+	}()
+
+	call.fn(call.ev)
+}
+
+func (hd *hookDispatcher) dispatch(name string, fn func(Event), r *http.Request, cr policy.CheckResult, rule *policy.Bot, chall *challenge.Challenge) {
+	if fn == nil {
+		return
+	}
+
+	asn, asnDesc := asnFromContext(r.Context())
+
+	ev := Event{
+		Time:           time.Now(),
+		Request:        r.Clone(context.WithoutCancel(r.Context())),
+		CheckResult:    cr,
+		Rule:           rule,
+		Challenge:      chall,
+		ASN:            asn,
+		ASNDescription: asnDesc,
+	}
+
+	select {
+	case hd.queue <- hookCall{name: name, fn: fn, ev: ev}:
+	default:
+		hookEventsDropped.WithLabelValues(name).Inc()
+	}
+}
+
+func (hd *hookDispatcher) challengeIssued(r *http.Request, cr policy.CheckResult, rule *policy.Bot, chall *challenge.Challenge) {
+	if hd != nil {
+		hd.dispatch("challenge_issued", hd.hooks.OnChallengeIssued, r, cr, rule, chall)
+	}
+}
+
+func (hd *hookDispatcher) challengePassed(r *http.Request, cr policy.CheckResult, rule *policy.Bot, chall *challenge.Challenge) {
+	if hd != nil {
+		hd.dispatch("challenge_passed", hd.hooks.OnChallengePassed, r, cr, rule, chall)
+	}
+}
+
+func (hd *hookDispatcher) challengeFailed(r *http.Request, cr policy.CheckResult, rule *policy.Bot, chall *challenge.Challenge) {
+	if hd != nil {
+		hd.dispatch("challenge_failed", hd.hooks.OnChallengeFailed, r, cr, rule, chall)
+	}
+}
+
+func (hd *hookDispatcher) deny(r *http.Request, cr policy.CheckResult, rule *policy.Bot) {
+	if hd != nil {
+		hd.dispatch("deny", hd.hooks.OnDeny, r, cr, rule, nil)
+	}
+}
+
+func (hd *hookDispatcher) allow(r *http.Request, cr policy.CheckResult, rule *policy.Bot) {
+	if hd != nil {
+		hd.dispatch("allow", hd.hooks.OnAllow, r, cr, rule, nil)
+	}
+}
@@ -0,0 +1,197 @@
+package lib
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/lib/challenge"
+	"github.com/TecharoHQ/anubis/lib/policy"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type hookRecorder struct {
+	events chan string
+}
+
+func newHookRecorder() *hookRecorder {
+	return &hookRecorder{events: make(chan string, 16)}
+}
+
+func (hr *hookRecorder) hook(name string) func(Event) {
+	return func(ev Event) {
+		if ev.Request == nil {
+			panic("event has no request")
+		}
+		hr.events <- name
+	}
+}
+
+func (hr *hookRecorder) hooks() Hooks {
+	return Hooks{
+		OnChallengeIssued: hr.hook("issued"),
+		OnChallengePassed: hr.hook("passed"),
+		OnChallengeFailed: hr.hook("failed"),
+		OnDeny:            hr.hook("deny"),
+		OnAllow:           hr.hook("allow"),
+	}
+}
+
+func (hr *hookRecorder) expect(t *testing.T, want string) {
+	t.Helper()
+
+	select {
+	case got := <-hr.events:
+		if got != want {
+			t.Errorf("wanted event %q, got: %q", want, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("timed out waiting for event %q", want)
+	}
+}
+
+func TestHooksChallengeLifecycle(t *testing.T) {
+	hr := newHookRecorder()
+
+	srv := spawnAnubis(t, Options{
+		Next:   http.NewServeMux(),
+		Policy: loadPolicies(t, "testdata/zero_difficulty.yaml", 0),
+		Hooks:  hr.hooks(),
+	})
+
+	ts := httptest.NewServer(internal.RemoteXRealIP(true, "tcp", srv))
+	t.Cleanup(ts.Close)
+
+	cli := httpClient(t)
+
+	chall := makeChallenge(t, ts, cli)
+	hr.expect(t, "issued")
+
+	resp := handleChallengeInvalidProof(t, ts, cli, chall)
+	resp.Body.Close() //nolint:errcheck
+	hr.expect(t, "failed")
+
+	chall = makeChallenge(t, ts, cli)
+	hr.expect(t, "issued")
+
+	resp = handleChallengeZeroDifficulty(t, ts, cli, chall)
+	resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("wanted status %d, got: %d", http.StatusFound, resp.StatusCode)
+	}
+	hr.expect(t, "passed")
+}
+
+func TestHooksDenyAndAllow(t *testing.T) {
+	hr := newHookRecorder()
+
+	srv := spawnAnubis(t, Options{
+		Next:   http.NewServeMux(),
+		Policy: loadPolicies(t, "testdata/aggressive_403.yaml", 0),
+		Hooks:  hr.hooks(),
+	})
+
+	for _, tc := range []struct {
+		userAgent string
+		want      string
+	}{
+		{userAgent: "DENY", want: "deny"},
+		{userAgent: "Mozilla/5.0", want: "allow"},
+	} {
+		t.Run(tc.want, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("User-Agent", tc.userAgent)
+			req.Header.Set("X-Real-Ip", "127.0.0.1")
+
+			srv.ServeHTTP(httptest.NewRecorder(), req)
+
+			hr.expect(t, tc.want)
+		})
+	}
+}
+
+func TestHooksDropWhenFull(t *testing.T) {
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+
+	started := make(chan struct{}, 1)
+
+	hd := newHookDispatcher(Hooks{
+		OnDeny: func(Event) {
+			started <- struct{}{}
+			<-block
+		},
+		BufferSize: 1,
+	}, slog.Default())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	before := testutil.ToFloat64(hookEventsDropped.WithLabelValues("deny"))
+
+	// The first event occupies the worker, the second fills the buffer.
+	hd.deny(req, policy.CheckResult{}, nil)
+	<-started
+	hd.deny(req, policy.CheckResult{}, nil)
+
+	done := make(chan struct{})
+	go func() {
+		hd.deny(req, policy.CheckResult{}, nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatching an event blocked on a slow hook")
+	}
+
+	if got := testutil.ToFloat64(hookEventsDropped.WithLabelValues("deny")) - before; got != 1 {
+		t.Errorf("wanted 1 dropped event, got: %v", got)
+	}
+}
+
+func TestHooksClose(t *testing.T) {
+	hr := newHookRecorder()
+	hd := newHookDispatcher(hr.hooks(), slog.Default())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	hd.deny(req, policy.CheckResult{}, nil)
+	hr.expect(t, "deny")
+
+	closed := make(chan struct{})
+	go func() {
+		hd.close()
+		hd.close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing the dispatcher did not stop it")
+	}
+
+	// Events dispatched after closing are dropped, not delivered.
+	hd.deny(req, policy.CheckResult{}, nil)
+	select {
+	case got := <-hr.events:
+		t.Errorf("got event %q after closing", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Closing a nil dispatcher must be a no-op.
+	(*hookDispatcher)(nil).close()
+}
+
+func TestHooksDisabled(t *testing.T) {
+	hd := newHookDispatcher(Hooks{BufferSize: 10}, slog.Default())
+	if hd != nil {
+		t.Fatal("dispatcher should not be created without any hooks")
+	}
+
+	// Calling hooks on a nil dispatcher must be a no-op.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	hd.challengeIssued(req, policy.CheckResult{}, nil, &challenge.Challenge{})
+}
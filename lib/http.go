@@ -8,7 +8,9 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log/slog"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -31,7 +33,8 @@ import (
 var domainMatchRegexp = regexp.MustCompile(`^((xn--)?[a-z0-9]+(-[a-z0-9]+)*\.)+[a-z]{2,}$`)
 
 var (
-	ErrActualAnubisBug = errors.New("this is an actual bug in Anubis, please file an issue with the magic string 'taco bell'")
+	ErrActualAnubisBug          = errors.New("this is an actual bug in Anubis, please file an issue with the magic string 'taco bell'")
+	ErrMissingRestrictionHeader = errors.New("lib: JWT restriction header is configured but missing from the request")
 )
 
 // matchRedirectDomain returns true if host matches any of the allowed redirect
@@ -66,7 +69,7 @@ func (s *Server) cookieName(base string) string {
 	h := sha256.Sum256(fmt.Appendf(nil, "%t|%t|%t|%d|%s|%t|%s",
 		s.opts.CookieHttpOnly, s.opts.CookieSecure, s.opts.CookiePartitioned,
 		s.opts.CookieSameSite, s.opts.CookieDomain, s.opts.CookieDynamicDomain,
-		anubis.BasePrefix))
+		s.opts.BasePrefix))
 	return base + "-" + hex.EncodeToString(h[:4])
 }
 
@@ -79,7 +82,7 @@ func (s *Server) getCookie(r *http.Request, base string) (*http.Cookie, error) {
 
 func (s *Server) SetCookie(w http.ResponseWriter, cookieOpts CookieOpts) {
 	var domain = s.opts.CookieDomain
-	var name = anubis.CookieName
+	var name = s.opts.CookieName
 	var path = "/"
 	var sameSite = s.opts.CookieSameSite
 
@@ -118,7 +121,7 @@ func (s *Server) SetCookie(w http.ResponseWriter, cookieOpts CookieOpts) {
 
 func (s *Server) ClearCookie(w http.ResponseWriter, cookieOpts CookieOpts) {
 	var domain = s.opts.CookieDomain
-	var name = anubis.CookieName
+	var name = s.opts.CookieName
 	var path = "/"
 	var sameSite = s.opts.CookieSameSite
 
@@ -209,7 +212,19 @@ func makeCode(err error) string {
 }
 
 func (s *Server) RenderIndex(w http.ResponseWriter, r *http.Request, cr policy.CheckResult, rule *policy.Bot, returnHTTPStatusOnly bool) {
+	s.renderIndex(w, r, nil, cr, rule, returnHTTPStatusOnly)
+}
+
+// renderIndex is RenderIndex with the logger the caller got from
+// getRequestLogger, so that its ASN lookup isn't repeated. If lg is nil, it is
+// set up when it's needed.
+func (s *Server) renderIndex(w http.ResponseWriter, r *http.Request, lg *slog.Logger, cr policy.CheckResult, rule *policy.Bot, returnHTTPStatusOnly bool) {
+	if s.handleStoreUnavailable(w, r, lg, cr, rule) {
+		return
+	}
+
 	localizer := localization.GetLocalizer(r)
+	w.Header().Set(anubis.ChallengeAPIHeader, strings.TrimSuffix(s.opts.BasePrefix, "/")+anubis.APIPrefix+"v1/challenge")
 
 	if returnHTTPStatusOnly {
 		if s.opts.PublicUrl == "" {
@@ -226,7 +241,9 @@ func (s *Server) RenderIndex(w http.ResponseWriter, r *http.Request, cr policy.C
 		return
 	}
 
-	lg, r := s.getRequestLogger(r)
+	if lg == nil {
+		lg, r = s.getRequestLogger(r)
+	}
 
 	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") && randomChance(64) {
 		lg.ErrorContext(r.Context(), "client was given a challenge but does not in fact support gzip compression")
@@ -239,18 +256,24 @@ func (s *Server) RenderIndex(w http.ResponseWriter, r *http.Request, cr policy.C
 		challengesIssued.WithLabelValues("embedded", asn, asnDesc).Add(1)
 	}
 	chall, err := s.issueChallenge(r.Context(), r, lg, cr, rule)
+	if errors.Is(err, ErrTooManyChallenges) {
+		lg.WarnContext(r.Context(), "client has too many outstanding challenges")
+		s.respondWithStatus(w, r, localizer.T("too_many_challenges"), "", http.StatusTooManyRequests)
+		return
+	}
 	if err != nil {
 		lg.ErrorContext(r.Context(), "can't get challenge", "err", err)
 		algorithm := "unknown"
 		if rule.Challenge != nil {
 			algorithm = rule.Challenge.Algorithm
 		}
-		s.ClearCookie(w, CookieOpts{Name: anubis.TestCookieName, Host: r.Host})
+		s.ClearCookie(w, CookieOpts{Name: s.opts.TestCookieName, Host: r.Host})
 		s.respondWithError(w, r, fmt.Sprintf("%s: %s", localizer.T("internal_server_error"), algorithm), makeCode(err))
 		return
 	}
 
-	lg = lg.With("challenge", chall.ID)
+	rule = ruleForChallenge(rule, chall)
+	lg = lg.With("challenge", challengeID(chall.ID))
 
 	var ogTags map[string]string = nil
 	if s.opts.OpenGraph.Enabled {
@@ -265,28 +288,31 @@ func (s *Server) RenderIndex(w http.ResponseWriter, r *http.Request, cr policy.C
 		Value:  chall.ID,
 		Host:   r.Host,
 		Path:   "/",
-		Name:   anubis.TestCookieName,
-		Expiry: 30 * time.Minute,
+		Name:   s.opts.TestCookieName,
+		Expiry: s.policy.Challenges.TTLDuration(),
 	})
 
-	impl, ok := challenge.Get(chall.Method)
+	impl, ok := s.challengeImpl(chall.Method)
 	if !ok {
 		algorithm := "unknown"
 		if rule.Challenge != nil {
 			algorithm = rule.Challenge.Algorithm
 		}
 		lg.ErrorContext(r.Context(), "check failed", "err", "can't get algorithm", "algorithm", algorithm)
-		s.ClearCookie(w, CookieOpts{Name: anubis.TestCookieName, Host: r.Host})
+		s.ClearCookie(w, CookieOpts{Name: s.opts.TestCookieName, Host: r.Host})
 		s.respondWithError(w, r, fmt.Sprintf("%s: %s", localizer.T("internal_server_error"), algorithm), makeCode(err))
 		return
 	}
 
 	in := &challenge.IssueInput{
-		Impressum: s.policy.Impressum,
-		Rule:      rule,
-		Challenge: chall,
-		OGTags:    ogTags,
-		Store:     s.store,
+		Impressum:                s.policy.Impressum,
+		Rule:                     rule,
+		Challenge:                chall,
+		OGTags:                   ogTags,
+		Store:                    s.store,
+		BasePrefix:               s.opts.BasePrefix,
+		UseSimplifiedExplanation: s.opts.UseSimplifiedExplanation,
+		ChallengeTTL:             s.policy.Challenges.TTLDuration(),
 	}
 
 	component, err := impl.Issue(w, r, lg, in)
@@ -373,17 +399,21 @@ func (s *Server) respondWithStatus(w http.ResponseWriter, r *http.Request, msg,
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if strings.HasPrefix(r.URL.Path, anubis.BasePrefix+anubis.StaticPath) {
+	// Templates and helpers outside of this package read the per-server
+	// settings from the request context.
+	r = r.WithContext(anubis.WithSettings(r.Context(), s.settings))
+
+	if strings.HasPrefix(r.URL.Path, s.opts.BasePrefix+anubis.StaticPath) {
 		s.mux.ServeHTTP(w, r)
 		return
-	} else if strings.HasPrefix(r.URL.Path, anubis.BasePrefix+xess.BasePrefix) {
+	} else if strings.HasPrefix(r.URL.Path, s.opts.BasePrefix+xess.BasePrefix) {
 		s.mux.ServeHTTP(w, r)
 		return
 	}
 
 	// Forward robots.txt requests to mux when ServeRobotsTXT is enabled
 	if s.opts.ServeRobotsTXT {
-		path := strings.TrimPrefix(r.URL.Path, anubis.BasePrefix)
+		path := strings.TrimPrefix(r.URL.Path, s.opts.BasePrefix)
 		if path == "/robots.txt" || path == "/.well-known/robots.txt" {
 			s.mux.ServeHTTP(w, r)
 			return
@@ -470,18 +500,68 @@ func (s *Server) ServeHTTPNext(w http.ResponseWriter, r *http.Request) {
 		asn, asnDesc := asnFromContext(r.Context())
 		requestsProxied.WithLabelValues(r.Host, asn, asnDesc).Inc()
 		r = s.stripBasePrefixFromRequest(r)
+		s.policy.APIKeys.Strip(r)
 		s.next.ServeHTTP(w, r)
 	}
 }
 
-func (s *Server) signJWT(claims jwt.MapClaims) (string, error) {
+// jwtAudience returns the aud claim for tokens issued to r. Unless an
+// audience is configured, it is the domain the cookie is sent to, so that
+// upstreams on every host sharing the cookie can check it.
+func (s *Server) jwtAudience(r *http.Request) string {
+	if s.opts.JWTAudience != "" {
+		return s.opts.JWTAudience
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if s.opts.CookieDynamicDomain && domainMatchRegexp.MatchString(host) {
+		if etld, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+			return etld
+		}
+	}
+
+	if s.opts.CookieDomain != "" {
+		return strings.TrimPrefix(s.opts.CookieDomain, ".")
+	}
+
+	return host
+}
+
+// checkTokenAudience returns an error unless the iss and aud claims of a
+// token presented by r match the ones Anubis signs tokens for r with, so that
+// tokens minted for another issuer or audience sharing the keyring are
+// rejected. Tokens issued before Anubis set these claims don't have them and
+// are accepted until they expire.
+func (s *Server) checkTokenAudience(r *http.Request, claims jwt.MapClaims) error {
+	var opts []jwt.ParserOption
+	if _, ok := claims["iss"]; ok {
+		opts = append(opts, jwt.WithIssuer(s.opts.JWTIssuer))
+	}
+	if _, ok := claims["aud"]; ok {
+		opts = append(opts, jwt.WithAudience(s.jwtAudience(r)))
+	}
+
+	if len(opts) == 0 {
+		return nil
+	}
+
+	return jwt.NewValidator(opts...).Validate(claims)
+}
+
+// signJWT sets the standard claims and signs claims. The token expires after
+// the cookie expiration time unless claims already has an exp claim.
+func (s *Server) signJWT(r *http.Request, claims jwt.MapClaims) (string, error) {
+	claims["iss"] = s.opts.JWTIssuer
+	claims["aud"] = s.jwtAudience(r)
 	claims["iat"] = time.Now().Unix()
 	claims["nbf"] = time.Now().Add(-1 * time.Minute).Unix()
-	claims["exp"] = time.Now().Add(s.opts.CookieExpiration).Unix()
-
-	if len(s.hs512Secret) == 0 {
-		return jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims).SignedString(s.ed25519Priv)
-	} else {
-		return jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString(s.hs512Secret)
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = time.Now().Add(s.opts.CookieExpiration).Unix()
 	}
+
+	return s.keyring.Sign(claims)
 }
@@ -239,3 +239,47 @@ func TestRejectsHostlessRedirect(t *testing.T) {
 		t.Fatalf("expected no Location header on rejected redirect, got %q", got)
 	}
 }
+
+func TestJWTAudience(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		host    string
+		options Options
+		want    string
+	}{
+		{
+			name: "request host",
+			host: "git.techaro.lol:8443",
+			want: "git.techaro.lol",
+		},
+		{
+			name:    "cookie domain",
+			host:    "git.techaro.lol",
+			options: Options{CookieDomain: ".techaro.lol"},
+			want:    "techaro.lol",
+		},
+		{
+			name:    "dynamic cookie domain",
+			host:    "git.techaro.lol",
+			options: Options{CookieDynamicDomain: true},
+			want:    "techaro.lol",
+		},
+		{
+			name:    "configured",
+			host:    "git.techaro.lol",
+			options: Options{CookieDomain: "techaro.lol", JWTAudience: "forge"},
+			want:    "forge",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := spawnAnubis(t, tt.options)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+
+			if got := srv.jwtAudience(req); got != tt.want {
+				t.Errorf("wanted audience %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,441 @@
+// Package keyring holds the keys Anubis signs and verifies its tokens with.
+// One key signs new tokens; every key verifies tokens carrying its key ID, so
+// tokens signed before a key was rotated out stay valid until they expire.
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultCheckInterval is how often a Keyring loaded from a directory looks
+// for changed keys.
+const DefaultCheckInterval = 30 * time.Second
+
+var (
+	ErrNoSigningKey    = errors.New("keyring: no key that can sign tokens")
+	ErrDuplicateKeyID  = errors.New("keyring: duplicate key ID")
+	ErrUnknownKeyID    = errors.New("keyring: token was signed with an unknown key")
+	ErrWrongAlgorithm  = errors.New("keyring: token algorithm does not match its key")
+	ErrInvalidKey      = errors.New("keyring: key is invalid")
+	ErrVerifyOnlyKey   = errors.New("keyring: active key can't sign")
+	ErrMultipleKeyKind = errors.New("keyring: key must be exactly one of Ed25519, Ed25519Public or HS512")
+)
+
+// Key is a single signing or verification key.
+type Key struct {
+	// ID is put in the kid header of tokens signed with this key.
+	ID string
+
+	// Exactly one of these is set. Keys with only Ed25519Public can verify
+	// tokens but not sign them.
+	Ed25519       ed25519.PrivateKey
+	Ed25519Public ed25519.PublicKey
+	HS512         []byte
+}
+
+// Ed25519Key creates a signing key with an ID derived from its public key, so
+// that every instance using the same key agrees on its ID.
+func Ed25519Key(priv ed25519.PrivateKey) *Key {
+	pub := priv.Public().(ed25519.PublicKey)
+	return &Key{ID: deriveID("ed25519", pub), Ed25519: priv}
+}
+
+// HS512Key creates a signing key with an ID derived from the secret.
+func HS512Key(secret []byte) *Key {
+	return &Key{ID: deriveID("hs512", secret), HS512: secret}
+}
+
+func deriveID(kind string, material []byte) string {
+	sum := sha256.Sum256(append([]byte(kind+":"), material...))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (k *Key) valid() error {
+	kinds := 0
+	if k.Ed25519 != nil {
+		kinds++
+		if len(k.Ed25519) != ed25519.PrivateKeySize {
+			return fmt.Errorf("%w: %s: ed25519 private key is %d bytes", ErrInvalidKey, k.ID, len(k.Ed25519))
+		}
+	}
+	if k.Ed25519Public != nil {
+		kinds++
+		if len(k.Ed25519Public) != ed25519.PublicKeySize {
+			return fmt.Errorf("%w: %s: ed25519 public key is %d bytes", ErrInvalidKey, k.ID, len(k.Ed25519Public))
+		}
+	}
+	if k.HS512 != nil {
+		kinds++
+		if len(k.HS512) == 0 {
+			return fmt.Errorf("%w: %s: HS512 secret is empty", ErrInvalidKey, k.ID)
+		}
+	}
+
+	if kinds != 1 {
+		return fmt.Errorf("%w: %s", ErrMultipleKeyKind, k.ID)
+	}
+
+	if k.ID == "" {
+		return fmt.Errorf("%w: key ID is empty", ErrInvalidKey)
+	}
+
+	return nil
+}
+
+// CanSign reports whether k can sign new tokens.
+func (k *Key) CanSign() bool {
+	return k.Ed25519 != nil || k.HS512 != nil
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	if k.HS512 != nil {
+		return jwt.SigningMethodHS512
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+func (k *Key) signingKey() any {
+	if k.HS512 != nil {
+		return k.HS512
+	}
+	return k.Ed25519
+}
+
+func (k *Key) verificationKey() any {
+	switch {
+	case k.HS512 != nil:
+		return k.HS512
+	case k.Ed25519 != nil:
+		return k.Ed25519.Public()
+	default:
+		return k.Ed25519Public
+	}
+}
+
+// Keyring signs tokens with its active key and verifies them with whichever
+// key signed them.
+type Keyring struct {
+	lg            *slog.Logger
+	dir           string
+	checkInterval time.Duration
+	nextCheck     atomic.Int64 // unix nanoseconds
+
+	// Overridden in tests.
+	now func() time.Time
+
+	mu          sync.RWMutex
+	fingerprint string
+	active      *Key
+	keys        map[string]*Key
+}
+
+// New creates a Keyring that signs with active and also verifies tokens
+// signed with any of verifyOnly.
+func New(active *Key, verifyOnly ...*Key) (*Keyring, error) {
+	result := &Keyring{now: time.Now}
+
+	if err := result.set(active, append([]*Key{active}, verifyOnly...)); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (kr *Keyring) set(active *Key, keys []*Key) error {
+	if active == nil {
+		return ErrNoSigningKey
+	}
+
+	if !active.CanSign() {
+		return fmt.Errorf("%w: %s", ErrVerifyOnlyKey, active.ID)
+	}
+
+	byID := make(map[string]*Key, len(keys))
+	for _, k := range keys {
+		if err := k.valid(); err != nil {
+			return err
+		}
+
+		if _, ok := byID[k.ID]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateKeyID, k.ID)
+		}
+		byID[k.ID] = k
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.active = active
+	kr.keys = byID
+
+	return nil
+}
+
+// LoadDir creates a Keyring from the keys in dir. The file name without its
+// extension is the key ID, and the extension says what the file holds:
+//
+//   - .key: a hex-encoded ed25519 private key seed
+//   - .pub: a hex-encoded ed25519 public key, which can only verify tokens
+//   - .hs512: an HS512 secret
+//
+// The signing key whose ID sorts last is the active key. Other files and
+// hidden files are ignored. The directory is checked for changes at most
+// once every checkInterval when the keyring is used.
+func LoadDir(dir string, checkInterval time.Duration, lg *slog.Logger) (*Keyring, error) {
+	if checkInterval <= 0 {
+		checkInterval = DefaultCheckInterval
+	}
+
+	result := &Keyring{
+		lg:            lg,
+		dir:           dir,
+		checkInterval: checkInterval,
+		now:           time.Now,
+	}
+
+	if err := result.reload(); err != nil {
+		return nil, err
+	}
+	result.nextCheck.Store(result.now().Add(checkInterval).UnixNano())
+
+	return result, nil
+}
+
+// dirFingerprint summarizes the names, sizes and modification times of the
+// files in dir so that changes can be noticed without reading every key.
+func dirFingerprint(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		// Stat through symlinks, secrets mounted by Kubernetes are symlinks.
+		st, err := os.Stat(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+
+		fmt.Fprintf(&sb, "%s|%d|%d\n", e.Name(), st.Size(), st.ModTime().UnixNano())
+	}
+
+	return sb.String(), nil
+}
+
+func (kr *Keyring) reload() error {
+	fingerprint, err := dirFingerprint(kr.dir)
+	if err != nil {
+		return fmt.Errorf("keyring: can't read key directory: %w", err)
+	}
+
+	kr.mu.RLock()
+	unchanged := kr.active != nil && fingerprint == kr.fingerprint
+	kr.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	entries, err := os.ReadDir(kr.dir)
+	if err != nil {
+		return fmt.Errorf("keyring: can't read key directory: %w", err)
+	}
+
+	var keys []*Key
+	var active *Key
+
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		ext := filepath.Ext(name)
+		id := strings.TrimSuffix(name, ext)
+
+		switch ext {
+		case ".key", ".pub", ".hs512":
+		default:
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(kr.dir, name))
+		if err != nil {
+			return fmt.Errorf("keyring: can't read key %s: %w", name, err)
+		}
+		data = []byte(strings.TrimSpace(string(data)))
+
+		k := &Key{ID: id}
+		switch ext {
+		case ".key":
+			seed, err := hex.DecodeString(string(data))
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return fmt.Errorf("%w: %s must hold a hex-encoded %d byte ed25519 seed", ErrInvalidKey, name, ed25519.SeedSize)
+			}
+			k.Ed25519 = ed25519.NewKeyFromSeed(seed)
+		case ".pub":
+			pub, err := hex.DecodeString(string(data))
+			if err != nil {
+				return fmt.Errorf("%w: %s must hold a hex-encoded ed25519 public key", ErrInvalidKey, name)
+			}
+			k.Ed25519Public = pub
+		case ".hs512":
+			k.HS512 = data
+		}
+
+		keys = append(keys, k)
+		if k.CanSign() && (active == nil || k.ID > active.ID) {
+			active = k
+		}
+	}
+
+	// Sort so that error messages are stable.
+	slices.SortFunc(keys, func(a, b *Key) int { return strings.Compare(a.ID, b.ID) })
+
+	if err := kr.set(active, keys); err != nil {
+		return err
+	}
+
+	kr.mu.Lock()
+	kr.fingerprint = fingerprint
+	kr.mu.Unlock()
+
+	if kr.lg != nil {
+		kr.lg.Info("loaded signing keys", "dir", kr.dir, "active", active.ID, "keys", len(keys))
+	}
+
+	return nil
+}
+
+// maybeReload reloads the key directory if it is time to check it again. If
+// the new keys can't be loaded, the old ones stay in use.
+func (kr *Keyring) maybeReload() {
+	if kr.dir == "" {
+		return
+	}
+
+	now := kr.now()
+	next := kr.nextCheck.Load()
+	if now.UnixNano() < next || !kr.nextCheck.CompareAndSwap(next, now.Add(kr.checkInterval).UnixNano()) {
+		return
+	}
+
+	if err := kr.reload(); err != nil && kr.lg != nil {
+		kr.lg.Error("can't reload signing keys, keeping the old ones", "dir", kr.dir, "err", err)
+	}
+}
+
+// ActiveKeyID returns the ID of the key new tokens are signed with.
+func (kr *Keyring) ActiveKeyID() string {
+	kr.maybeReload()
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.active.ID
+}
+
+// Sign signs claims with the active key and sets the kid header to its ID.
+func (kr *Keyring) Sign(claims jwt.Claims) (string, error) {
+	return kr.SignType(claims, "JWT")
+}
+
+// SignType is like Sign, but sets the typ header to typ so that verifiers can
+// tell different kinds of tokens signed with the same keys apart.
+func (kr *Keyring) SignType(claims jwt.Claims, typ string) (string, error) {
+	kr.maybeReload()
+
+	kr.mu.RLock()
+	active := kr.active
+	kr.mu.RUnlock()
+
+	token := jwt.NewWithClaims(active.method(), claims)
+	token.Header["kid"] = active.ID
+	token.Header["typ"] = typ
+
+	return token.SignedString(active.signingKey())
+}
+
+// Keyfunc finds the key that verifies token. Tokens without a kid header were
+// signed before keyrings existed and are checked against the active key.
+func (kr *Keyring) Keyfunc(token *jwt.Token) (any, error) {
+	kr.maybeReload()
+
+	kr.mu.RLock()
+	k := kr.active
+	if kid, ok := token.Header["kid"].(string); ok {
+		k, ok = kr.keys[kid]
+		if !ok {
+			kr.mu.RUnlock()
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, kid)
+		}
+	}
+	kr.mu.RUnlock()
+
+	if token.Method.Alg() != k.method().Alg() {
+		return nil, fmt.Errorf("%w: %s is not %s", ErrWrongAlgorithm, token.Method.Alg(), k.method().Alg())
+	}
+
+	return k.verificationKey(), nil
+}
+
+// JWK is an ed25519 public key in JSON Web Key form (RFC 8037).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+// JWKS is a JSON Web Key Set (RFC 7517).
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public halves of every ed25519 key in the keyring, sorted
+// by key ID. HS512 secrets can't be published, so they are left out.
+func (kr *Keyring) JWKS() JWKS {
+	kr.maybeReload()
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	result := JWKS{Keys: []JWK{}}
+	for _, k := range kr.keys {
+		if k.HS512 != nil {
+			continue
+		}
+
+		result.Keys = append(result.Keys, JWK{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(k.verificationKey().(ed25519.PublicKey)),
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: jwt.SigningMethodEdDSA.Alg(),
+		})
+	}
+
+	slices.SortFunc(result.Keys, func(a, b JWK) int { return strings.Compare(a.KeyID, b.KeyID) })
+
+	return result
+}
@@ -0,0 +1,239 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newEd25519(t *testing.T, id string) *Key {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Key{ID: id, Ed25519: priv}
+}
+
+func sign(t *testing.T, kr *Keyring) string {
+	t.Helper()
+
+	tok, err := kr.Sign(jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tok
+}
+
+func verify(kr *Keyring, tok string) error {
+	_, err := jwt.Parse(tok, kr.Keyfunc, jwt.WithExpirationRequired())
+	return err
+}
+
+func TestRotation(t *testing.T) {
+	old := newEd25519(t, "2026-01")
+	next := newEd25519(t, "2026-02")
+	hmac := HS512Key([]byte("hunter2"))
+
+	before, err := New(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken := sign(t, before)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(oldToken, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header["kid"] != "2026-01" {
+		t.Errorf("wanted kid 2026-01, got: %v", parsed.Header["kid"])
+	}
+
+	// The old key is retired but can still verify.
+	after, err := New(next, &Key{ID: old.ID, Ed25519Public: old.Ed25519.Public().(ed25519.PublicKey)}, hmac)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verify(after, oldToken); err != nil {
+		t.Errorf("tokens signed by retired keys should verify: %v", err)
+	}
+
+	if err := verify(after, sign(t, after)); err != nil {
+		t.Errorf("tokens signed by the active key should verify: %v", err)
+	}
+
+	if after.ActiveKeyID() != "2026-02" {
+		t.Errorf("wrong active key: %s", after.ActiveKeyID())
+	}
+
+	// Once the key is removed, its tokens stop working.
+	removed, err := New(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(removed, oldToken); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("wanted %v, got: %v", ErrUnknownKeyID, err)
+	}
+}
+
+func TestLegacyTokens(t *testing.T) {
+	k := newEd25519(t, "legacy")
+	kr, err := New(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens from before keyrings have no kid header.
+	tok, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()}).SignedString(k.Ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verify(kr, tok); err != nil {
+		t.Errorf("tokens without a kid should be verified with the active key: %v", err)
+	}
+}
+
+func TestWrongAlgorithm(t *testing.T) {
+	k := HS512Key([]byte("hunter2"))
+	kr, err := New(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix()})
+	tok.Header["kid"] = k.ID
+	signed, err := tok.SignedString(k.HS512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verify(kr, signed); !errors.Is(err, ErrWrongAlgorithm) {
+		t.Errorf("wanted %v, got: %v", ErrWrongAlgorithm, err)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	pub := newEd25519(t, "pub").Ed25519.Public().(ed25519.PublicKey)
+
+	for _, tt := range []struct {
+		name   string
+		active *Key
+		others []*Key
+		err    error
+	}{
+		{name: "no active key", err: ErrNoSigningKey},
+		{name: "verify only active key", active: &Key{ID: "pub", Ed25519Public: pub}, err: ErrVerifyOnlyKey},
+		{name: "duplicate IDs", active: HS512Key([]byte("a")), others: []*Key{HS512Key([]byte("a"))}, err: ErrDuplicateKeyID},
+		{name: "two kinds", active: &Key{ID: "both", HS512: []byte("a"), Ed25519Public: pub}, err: ErrMultipleKeyKind},
+		{name: "short public key", active: HS512Key([]byte("a")), others: []*Key{{ID: "short", Ed25519Public: pub[:8]}}, err: ErrInvalidKey},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.active, tt.others...); !errors.Is(err, tt.err) {
+				t.Errorf("wanted %v, got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func writeKey(t *testing.T, dir, name, contents string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(contents+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func seedHex(t *testing.T) string {
+	t.Helper()
+	return hex.EncodeToString(newEd25519(t, "").Ed25519.Seed())
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "2026-01.key", seedHex(t))
+	writeKey(t, dir, "README.md", "not a key")
+	writeKey(t, dir, ".hidden.key", "not hex")
+
+	kr, err := LoadDir(dir, time.Minute, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	kr.now = func() time.Time { return now }
+
+	if kr.ActiveKeyID() != "2026-01" {
+		t.Fatalf("wrong active key: %s", kr.ActiveKeyID())
+	}
+	oldToken := sign(t, kr)
+
+	// Rotate: add a newer key, the old one stays for verification.
+	writeKey(t, dir, "2026-02.key", seedHex(t))
+
+	if kr.ActiveKeyID() != "2026-01" {
+		t.Error("the directory should not be checked again before the interval")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if kr.ActiveKeyID() != "2026-02" {
+		t.Errorf("the newest key should become active, got: %s", kr.ActiveKeyID())
+	}
+
+	if err := verify(kr, oldToken); err != nil {
+		t.Errorf("tokens signed by the old key should still verify: %v", err)
+	}
+
+	// A broken key doesn't replace the working keys.
+	writeKey(t, dir, "2026-03.key", "not hex")
+	now = now.Add(2 * time.Minute)
+	if kr.ActiveKeyID() != "2026-02" {
+		t.Errorf("a broken reload should keep the old keys, got: %s", kr.ActiveKeyID())
+	}
+}
+
+func TestLoadDirWithoutSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "old.pub", hex.EncodeToString(newEd25519(t, "").Ed25519.Public().(ed25519.PublicKey)))
+
+	if _, err := LoadDir(dir, 0, nil); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("wanted %v, got: %v", ErrNoSigningKey, err)
+	}
+
+	if _, err := LoadDir(filepath.Join(dir, "missing"), 0, nil); err == nil {
+		t.Error("a missing directory should be an error")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	signer := newEd25519(t, "b")
+	kr, err := New(signer, HS512Key([]byte("hunter2")), &Key{ID: "a", Ed25519Public: newEd25519(t, "").Ed25519.Public().(ed25519.PublicKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := kr.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("HS512 secrets must not be published, got: %+v", jwks.Keys)
+	}
+
+	if jwks.Keys[0].KeyID != "a" || jwks.Keys[1].KeyID != "b" {
+		t.Errorf("keys should be sorted by ID, got: %+v", jwks.Keys)
+	}
+
+	if jwks.Keys[1].X != base64.RawURLEncoding.EncodeToString(signer.Ed25519.Public().(ed25519.PublicKey)) {
+		t.Errorf("wrong public key: %s", jwks.Keys[1].X)
+	}
+}
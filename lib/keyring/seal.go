@@ -0,0 +1,128 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// sealInfo separates the keys derived for sealing from any other use of the
+// signing keys. Changing it makes every sealed token unreadable.
+const sealInfo = "anubis sealed token v1"
+
+var (
+	ErrCantSeal = errors.New("keyring: key can't seal tokens")
+	ErrBadToken = errors.New("keyring: sealed token is malformed or was tampered with")
+)
+
+// sealKey derives the AES-256 key that k seals tokens with. Keys with only
+// an ed25519 public key have no secret to derive it from.
+func (k *Key) sealKey() ([]byte, error) {
+	var secret []byte
+	switch {
+	case k.HS512 != nil:
+		secret = k.HS512
+	case k.Ed25519 != nil:
+		secret = k.Ed25519.Seed()
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrCantSeal, k.ID)
+	}
+
+	return hkdf.Key(sha256.New, secret, nil, sealInfo, 32)
+}
+
+func (k *Key) aead() (cipher.AEAD, error) {
+	key, err := k.sealKey()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts and authenticates plaintext with a key derived from the
+// active key, so that only instances of Anubis sharing the keyring can read
+// it. additionalData is authenticated but not included in the token; Open
+// must be given the same. The token is URL-safe.
+//
+// A token is laid out as the length of the key ID, the key ID, the nonce
+// and the ciphertext, encoded as unpadded base64url.
+func (kr *Keyring) Seal(plaintext, additionalData []byte) (string, error) {
+	kr.maybeReload()
+
+	kr.mu.RLock()
+	active := kr.active
+	kr.mu.RUnlock()
+
+	if len(active.ID) > 255 {
+		return "", fmt.Errorf("%w: %s: key ID is longer than 255 bytes", ErrCantSeal, active.ID)
+	}
+
+	aead, err := active.aead()
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 0, 1+len(active.ID)+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	buf = append(buf, byte(len(active.ID)))
+	buf = append(buf, active.ID...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	buf = append(buf, nonce...)
+
+	buf = aead.Seal(buf, nonce, plaintext, additionalData)
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Open decrypts a token made by Seal with whichever key sealed it.
+func (kr *Keyring) Open(token string, additionalData []byte) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) == 0 {
+		return nil, ErrBadToken
+	}
+
+	idLen := int(data[0])
+	if len(data) < 1+idLen {
+		return nil, ErrBadToken
+	}
+	kid, rest := string(data[1:1+idLen]), data[1+idLen:]
+
+	kr.maybeReload()
+
+	kr.mu.RLock()
+	k, ok := kr.keys[kid]
+	kr.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, kid)
+	}
+
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrBadToken
+	}
+
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrBadToken
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,74 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	old := newEd25519(t, "2026-01")
+	next := HS512Key([]byte("hunter2"))
+
+	before, err := New(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := before.Seal([]byte("challenge"), []byte("rule"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := before.Open(tok, []byte("rule"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "challenge" {
+		t.Errorf("wanted challenge, got: %q", got)
+	}
+
+	if _, err := before.Open(tok, []byte("other rule")); !errors.Is(err, ErrBadToken) {
+		t.Errorf("token opened with the wrong additional data, got: %v", err)
+	}
+
+	raw, _ := base64.RawURLEncoding.DecodeString(tok)
+	raw[len(raw)-1] ^= 1
+	if _, err := before.Open(base64.RawURLEncoding.EncodeToString(raw), []byte("rule")); !errors.Is(err, ErrBadToken) {
+		t.Errorf("tampered token opened, got: %v", err)
+	}
+
+	for _, bad := range []string{"", "!!!", "AQ", "BWhlbGxv"} {
+		if _, err := before.Open(bad, nil); err == nil {
+			t.Errorf("malformed token %q opened", bad)
+		}
+	}
+
+	// Tokens sealed before a rotation can be opened as long as the old key
+	// is still in the keyring.
+	after, err := New(next, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := after.Open(tok, []byte("rule")); err != nil {
+		t.Errorf("tokens sealed by retired keys should open: %v", err)
+	}
+
+	removed, err := New(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := removed.Open(tok, []byte("rule")); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("wanted %v, got: %v", ErrUnknownKeyID, err)
+	}
+
+	// Public keys can verify signatures, but not open sealed tokens.
+	public, err := New(next, &Key{ID: old.ID, Ed25519Public: old.Ed25519.Public().(ed25519.PublicKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := public.Open(tok, []byte("rule")); !errors.Is(err, ErrCantSeal) {
+		t.Errorf("wanted %v, got: %v", ErrCantSeal, err)
+	}
+}
@@ -130,13 +130,14 @@ func (sl *SimpleLocalizer) GetLang() string {
 	return tag.String()
 }
 
-// GetLocalizer creates a localizer based on the request's Accept-Language header or forcedLanguage option
+// GetLocalizer creates a localizer based on the request's Accept-Language header or
+// the forced language in the anubis.Settings attached to the request context
 func GetLocalizer(r *http.Request) *SimpleLocalizer {
 	var localizer *i18n.Localizer
-	if anubis.ForcedLanguage == "" {
+	if forcedLanguage := anubis.SettingsFromContext(r.Context()).ForcedLanguage; forcedLanguage == "" {
 		localizer = NewLocalizationService().GetLocalizerFromRequest(r)
 	} else {
-		localizer = NewLocalizationService().GetLocalizer(anubis.ForcedLanguage)
+		localizer = NewLocalizationService().GetLocalizer(forcedLanguage)
 	}
 	return &SimpleLocalizer{Localizer: localizer}
 }
@@ -21,6 +21,10 @@ import (
 type Server struct {
 	Config *config.Metrics
 	Log    *slog.Logger
+
+	// JWKS serves the token verification keys at /.well-known/jwks.json when
+	// Config.JWKS is set.
+	JWKS http.Handler
 }
 
 func (s *Server) Run(ctx context.Context, done func()) {
@@ -44,9 +48,19 @@ func (s *Server) run(ctx context.Context, lg *slog.Logger) error {
 	}
 
 	mux.Handle("/metrics", promhttp.Handler())
+	if s.Config.JWKS && s.JWKS != nil {
+		mux.Handle("GET /.well-known/jwks.json", s.JWKS)
+	}
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		st, ok := internal.GetHealth("anubis")
-		if !ok {
+		// Other services, such as the storage backend, can be checked with
+		// ?service=store.
+		svc := r.URL.Query().Get("service")
+		if svc == "" {
+			svc = "anubis"
+		}
+
+		st, ok := internal.GetHealth(svc)
+		if !ok && svc == "anubis" {
 			slog.ErrorContext(r.Context(), "health service anubis does not exist, file a bug")
 		}
 
@@ -0,0 +1,144 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/lib/challenge"
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/policy"
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ErrTooManyChallenges is returned when a client already has as many unsolved
+// challenges as it is allowed and none of them can be handed out again.
+var ErrTooManyChallenges = errors.New("lib: client has too many outstanding challenges")
+
+var (
+	challengeStoreOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_challenge_store_operations_total",
+		Help: "What happened when a challenge was requested: a new one was stored or sealed, an outstanding one was reissued or the client was limited",
+	}, []string{"result"})
+
+	outstandingChallengesPerClient = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "anubis_outstanding_challenges_per_client",
+		Help:    "How many unsolved challenges a client had when it asked for another one",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	})
+)
+
+// outstandingKey returns the prefix of the store keys that track the
+// unsolved challenges of the client that made r.
+func (s *Server) outstandingKey(r *http.Request) string {
+	ip := r.Header.Get("X-Real-Ip")
+
+	if s.policy.Challenges.LimitBy != config.LimitByIP {
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			if prefix, ok := internal.ClampIP(addr); ok {
+				ip = prefix.String()
+			}
+		}
+	}
+
+	return "challenges-outstanding:" + ip
+}
+
+// outstandingSlot returns the store key of the i-th of the max_outstanding
+// slots under key. Each slot holds the ID of one unsolved challenge and
+// expires with it.
+func outstandingSlot(key string, i int) string {
+	return key + ":" + strconv.Itoa(i)
+}
+
+// claimOutstanding stores id in the first free slot under key. Slots are
+// claimed with an atomic set-if-not-exists, so that concurrent requests from
+// the same client can't go over the limit. It returns how many slots were
+// taken before it found a free one, which is also the index of the slot it
+// claimed, and whether it found one.
+func (s *Server) claimOutstanding(ctx context.Context, key, id string) (int, bool, error) {
+	limit := s.policy.Challenges.MaxOutstanding
+
+	for i := range limit {
+		ok, err := store.SetNX(ctx, s.store, outstandingSlot(key, i), []byte(id), s.policy.Challenges.TTLDuration())
+		if err != nil {
+			return i, false, err
+		}
+		if ok {
+			return i, true, nil
+		}
+	}
+
+	return limit, false, nil
+}
+
+// loadOutstanding returns the IDs of the unexpired challenges tracked under
+// key.
+func (s *Server) loadOutstanding(ctx context.Context, key string) []string {
+	var result []string
+
+	for i := range s.policy.Challenges.MaxOutstanding {
+		id, err := s.store.Get(ctx, outstandingSlot(key, i))
+		if err != nil {
+			continue
+		}
+		result = append(result, string(id))
+	}
+
+	return result
+}
+
+// reissuableChallenge finds an outstanding challenge that can be handed to
+// the client that made r again instead of issuing a new one. It has to be
+// unsolved, issued to the same client and still be what rule would issue.
+func (s *Server) reissuableChallenge(ctx context.Context, r *http.Request, outstanding []string, rule *policy.Bot) *challenge.Challenge {
+	j := store.JSON[challenge.Challenge]{Underlying: s.store}
+
+	for _, id := range outstanding {
+		chall, err := j.Get(ctx, "challenge:"+id)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case chall.Spent,
+			chall.Method != rule.Challenge.Algorithm,
+			chall.PolicyRuleHash != rule.Hash(),
+			chall.Difficulty < s.adaptive.Difficulty(rule.Challenge.Algorithm, rule.Challenge.Difficulty),
+			chall.Metadata["X-Real-Ip"] != r.Header.Get("X-Real-Ip"),
+			chall.Metadata["User-Agent"] != r.Header.Get("User-Agent"):
+			continue
+		}
+
+		return &chall
+	}
+
+	return nil
+}
+
+// forgetOutstanding frees the slot of a challenge once it has been solved or
+// couldn't be issued. The slot is the one recorded in the challenge when it
+// was claimed, as the client may solve it from another IP address than the
+// one it was issued to.
+func (s *Server) forgetOutstanding(ctx context.Context, lg *slog.Logger, chall *challenge.Challenge) {
+	if chall.OutstandingSlot == "" {
+		return
+	}
+
+	// The slot expires with the challenge and may have been claimed by
+	// another one since.
+	current, err := s.store.Get(ctx, chall.OutstandingSlot)
+	if err != nil || string(current) != chall.ID {
+		return
+	}
+
+	if err := s.store.Delete(ctx, chall.OutstandingSlot); err != nil && !errors.Is(err, store.ErrNotFound) {
+		lg.DebugContext(ctx, "can't free outstanding challenge slot", "key", chall.OutstandingSlot, "err", err)
+	}
+}
@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/TecharoHQ/anubis/lib/challenge"
+	"github.com/TecharoHQ/anubis/lib/challenge/remote"
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/policy"
+)
+
+// newChallengePlugins connects to the challenge plugins set in pol. They
+// belong to one Server, so servers with different policies can use different
+// plugins under the same name.
+func newChallengePlugins(pol *policy.ParsedConfig) (map[string]*remote.Impl, error) {
+	result := make(map[string]*remote.Impl, len(pol.ChallengePlugins))
+
+	for _, cp := range pol.ChallengePlugins {
+		impl, err := remote.New(cp)
+		if err != nil {
+			closeChallengePlugins(result)
+			return nil, err
+		}
+		result[cp.Name] = impl
+	}
+
+	return result, nil
+}
+
+func closeChallengePlugins(plugins map[string]*remote.Impl) error {
+	var errs []error
+	for _, impl := range plugins {
+		errs = append(errs, impl.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// challengeImpl returns the challenge method called name, either a built-in
+// one or one of the server's plugins.
+func (s *Server) challengeImpl(name string) (challenge.Impl, bool) {
+	if impl, ok := challenge.Get(name); ok {
+		return impl, true
+	}
+
+	impl, ok := s.challengePlugins[name]
+	return impl, ok
+}
+
+// challengeMethods returns the names of every challenge method the server
+// can use.
+func (s *Server) challengeMethods() []string {
+	result := challenge.Methods()
+	for name := range s.challengePlugins {
+		result = append(result, name)
+	}
+	slices.Sort(result)
+	return result
+}
+
+// checkChallengeMethods makes sure that every rule of pol uses a challenge
+// method that is built in or set up as a plugin.
+func checkChallengeMethods(pol *policy.ParsedConfig) error {
+	var errs []error
+
+	for _, b := range pol.Bots {
+		if b.Challenge == nil {
+			continue
+		}
+
+		if _, ok := challenge.Get(b.Challenge.Algorithm); ok {
+			continue
+		}
+
+		if slices.ContainsFunc(pol.ChallengePlugins, func(cp config.ChallengePlugin) bool { return cp.Name == b.Challenge.Algorithm }) {
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("%w %s", policy.ErrChallengeRuleHasWrongAlgorithm, b.Challenge.Algorithm))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,300 @@
+// Package apikey lets automated clients skip challenges by presenting a named
+// API key or an HMAC-signed token.
+package apikey
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/policy/checker"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ErrEmptyKey   = errors.New("apikey: key material is empty")
+	ErrUnknownKey = errors.New("apikey: no key with this name")
+)
+
+const (
+	ResultAllowed      = "allowed"
+	ResultExpired      = "expired"
+	ResultBadSignature = "bad_signature"
+	ResultOutOfScope   = "out_of_scope"
+)
+
+var keyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "anubis_api_key_requests_total",
+	Help: "Requests that presented a configured API key, by key name and whether the key was accepted",
+}, []string{"key", "result"})
+
+type key struct {
+	name    string
+	kind    string
+	secret  []byte
+	expires time.Time
+	paths   []string
+}
+
+// Set holds the configured keys and knows where clients put them.
+//
+// A nil *Set is valid and matches nothing.
+type Set struct {
+	header         string
+	subrequestMode bool
+	byHash         map[[sha256.Size]byte]*key
+	byName         map[string]*key
+
+	// Overridden in tests.
+	now func() time.Time
+}
+
+// New loads the key material referenced by cfg. Keys read from files or the
+// environment are hashed immediately so that only HMAC secrets are kept in
+// memory in the clear.
+func New(cfg config.APIKeys, subrequestMode bool) (*Set, error) {
+	result := &Set{
+		header:         cfg.Header,
+		subrequestMode: subrequestMode,
+		byHash:         map[[sha256.Size]byte]*key{},
+		byName:         map[string]*key{},
+		now:            time.Now,
+	}
+
+	var errs []error
+
+	for _, kc := range cfg.Keys {
+		k := &key{
+			name:    kc.Name,
+			kind:    kc.Type,
+			expires: kc.ExpiresAt(),
+			paths:   kc.Paths,
+		}
+		if k.kind == "" {
+			k.kind = config.APIKeyStatic
+		}
+		result.byName[k.name] = k
+
+		var material []byte
+		switch {
+		case kc.Hash != "":
+			// Already validated in config.
+			h, _ := kc.HashBytes()
+			result.byHash[[sha256.Size]byte(h)] = k
+			continue
+		case kc.File != "":
+			data, err := os.ReadFile(kc.File)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("apikey: can't read key %s: %w", kc.Name, err))
+				continue
+			}
+			material = []byte(strings.TrimSpace(string(data)))
+		case kc.Env != "":
+			material = []byte(strings.TrimSpace(os.Getenv(kc.Env)))
+		}
+
+		if len(material) == 0 {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrEmptyKey, kc.Name))
+			continue
+		}
+
+		switch k.kind {
+		case config.APIKeyHMAC:
+			k.secret = material
+		default:
+			result.byHash[sha256.Sum256(material)] = k
+		}
+	}
+
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return result, nil
+}
+
+// Checker returns a bot rule condition that matches requests carrying a
+// valid, unexpired token for the key called name on a path it is scoped to.
+func (s *Set) Checker(name string) (checker.Impl, error) {
+	k, ok := s.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, name)
+	}
+
+	return &keyChecker{set: s, key: k, hash: internal.FastHash("apikey::" + name)}, nil
+}
+
+// Strip removes key material from r so that it is not passed upstream. The
+// Authorization header is only removed when it holds one of the configured
+// keys, so upstream authentication that uses it keeps working.
+func (s *Set) Strip(r *http.Request) {
+	if s == nil {
+		return
+	}
+
+	if s.header != "" {
+		r.Header.Del(s.header)
+	}
+
+	if token, ok := bearerToken(r); ok && s.identify(token) != nil {
+		r.Header.Del("Authorization")
+	}
+}
+
+// tokens returns every token r presents.
+func (s *Set) tokens(r *http.Request) []string {
+	var result []string
+
+	if token, ok := bearerToken(r); ok {
+		result = append(result, token)
+	}
+
+	if s.header != "" {
+		if token := strings.TrimSpace(r.Header.Get(s.header)); token != "" {
+			result = append(result, token)
+		}
+	}
+
+	return result
+}
+
+// identify finds the key a token claims to belong to without checking that
+// the token is valid for it.
+func (s *Set) identify(token string) *key {
+	if name, _, ok := strings.Cut(token, "."); ok {
+		if k, ok := s.byName[name]; ok && k.kind == config.APIKeyHMAC {
+			return k
+		}
+	}
+
+	return s.byHash[sha256.Sum256([]byte(token))]
+}
+
+// verify reports whether token is acceptable for k on the path of r.
+func (s *Set) verify(k *key, token string, r *http.Request) string {
+	now := s.now()
+
+	if !k.expires.IsZero() && now.After(k.expires) {
+		return ResultExpired
+	}
+
+	if k.kind == config.APIKeyHMAC {
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 {
+			return ResultBadSignature
+		}
+
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+			return ResultBadSignature
+		}
+
+		exp, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || now.Unix() >= exp {
+			return ResultExpired
+		}
+	}
+
+	if !inScope(k.paths, s.requestPath(r)) {
+		return ResultOutOfScope
+	}
+
+	return ResultAllowed
+}
+
+func (s *Set) requestPath(r *http.Request) string {
+	if s.subrequestMode {
+		originalURL := r.Header.Get("X-Original-Uri")
+		if originalURL == "" {
+			originalURL = r.Header.Get("X-Forwarded-Uri")
+		}
+		if parsed, err := url.ParseRequestURI(originalURL); err == nil {
+			return parsed.Path
+		}
+	}
+
+	return r.URL.Path
+}
+
+// Sign creates an HMAC token for the key called name that is valid until
+// expires. It is meant for tests and tooling that mint tokens.
+func Sign(name string, secret []byte, expires time.Time) string {
+	payload := name + "." + strconv.FormatInt(expires.Unix(), 10)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// inScope reports whether p is under one of the path prefixes in scopes.
+// Prefixes match whole path segments, so /api matches /api and /api/v1 but
+// not /apix. No scopes means every path.
+func inScope(scopes []string, p string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+
+	p = path.Clean("/" + p)
+
+	for _, scope := range scopes {
+		scope = strings.TrimSuffix(scope, "/")
+		if scope == "" || p == scope || strings.HasPrefix(p, scope+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+type keyChecker struct {
+	set  *Set
+	key  *key
+	hash string
+}
+
+func (kc *keyChecker) Check(r *http.Request) (bool, error) {
+	for _, token := range kc.set.tokens(r) {
+		k := kc.set.identify(token)
+		if k != kc.key {
+			continue
+		}
+
+		result := kc.set.verify(k, token, r)
+		keyRequests.WithLabelValues(k.name, result).Inc()
+
+		if result == ResultAllowed {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (kc *keyChecker) Hash() string {
+	return kc.hash
+}
@@ -0,0 +1,176 @@
+package apikey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/config"
+)
+
+func hashOf(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func newTestSet(t *testing.T, cfg config.APIKeys) *Set {
+	t.Helper()
+
+	if err := cfg.Valid(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(cfg, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	return s
+}
+
+func check(t *testing.T, s *Set, name string, r *http.Request) bool {
+	t.Helper()
+
+	c, err := s.Checker(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := c.Check(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ok
+}
+
+func TestStaticKeys(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "monitoring.key")
+	if err := os.WriteFile(fname, []byte("monitoring-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("APIKEY_TEST_PARTNER", "partner-key")
+
+	s := newTestSet(t, config.APIKeys{
+		Header: "X-Anubis-Key",
+		Keys: []config.APIKey{
+			{Name: "ci", Hash: hashOf("ci-key"), Paths: []string{"/api"}, Action: config.RuleAllow},
+			{Name: "monitoring", File: fname, Action: config.RuleAllow},
+			{Name: "partner", Env: "APIKEY_TEST_PARTNER", Action: config.RuleAllow},
+			{Name: "old", Hash: hashOf("old-key"), Expires: "2025-01-01T00:00:00Z", Action: config.RuleAllow},
+		},
+	})
+
+	for _, tt := range []struct {
+		name   string
+		key    string
+		path   string
+		header string
+		value  string
+		want   bool
+	}{
+		{name: "bearer in scope", key: "ci", path: "/api/v1/builds", header: "Authorization", value: "Bearer ci-key", want: true},
+		{name: "lowercase scheme", key: "ci", path: "/api", header: "Authorization", value: "bearer ci-key", want: true},
+		{name: "custom header", key: "ci", path: "/api/v1", header: "X-Anubis-Key", value: "ci-key", want: true},
+		{name: "out of scope", key: "ci", path: "/admin", header: "Authorization", value: "Bearer ci-key"},
+		{name: "prefix is not a segment", key: "ci", path: "/apix", header: "Authorization", value: "Bearer ci-key"},
+		{name: "dot dot escapes scope", key: "ci", path: "/api/../admin", header: "Authorization", value: "Bearer ci-key"},
+		{name: "wrong key", key: "ci", path: "/api", header: "Authorization", value: "Bearer nope"},
+		{name: "other key's checker", key: "monitoring", path: "/api", header: "Authorization", value: "Bearer ci-key"},
+		{name: "key from file", key: "monitoring", path: "/", header: "Authorization", value: "Bearer monitoring-key", want: true},
+		{name: "key from env", key: "partner", path: "/", header: "X-Anubis-Key", value: "partner-key", want: true},
+		{name: "expired key", key: "old", path: "/", header: "Authorization", value: "Bearer old-key"},
+		{name: "basic auth", key: "ci", path: "/api", header: "Authorization", value: "Basic Y2kta2V5"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.URL.Path = tt.path
+			r.Header.Set(tt.header, tt.value)
+
+			if got := check(t, s, tt.key, r); got != tt.want {
+				t.Errorf("wanted match %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHMACKeys(t *testing.T) {
+	t.Setenv("APIKEY_TEST_SECRET", "hunter2")
+
+	s := newTestSet(t, config.APIKeys{
+		Keys: []config.APIKey{
+			{Name: "partner", Type: config.APIKeyHMAC, Env: "APIKEY_TEST_SECRET", Action: config.RuleWeigh, Weight: &config.Weight{Adjust: -5}},
+		},
+	})
+	now := s.now()
+
+	for _, tt := range []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{name: "valid", token: Sign("partner", []byte("hunter2"), now.Add(time.Hour)), want: true},
+		{name: "expired token", token: Sign("partner", []byte("hunter2"), now.Add(-time.Hour))},
+		{name: "wrong secret", token: Sign("partner", []byte("hunter3"), now.Add(time.Hour))},
+		{name: "tampered expiry", token: "partner.99999999999." + "AAAA"},
+		{name: "unknown name", token: Sign("someone", []byte("hunter2"), now.Add(time.Hour))},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+
+			if got := check(t, s, "partner", r); got != tt.want {
+				t.Errorf("wanted match %v, got: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStrip(t *testing.T) {
+	s := newTestSet(t, config.APIKeys{
+		Header: "X-Anubis-Key",
+		Keys: []config.APIKey{
+			{Name: "ci", Hash: hashOf("ci-key"), Action: config.RuleAllow},
+		},
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer ci-key")
+	r.Header.Set("X-Anubis-Key", "anything")
+	s.Strip(r)
+
+	if r.Header.Get("Authorization") != "" || r.Header.Get("X-Anubis-Key") != "" {
+		t.Errorf("key material was not stripped: %v", r.Header)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer upstream-token")
+	s.Strip(r)
+
+	if r.Header.Get("Authorization") == "" {
+		t.Error("Authorization headers that don't hold an API key must be passed upstream")
+	}
+
+	var nilSet *Set
+	nilSet.Strip(r)
+}
+
+func TestMissingKeyMaterial(t *testing.T) {
+	_, err := New(config.APIKeys{
+		Keys: []config.APIKey{
+			{Name: "ci", Env: "APIKEY_TEST_DOES_NOT_EXIST", Action: config.RuleAllow},
+		},
+	}, false)
+
+	if !errors.Is(err, ErrEmptyKey) {
+		t.Errorf("wanted %v, got: %v", ErrEmptyKey, err)
+	}
+}
@@ -0,0 +1,23 @@
+package checker
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerCtxKey struct{}
+
+// WithLogger makes lg the logger of checkers built with ctx.
+func WithLogger(ctx context.Context, lg *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, lg)
+}
+
+// Logger returns the logger set with WithLogger, or slog.Default() if ctx does
+// not carry one.
+func Logger(ctx context.Context) *slog.Logger {
+	if lg, ok := ctx.Value(loggerCtxKey{}).(*slog.Logger); ok && lg != nil {
+		return lg
+	}
+
+	return slog.Default()
+}
@@ -0,0 +1,111 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/TecharoHQ/anubis/internal"
+)
+
+var (
+	ErrUnknownType = errors.New("checker: unknown matcher type")
+
+	registry map[string]Factory = map[string]Factory{}
+	regLock  sync.RWMutex
+)
+
+// Factory creates checkers from the raw JSON parameters of a matcher in a
+// policy file. Valid is called when the policy file is loaded so that bad
+// parameters are reported before any requests are served.
+type Factory interface {
+	Build(ctx context.Context, params json.RawMessage) (Impl, error)
+	Valid(params json.RawMessage) error
+}
+
+// Register makes a matcher type available to policy files under the given name.
+func Register(name string, impl Factory) {
+	regLock.Lock()
+	defer regLock.Unlock()
+
+	registry[name] = impl
+}
+
+func Get(name string) (Factory, bool) {
+	regLock.RLock()
+	defer regLock.RUnlock()
+	result, ok := registry[name]
+	return result, ok
+}
+
+func Methods() []string {
+	regLock.RLock()
+	defer regLock.RUnlock()
+	var result []string
+	for method := range registry {
+		result = append(result, method)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Build validates params and creates a checker of the named type. The hash of
+// the result only depends on the type name and the parameters, so cookies
+// bound to a rule stay valid across restarts no matter how the checker
+// implements Hash.
+func Build(ctx context.Context, name string, params json.RawMessage) (Impl, error) {
+	fac, ok := Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, name)
+	}
+
+	if err := fac.Valid(params); err != nil {
+		return nil, err
+	}
+
+	impl, err := fac.Build(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("checker: can't build matcher %q: %w", name, err)
+	}
+
+	canonical, err := canonicalJSON(params)
+	if err != nil {
+		return nil, fmt.Errorf("checker: can't hash parameters for matcher %q: %w", name, err)
+	}
+
+	return &registered{
+		Impl: impl,
+		hash: internal.FastHash(name + "::" + canonical),
+	}, nil
+}
+
+// canonicalJSON re-encodes data so that whitespace and key order don't change
+// the hash of a matcher.
+func canonicalJSON(data json.RawMessage) (string, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return "", nil
+	}
+
+	var val any
+	if err := json.Unmarshal(data, &val); err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+
+	return string(result), nil
+}
+
+type registered struct {
+	Impl
+	hash string
+}
+
+func (r *registered) Hash() string { return r.hash }
@@ -0,0 +1,117 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+var errNoUserAgent = errors.New("checker: test matcher needs a user agent")
+
+type userAgentFactory struct{}
+
+type userAgentParams struct {
+	UserAgent string `json:"user_agent"`
+}
+
+func (userAgentFactory) Build(_ context.Context, data json.RawMessage) (Impl, error) {
+	var params userAgentParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	return Func(func(r *http.Request) (bool, error) {
+		return r.UserAgent() == params.UserAgent, nil
+	}), nil
+}
+
+func (userAgentFactory) Valid(data json.RawMessage) error {
+	var params userAgentParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+
+	if params.UserAgent == "" {
+		return errNoUserAgent
+	}
+
+	return nil
+}
+
+func TestRegistryBuild(t *testing.T) {
+	Register("test-user-agent", userAgentFactory{})
+
+	for _, tt := range []struct {
+		name   string
+		kind   string
+		params string
+		err    error
+	}{
+		{
+			name:   "valid",
+			kind:   "test-user-agent",
+			params: `{"user_agent": "Mozilla/5.0"}`,
+		},
+		{
+			name:   "invalid params",
+			kind:   "test-user-agent",
+			params: `{}`,
+			err:    errNoUserAgent,
+		},
+		{
+			name:   "unknown type",
+			kind:   "does-not-exist",
+			params: `{}`,
+			err:    ErrUnknownType,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			impl, err := Build(t.Context(), tt.kind, json.RawMessage(tt.params))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("wanted error %v, got: %v", tt.err, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			req.Header.Set("User-Agent", "Mozilla/5.0")
+
+			ok, err := impl.Check(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Error("matcher should have matched")
+			}
+		})
+	}
+}
+
+func TestRegistryHashIsStable(t *testing.T) {
+	Register("test-user-agent", userAgentFactory{})
+
+	build := func(params string) string {
+		t.Helper()
+		impl, err := Build(t.Context(), "test-user-agent", json.RawMessage(params))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return impl.Hash()
+	}
+
+	a := build(`{"user_agent": "Mozilla/5.0", "extra": 1}`)
+	b := build(`{"extra":1,"user_agent":"Mozilla/5.0"}`)
+	c := build(`{"user_agent": "curl"}`)
+
+	if a != b {
+		t.Errorf("hash changed with key order or whitespace: %s != %s", a, b)
+	}
+
+	if a == c {
+		t.Errorf("different parameters have the same hash: %s", a)
+	}
+}
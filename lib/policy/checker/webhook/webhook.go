@@ -0,0 +1,436 @@
+// Package webhook implements a bot rule matcher that asks an external HTTP
+// service whether a request matches.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/lib/policy/checker"
+	"github.com/TecharoHQ/anubis/lib/store"
+)
+
+func init() {
+	checker.Register("webhook", Factory{})
+}
+
+const (
+	// OnErrorNoMatch makes the matcher not match when the webhook fails.
+	OnErrorNoMatch = "nomatch"
+
+	// OnErrorMatch makes the matcher match when the webhook fails.
+	OnErrorMatch = "match"
+
+	// DefaultTimeout is how long Anubis waits for the webhook to respond when
+	// no timeout is configured.
+	DefaultTimeout = 500 * time.Millisecond
+
+	// maxResponseSize is the largest response body Anubis will read from a
+	// webhook.
+	maxResponseSize = 64 * 1024
+)
+
+var (
+	ErrNoURL            = errors.New("webhook.Config: no URL defined")
+	ErrBadURL           = errors.New("webhook.Config: URL is invalid")
+	ErrBadTimeout       = errors.New("webhook.Config: timeout is invalid")
+	ErrBadCacheTTL      = errors.New("webhook.Config: cache_ttl is invalid")
+	ErrBadOnError       = errors.New("webhook.Config: on_error must be \"match\" or \"nomatch\"")
+	ErrBadFingerprint   = errors.New("webhook.Config: unknown fingerprint component")
+	ErrBadStatus        = errors.New("webhook: unexpected response status")
+	ErrInvalidResponse  = errors.New("webhook: response must set match or weight")
+	ErrResponseTooLarge = errors.New("webhook: response is too large")
+)
+
+var (
+	defaultFingerprint = []string{"ip", "user_agent", "path"}
+	fingerprintFields  = []string{"ip", "user_agent", "method", "host", "path", "header:<name>"}
+)
+
+var (
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "anubis_webhook_checker_request_duration_seconds",
+		Help:    "How long webhook checker requests take",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"webhook"})
+
+	requestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_webhook_checker_errors_total",
+		Help: "The total number of failed webhook checker requests",
+	}, []string{"webhook", "reason"})
+
+	cacheResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_webhook_checker_cache_total",
+		Help: "The total number of webhook checker cache lookups",
+	}, []string{"webhook", "result"})
+)
+
+// Config is what Anubis unmarshals from the matcher "params" JSON.
+type Config struct {
+	// URL is where the request description is POSTed to.
+	URL string `json:"url"`
+
+	// Name identifies the webhook in metrics and logs. It defaults to the
+	// scheme and host of URL so that credentials in the URL are not exposed.
+	Name string `json:"name,omitempty"`
+
+	// Timeout is the longest Anubis waits for the webhook, in Go duration format.
+	Timeout string `json:"timeout,omitempty"`
+
+	// OnError is what the matcher reports when the webhook can't be reached
+	// or returns an invalid response, OnErrorNoMatch (the default) or
+	// OnErrorMatch. Whether matching lets the request through depends on the
+	// action of the rule.
+	OnError string `json:"on_error,omitempty"`
+
+	// Headers is the list of request headers that are sent to the webhook.
+	Headers []string `json:"headers,omitempty"`
+
+	// CacheTTL is how long webhook responses are cached, in Go duration
+	// format. Responses are not cached if this is not set.
+	CacheTTL string `json:"cache_ttl,omitempty"`
+
+	// Fingerprint is the list of request fields that responses are cached by.
+	Fingerprint []string `json:"fingerprint,omitempty"`
+}
+
+func (c Config) Valid() error {
+	var errs []error
+
+	if c.URL == "" {
+		errs = append(errs, ErrNoURL)
+	} else if u, err := url.Parse(c.URL); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %v", ErrBadURL, err))
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		errs = append(errs, fmt.Errorf("%w: scheme must be http or https, got: %q", ErrBadURL, u.Scheme))
+	}
+
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrBadTimeout, c.Timeout))
+		}
+	}
+
+	if c.CacheTTL != "" {
+		if d, err := time.ParseDuration(c.CacheTTL); err != nil || d < 0 {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrBadCacheTTL, c.CacheTTL))
+		}
+	}
+
+	switch c.OnError {
+	case "", OnErrorNoMatch, OnErrorMatch:
+	default:
+		errs = append(errs, fmt.Errorf("%w, got: %q", ErrBadOnError, c.OnError))
+	}
+
+	for _, field := range c.Fingerprint {
+		if !validFingerprintField(field) {
+			errs = append(errs, fmt.Errorf("%w: %q, must be one of %s", ErrBadFingerprint, field, strings.Join(fingerprintFields, ", ")))
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+func validFingerprintField(field string) bool {
+	switch field {
+	case "ip", "user_agent", "method", "host", "path":
+		return true
+	}
+
+	name, ok := strings.CutPrefix(field, "header:")
+	return ok && name != ""
+}
+
+type Factory struct{}
+
+func (Factory) Valid(data json.RawMessage) error {
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	return cfg.Valid()
+}
+
+func (Factory) Build(ctx context.Context, data json.RawMessage) (checker.Impl, error) {
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Valid(); err != nil {
+		return nil, err
+	}
+
+	return New(ctx, cfg)
+}
+
+// Checker POSTs a description of each request to a webhook and uses the
+// response to decide if the request matches.
+type Checker struct {
+	cfg         Config
+	client      *http.Client
+	cache       *store.JSON[Response]
+	cacheTTL    time.Duration
+	fingerprint []string
+	hash        string
+	name        string
+	logger      *slog.Logger
+}
+
+// New creates a Checker. If ctx carries a store (see store.With) and
+// cfg.CacheTTL is set, responses are cached in it. Failures are logged to the
+// logger ctx carries (see checker.WithLogger).
+func New(ctx context.Context, cfg Config) (*Checker, error) {
+	if err := cfg.Valid(); err != nil {
+		return nil, err
+	}
+
+	timeout := DefaultTimeout
+	if cfg.Timeout != "" {
+		timeout, _ = time.ParseDuration(cfg.Timeout) // validated in Valid()
+	}
+
+	if cfg.OnError == "" {
+		cfg.OnError = OnErrorNoMatch
+	}
+
+	name := cfg.Name
+	if name == "" {
+		u, _ := url.Parse(cfg.URL) // validated in Valid()
+		name = u.Scheme + "://" + u.Host
+	}
+
+	result := &Checker{
+		cfg:         cfg,
+		client:      &http.Client{Timeout: timeout},
+		fingerprint: cfg.Fingerprint,
+		name:        name,
+		logger:      checker.Logger(ctx).With("checker", "webhook", "webhook", name),
+	}
+
+	if len(result.fingerprint) == 0 {
+		result.fingerprint = defaultFingerprint
+	}
+
+	if cfg.CacheTTL != "" {
+		result.cacheTTL, _ = time.ParseDuration(cfg.CacheTTL) // validated in Valid()
+	}
+
+	// The name only labels metrics and logs, renaming a webhook should not
+	// invalidate cookies.
+	hashCfg := cfg
+	hashCfg.Name = ""
+	cfgJSON, err := json.Marshal(hashCfg)
+	if err != nil {
+		return nil, err
+	}
+	result.hash = internal.FastHash(string(cfgJSON))
+
+	if st, ok := store.FromContext(ctx); ok && result.cacheTTL > 0 {
+		result.cache = &store.JSON[Response]{
+			Underlying: st,
+			Prefix:     "webhook:" + result.hash + ":",
+		}
+	}
+
+	return result, nil
+}
+
+// Request is the JSON body that is POSTed to the webhook.
+type Request struct {
+	IP        string            `json:"ip"`
+	UserAgent string            `json:"user_agent"`
+	Method    string            `json:"method"`
+	Host      string            `json:"host"`
+	Path      string            `json:"path"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+// Response is the JSON body the webhook replies with. At least one of Match
+// or Weight must be set. When Weight is set and the rule action is WEIGH, it
+// replaces the weight adjustment from the policy file. A non-zero Weight
+// without Match counts as a match.
+type Response struct {
+	Match  *bool `json:"match,omitempty"`
+	Weight *int  `json:"weight,omitempty"`
+}
+
+func (c *Checker) Check(r *http.Request) (bool, error) {
+	ctx := r.Context()
+	lg := internal.GetRequestLogger(c.logger, r)
+
+	var key string
+	if c.cache != nil {
+		key = c.fingerprintFor(r)
+		resp, err := c.cache.Get(ctx, key)
+		switch {
+		case err == nil:
+			cacheResults.WithLabelValues(c.name, "hit").Inc()
+			return c.apply(ctx, resp), nil
+		case errors.Is(err, store.ErrNotFound):
+			cacheResults.WithLabelValues(c.name, "miss").Inc()
+		default:
+			cacheResults.WithLabelValues(c.name, "error").Inc()
+			lg.DebugContext(ctx, "can't read cached webhook response", "err", err)
+		}
+	}
+
+	resp, err := c.call(r)
+	if err != nil {
+		lg.WarnContext(ctx, "webhook checker failed", "err", err, "on_error", c.cfg.OnError)
+		return c.cfg.OnError == OnErrorMatch, nil
+	}
+
+	if c.cache != nil {
+		if err := c.cache.Set(ctx, key, resp, c.cacheTTL); err != nil {
+			lg.DebugContext(ctx, "can't cache webhook response", "err", err)
+		}
+	}
+
+	return c.apply(ctx, resp), nil
+}
+
+func (c *Checker) Hash() string { return c.hash }
+
+func (c *Checker) apply(ctx context.Context, resp Response) bool {
+	var match bool
+
+	if resp.Match != nil {
+		match = *resp.Match
+	}
+
+	if resp.Weight != nil {
+		if resp.Match == nil {
+			match = *resp.Weight != 0
+		}
+
+		if match {
+			checker.SetWeight(ctx, *resp.Weight)
+		}
+	}
+
+	return match
+}
+
+func (c *Checker) call(r *http.Request) (Response, error) {
+	body, err := json.Marshal(c.describe(r))
+	if err != nil {
+		return Response{}, err
+	}
+
+	// Don't let a client that hangs up stop the webhook call, the answer may
+	// be cached for the next request.
+	req, err := http.NewRequestWithContext(context.WithoutCancel(r.Context()), http.MethodPost, c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return Response{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	t0 := time.Now()
+	resp, err := c.client.Do(req)
+	requestDuration.WithLabelValues(c.name).Observe(time.Since(t0).Seconds())
+	if err != nil {
+		reason := "transport"
+		var nerr net.Error
+		if errors.As(err, &nerr) && nerr.Timeout() {
+			reason = "timeout"
+		}
+		requestErrors.WithLabelValues(c.name, reason).Inc()
+		return Response{}, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		requestErrors.WithLabelValues(c.name, "status").Inc()
+		return Response{}, fmt.Errorf("%w: %d", ErrBadStatus, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		requestErrors.WithLabelValues(c.name, "transport").Inc()
+		return Response{}, err
+	}
+
+	if len(data) > maxResponseSize {
+		requestErrors.WithLabelValues(c.name, "decode").Inc()
+		return Response{}, ErrResponseTooLarge
+	}
+
+	var result Response
+	if err := json.Unmarshal(data, &result); err != nil {
+		requestErrors.WithLabelValues(c.name, "decode").Inc()
+		return Response{}, err
+	}
+
+	if result.Match == nil && result.Weight == nil {
+		requestErrors.WithLabelValues(c.name, "decode").Inc()
+		return Response{}, ErrInvalidResponse
+	}
+
+	return result, nil
+}
+
+func (c *Checker) describe(r *http.Request) Request {
+	result := Request{
+		IP:        r.Header.Get("X-Real-Ip"),
+		UserAgent: r.UserAgent(),
+		Method:    r.Method,
+		Host:      r.Host,
+		Path:      r.URL.Path,
+	}
+
+	if len(c.cfg.Headers) != 0 {
+		result.Headers = map[string]string{}
+		for _, name := range c.cfg.Headers {
+			if val := r.Header.Get(name); val != "" {
+				result.Headers[http.CanonicalHeaderKey(name)] = val
+			}
+		}
+	}
+
+	return result
+}
+
+func (c *Checker) fingerprintFor(r *http.Request) string {
+	var sb strings.Builder
+
+	for _, field := range c.fingerprint {
+		var val string
+		switch field {
+		case "ip":
+			val = r.Header.Get("X-Real-Ip")
+		case "user_agent":
+			val = r.UserAgent()
+		case "method":
+			val = r.Method
+		case "host":
+			val = r.Host
+		case "path":
+			val = r.URL.Path
+		default:
+			val = r.Header.Get(strings.TrimPrefix(field, "header:"))
+		}
+
+		fmt.Fprintf(&sb, "%s=%q\n", field, val)
+	}
+
+	return internal.FastHash(sb.String())
+}
@@ -0,0 +1,31 @@
+package checker
+
+import "context"
+
+type weightCtxKey struct{}
+
+// WeightOverride lets a checker decide how much a matching WEIGH rule adjusts
+// the weight of a request instead of the static adjustment in the policy file.
+type WeightOverride struct {
+	Set    bool
+	Adjust int
+}
+
+// Reset clears any override set by a previous rule.
+func (wo *WeightOverride) Reset() {
+	wo.Set = false
+	wo.Adjust = 0
+}
+
+func WithWeightOverride(ctx context.Context, wo *WeightOverride) context.Context {
+	return context.WithValue(ctx, weightCtxKey{}, wo)
+}
+
+// SetWeight records the weight adjustment for the rule that is currently being
+// checked. It does nothing if the context does not carry a WeightOverride.
+func SetWeight(ctx context.Context, adjust int) {
+	if wo, ok := ctx.Value(weightCtxKey{}).(*WeightOverride); ok {
+		wo.Set = true
+		wo.Adjust = adjust
+	}
+}
@@ -7,19 +7,24 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"slices"
 	"strings"
 	"sync/atomic"
 
 	"github.com/TecharoHQ/anubis/internal"
 	"github.com/TecharoHQ/anubis/internal/dns"
 	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/policy/apikey"
 	"github.com/TecharoHQ/anubis/lib/policy/checker"
 	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/degraded"
+	"github.com/TecharoHQ/anubis/lib/store/instrumented"
 	"github.com/TecharoHQ/anubis/lib/thoth"
 	"github.com/fahedouch/go-logrotate"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
+	_ "github.com/TecharoHQ/anubis/lib/policy/checker/webhook"
 	_ "github.com/TecharoHQ/anubis/lib/store/all"
 )
 
@@ -65,15 +70,37 @@ type ParsedConfig struct {
 	ThothClient       *thoth.Client
 	LogASN            bool
 	NeedJA4H          bool
+	ChallengePlugins  []config.ChallengePlugin
+
+	AdaptiveDifficulty *config.AdaptiveDifficulty
+	ChallengeBinding   []config.ChallengeBinding
+	Challenges         config.Challenges
+	APIKeys            *apikey.Set
+	UpstreamHeaders    *config.UpstreamHeaders
+
+	// NeedASN is set when anything needs the ASN or country of clients
+	// looked up, not only ASN logging.
+	NeedASN bool
 }
 
 func newParsedConfig(orig *config.Config) *ParsedConfig {
-	return &ParsedConfig{
+	result := &ParsedConfig{
 		orig:        orig,
 		OpenGraph:   orig.OpenGraph,
 		StatusCodes: orig.StatusCodes,
 		Metrics:     orig.Metrics,
+
+		ChallengePlugins:   orig.ChallengePlugins,
+		AdaptiveDifficulty: orig.AdaptiveDifficulty,
+		ChallengeBinding:   orig.ChallengeBinding,
+		UpstreamHeaders:    orig.UpstreamHeaders,
 	}
+
+	if orig.Challenges != nil {
+		result.Challenges = *orig.Challenges
+	}
+
+	return result
 }
 
 func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDifficulty int, logLevel string, subrequestMode bool) (*ParsedConfig, error) {
@@ -89,6 +116,7 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 	result := newParsedConfig(c)
 	result.DefaultDifficulty = defaultDifficulty
 	result.LogASN = c.Logging.LogASN
+	result.NeedASN = result.LogASN || result.UpstreamHeaders.Includes(config.UpstreamASN) || result.UpstreamHeaders.Includes(config.UpstreamCountry)
 	if hasThothClient {
 		result.ThothClient = tc
 	}
@@ -118,6 +146,8 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 
 	if result.LogASN && !hasThothClient {
 		lg.WarnContext(ctx, "logging.asn is enabled but no Thoth client is configured; ASN logging and metrics will be skipped. Please read https://anubis.techaro.lol/docs/admin/thoth for more information")
+	} else if result.NeedASN && !hasThothClient {
+		lg.WarnContext(ctx, "upstream_headers includes asn or country but no Thoth client is configured; these headers will not be sent. Please read https://anubis.techaro.lol/docs/admin/thoth for more information")
 	}
 
 	stFac, ok := store.Get(c.Store.Backend)
@@ -127,12 +157,20 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 		if err != nil {
 			validationErrs = append(validationErrs, err)
 		} else {
-			result.Store = store
+			result.Store = instrumented.New(store, c.Store.Backend)
+			if c.Store.Degraded != nil {
+				result.Store = degraded.New(ctx, result.Store, *c.Store.Degraded)
+			}
 		}
 	case false:
 		validationErrs = append(validationErrs, config.ErrUnknownStoreBackend)
 	}
 
+	if result.Store != nil {
+		// Let checkers built from matchers cache things in the configured store.
+		ctx = store.With(ctx, result.Store)
+	}
+
 	result.DnsCache = dns.NewDNSCache(result.orig.DNSTTL.Forward, result.orig.DNSTTL.Reverse, result.Store)
 	result.Dns = dns.New(ctx, result.DnsCache)
 
@@ -194,6 +232,15 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 			}
 		}
 
+		for _, m := range b.Matchers {
+			c, err := checker.Build(checker.WithLogger(ctx, result.Logger.With("rule", b.Name)), m.Type, m.Params)
+			if err != nil {
+				validationErrs = append(validationErrs, fmt.Errorf("while processing rule %s matcher %s: %w", b.Name, m.Type, err))
+			} else {
+				cl = append(cl, c)
+			}
+		}
+
 		if b.ASNs != nil {
 			if !hasThothClient {
 				lg.WarnContext(ctx, "You have specified a Thoth specific check but you have no Thoth client configured. Please read https://anubis.techaro.lol/docs/admin/thoth for more information", "check", "asn", "settings", b.ASNs)
@@ -226,6 +273,8 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 			if parsedBot.Challenge.Algorithm == "slow" {
 				lg.WarnContext(ctx, "use of deprecated algorithm \"slow\" detected, please update this to \"fast\" when possible", "name", parsedBot.Name)
 			}
+
+			setChallengeDefaults(parsedBot.Challenge)
 		}
 
 		if b.Weight != nil {
@@ -241,6 +290,18 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 		result.Bots = append(result.Bots, parsedBot)
 	}
 
+	if c.APIKeys != nil {
+		keyBots, set, err := parseAPIKeys(*c.APIKeys, defaultDifficulty, subrequestMode)
+		if err != nil {
+			validationErrs = append(validationErrs, err)
+		} else {
+			// Keys are checked before every other rule so that a valid key
+			// can't be denied or challenged by a broader rule.
+			result.Bots = append(keyBots, result.Bots...)
+			result.APIKeys = set
+		}
+	}
+
 	for _, t := range c.Thresholds {
 		if t.Challenge != nil && t.Challenge.Algorithm == "slow" {
 			lg.WarnContext(ctx, "use of deprecated algorithm \"slow\" detected, please update this to \"fast\" when possible", "name", t.Name)
@@ -259,6 +320,10 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 			t.Challenge.Difficulty = defaultDifficulty
 		}
 
+		if t.Challenge != nil {
+			setChallengeDefaults(t.Challenge)
+		}
+
 		threshold, err := ParsedThresholdFromConfig(t)
 		if err != nil {
 			validationErrs = append(validationErrs, fmt.Errorf("can't compile threshold config for %s: %w", t.Name, err))
@@ -273,11 +338,44 @@ func ParseConfig(ctx context.Context, fin io.Reader, fname string, defaultDiffic
 	}
 
 	result.DNSBL = c.DNSBL
-	result.NeedJA4H = configReferencesJA4H(c.Bots)
+	result.NeedJA4H = configReferencesJA4H(c.Bots) || slices.Contains(c.ChallengeBinding, config.BindingJA4H)
 
 	return result, nil
 }
 
+// parseAPIKeys turns every configured API key into a bot rule that matches
+// requests presenting that key.
+func parseAPIKeys(cfg config.APIKeys, defaultDifficulty int, subrequestMode bool) ([]Bot, *apikey.Set, error) {
+	set, err := apikey.New(cfg, subrequestMode)
+	if err != nil {
+		return nil, nil, fmt.Errorf("while loading api keys: %w", err)
+	}
+
+	var result []Bot
+	for _, k := range cfg.Keys {
+		c, err := set.Checker(k.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		b := Bot{
+			Name:   "api-key/" + k.Name,
+			Action: k.Action,
+			Weight: k.Weight,
+			Rules:  c,
+			Challenge: &config.ChallengeRules{
+				Difficulty: defaultDifficulty,
+				Algorithm:  "fast",
+			},
+		}
+		b.hash = b.Hash()
+
+		result = append(result, b)
+	}
+
+	return result, set, nil
+}
+
 // configReferencesJA4H reports whether any bot rule references the JA4H
 // fingerprint header, either through a headers_regex key or a CEL expression.
 // Computing the JA4H fingerprint for every request is relatively expensive, so
@@ -301,3 +399,11 @@ func configReferencesJA4H(bots []config.BotConfig) bool {
 
 	return false
 }
+
+// setChallengeDefaults fills in the tunables of memory-hard algorithms so that
+// clients are sent the same values that the server validates against.
+func setChallengeDefaults(cr *config.ChallengeRules) {
+	if cr.Algorithm == "scrypt" {
+		cr.Memory, cr.Iterations = cr.ScryptParams()
+	}
+}
@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// authTimeClaim records when the client solved the challenge a token was
+// first issued for. It is carried over when the token is renewed.
+const authTimeClaim = "auth_time"
+
+// sessionStart returns when the client solved the challenge behind a token.
+// Renewed tokens carry it in auth_time, since their iat is when they were
+// renewed. Tokens that were never renewed may not have auth_time, in which
+// case iat is used.
+func sessionStart(claims jwt.MapClaims) (time.Time, bool) {
+	if v, ok := claims[authTimeClaim].(float64); ok {
+		return time.Unix(int64(v), 0), true
+	}
+
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		return iat.Time, true
+	}
+
+	return time.Time{}, false
+}
+
+// maybeRenewToken replaces the client's token with one that expires later if
+// sliding renewal is enabled and the token is old enough. Renewed tokens keep
+// every claim of the original token, and never outlive the maximum session
+// lifetime counted from when the challenge was solved.
+func (s *Server) maybeRenewToken(w http.ResponseWriter, r *http.Request, lg *slog.Logger, claims jwt.MapClaims, cookiePath string) {
+	if s.opts.CookieRenewAfter <= 0 {
+		return
+	}
+
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return
+	}
+
+	now := time.Now()
+	renewAfter := time.Duration(float64(s.opts.CookieExpiration) * s.opts.CookieRenewAfter)
+	if now.Sub(iat.Time) < renewAfter {
+		return
+	}
+
+	authTime, _ := sessionStart(claims)
+
+	expires := now.Add(s.opts.CookieExpiration)
+	if s.opts.CookieMaxLifetime > 0 {
+		if limit := authTime.Add(s.opts.CookieMaxLifetime); expires.After(limit) {
+			expires = limit
+		}
+	}
+
+	current, err := claims.GetExpirationTime()
+	if err != nil || current == nil || !expires.After(current.Time) {
+		// The session can't be extended any further.
+		tokenRenewals.WithLabelValues("at_max_lifetime").Inc()
+		return
+	}
+
+	renewed := jwt.MapClaims{}
+	for k, v := range claims {
+		renewed[k] = v
+	}
+	renewed[authTimeClaim] = authTime.Unix()
+	renewed["exp"] = expires.Unix()
+
+	token, err := s.signJWT(r, renewed)
+	if err != nil {
+		lg.ErrorContext(r.Context(), "can't renew token", "err", err)
+		return
+	}
+
+	s.SetCookie(w, CookieOpts{Path: cookiePath, Host: r.Host, Value: token, Expiry: expires.Sub(now)})
+	tokenRenewals.WithLabelValues("renewed").Inc()
+	lg.DebugContext(r.Context(), "renewed token", "expires", expires, "auth_time", authTime)
+}
@@ -0,0 +1,312 @@
+// Package revocation keeps track of Anubis tokens that must no longer be
+// accepted, such as tokens minted in bulk by a solver farm.
+//
+// Tokens can be revoked by the ID of the challenge they were issued for, by
+// the IP address presenting them, or by when they were issued. Revocations
+// by IP address and time only affect tokens issued before the revocation, so
+// clients can get a new token by solving another challenge.
+package revocation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	ErrNeedsOneTarget      = errors.New("revocation: must set exactly one of challenge_id, ip or issued_before")
+	ErrBadIP               = errors.New("revocation: ip is not a valid IP address")
+	ErrIssuedBeforeIsLater = errors.New("revocation: issued_before must not be in the future")
+)
+
+const (
+	ReasonChallenge    = "challenge"
+	ReasonIP           = "ip"
+	ReasonIssuedBefore = "issued_before"
+)
+
+const (
+	challengePrefix = "revoked:challenge:"
+	ipPrefix        = "revoked:ip:"
+	beforeKey       = "revoked:before"
+)
+
+// BeforeRefreshInterval is how often the issued_before cutoff is read from
+// the store. It applies to every token, so it is kept in memory instead of
+// being read for every request. Cutoffs set through another instance of
+// Anubis take up to this long to apply here.
+const BeforeRefreshInterval = 10 * time.Second
+
+var rejectedTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "anubis_revoked_tokens_total",
+	Help: "Tokens that were rejected because they were revoked, by the kind of revocation that matched",
+}, []string{"reason"})
+
+// Request describes the tokens to revoke, or to stop revoking. Exactly one of
+// ChallengeID, IP and IssuedBefore is set.
+type Request struct {
+	// ChallengeID revokes the token issued for this challenge.
+	ChallengeID string `json:"challenge_id,omitempty"`
+
+	// IP revokes every token this address presents that was issued up to
+	// the moment of the revocation.
+	IP string `json:"ip,omitempty"`
+
+	// IssuedBefore revokes every token issued up to this time, to the second.
+	IssuedBefore *time.Time `json:"issued_before,omitempty"`
+}
+
+func (r Request) Valid() error {
+	targets := 0
+	if r.ChallengeID != "" {
+		targets++
+	}
+	if r.IP != "" {
+		targets++
+		if _, err := netip.ParseAddr(r.IP); err != nil {
+			return fmt.Errorf("%w: %q", ErrBadIP, r.IP)
+		}
+	}
+	if r.IssuedBefore != nil {
+		targets++
+		if r.IssuedBefore.After(time.Now()) {
+			return fmt.Errorf("%w: %s", ErrIssuedBeforeIsLater, r.IssuedBefore.Format(time.RFC3339))
+		}
+	}
+
+	if targets != 1 {
+		return ErrNeedsOneTarget
+	}
+
+	return nil
+}
+
+// List stores revocations in a store.Interface so that every instance sharing
+// the store honors them. Entries expire once every token they could match has
+// expired on its own.
+type List struct {
+	store         store.Interface
+	tokenLifetime time.Duration
+
+	// Overridden in tests.
+	now func() time.Time
+
+	// The issued_before cutoff as of beforeFetched.
+	mu            sync.Mutex
+	cachedBefore  time.Time
+	beforeFetched time.Time
+	beforeGroup   singleflight.Group
+}
+
+// New creates a List in st for tokens that are valid for tokenLifetime.
+func New(st store.Interface, tokenLifetime time.Duration) *List {
+	return &List{store: st, tokenLifetime: tokenLifetime, now: time.Now}
+}
+
+// Revoke revokes the tokens described by req.
+func (l *List) Revoke(ctx context.Context, req Request) error {
+	if err := req.Valid(); err != nil {
+		return err
+	}
+
+	now := l.now()
+	value := []byte(strconv.FormatInt(now.Unix(), 10))
+
+	switch {
+	case req.ChallengeID != "":
+		return l.store.Set(ctx, challengePrefix+req.ChallengeID, value, l.tokenLifetime)
+	case req.IP != "":
+		return l.store.Set(ctx, ipPrefix+canonicalIP(req.IP), value, l.tokenLifetime)
+	default:
+		// Only ever move the cutoff forward, so a late request can't undo a
+		// more recent revocation.
+		if current, err := l.before(ctx); err != nil {
+			return err
+		} else if !current.IsZero() && !req.IssuedBefore.After(current) {
+			return nil
+		}
+
+		ttl := req.IssuedBefore.Add(l.tokenLifetime).Sub(now)
+		if ttl <= 0 {
+			// Every token issued before then has already expired.
+			return nil
+		}
+
+		if err := l.store.Set(ctx, beforeKey, []byte(strconv.FormatInt(req.IssuedBefore.Unix(), 10)), ttl); err != nil {
+			return err
+		}
+
+		l.cacheBefore(time.Unix(req.IssuedBefore.Unix(), 0))
+		return nil
+	}
+}
+
+// Lift removes the revocation described by req.
+func (l *List) Lift(ctx context.Context, req Request) error {
+	if err := req.Valid(); err != nil {
+		return err
+	}
+
+	var key string
+	switch {
+	case req.ChallengeID != "":
+		key = challengePrefix + req.ChallengeID
+	case req.IP != "":
+		key = ipPrefix + canonicalIP(req.IP)
+	default:
+		key = beforeKey
+	}
+
+	if err := l.store.Delete(ctx, key); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	if key == beforeKey {
+		l.cacheBefore(time.Time{})
+	}
+
+	return nil
+}
+
+// Check returns why the token issued for challengeID at issuedAt and presented
+// by ip is revoked, or "" if it is not.
+func (l *List) Check(ctx context.Context, challengeID, ip string, issuedAt time.Time) (string, error) {
+	reason, err := l.check(ctx, challengeID, ip, issuedAt)
+	if reason != "" {
+		rejectedTokens.WithLabelValues(reason).Inc()
+	}
+
+	return reason, err
+}
+
+func (l *List) check(ctx context.Context, challengeID, ip string, issuedAt time.Time) (string, error) {
+	before, err := l.cachedCutoff(ctx)
+	if err != nil {
+		return "", err
+	}
+	// Tokens only carry whole seconds, so tokens issued in the same second as
+	// a revocation are revoked too.
+	if !before.IsZero() && !issuedAt.After(before) {
+		return ReasonIssuedBefore, nil
+	}
+
+	// Look up both keys at once so that a slow store only adds one round
+	// trip to every request.
+	var (
+		g                errgroup.Group
+		challengeRevoked bool
+		ipRevokedAt      time.Time
+	)
+
+	if challengeID != "" {
+		g.Go(func() error {
+			_, err := l.store.Get(ctx, challengePrefix+challengeID)
+			switch {
+			case err == nil:
+				challengeRevoked = true
+			case !errors.Is(err, store.ErrNotFound):
+				return err
+			}
+			return nil
+		})
+	}
+
+	if ip != "" {
+		g.Go(func() error {
+			var err error
+			ipRevokedAt, err = l.timestamp(ctx, ipPrefix+canonicalIP(ip))
+			return err
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return "", err
+	}
+
+	switch {
+	case challengeRevoked:
+		return ReasonChallenge, nil
+	case !ipRevokedAt.IsZero() && !issuedAt.After(ipRevokedAt):
+		return ReasonIP, nil
+	}
+
+	return "", nil
+}
+
+func (l *List) before(ctx context.Context) (time.Time, error) {
+	return l.timestamp(ctx, beforeKey)
+}
+
+// cachedCutoff returns the issued_before cutoff, reading it from the store
+// at most once every BeforeRefreshInterval.
+func (l *List) cachedCutoff(ctx context.Context) (time.Time, error) {
+	l.mu.Lock()
+	before, fetched := l.cachedBefore, l.beforeFetched
+	l.mu.Unlock()
+
+	if !fetched.IsZero() && l.now().Sub(fetched) < BeforeRefreshInterval {
+		return before, nil
+	}
+
+	result, err, _ := l.beforeGroup.Do(beforeKey, func() (any, error) {
+		before, err := l.before(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		l.cacheBefore(before)
+		return before, nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return result.(time.Time), nil
+}
+
+// cacheBefore remembers before as the current issued_before cutoff.
+func (l *List) cacheBefore(before time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cachedBefore = before
+	l.beforeFetched = l.now()
+}
+
+// timestamp reads a unix timestamp from key, returning the zero time if there
+// is none.
+func (l *List) timestamp(ctx context.Context, key string) (time.Time, error) {
+	data, err := l.store.Get(ctx, key)
+	if errors.Is(err, store.ErrNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	sec, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s: %w", store.ErrCantDecode, key, err)
+	}
+
+	return time.Unix(sec, 0), nil
+}
+
+// canonicalIP makes sure that different spellings of the same IPv6 address
+// share a revocation.
+func canonicalIP(ip string) string {
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		return addr.Unmap().String()
+	}
+	return ip
+}
@@ -0,0 +1,155 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/memory"
+)
+
+func TestRequestValid(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour)
+
+	for _, tt := range []struct {
+		name string
+		req  Request
+		err  error
+	}{
+		{name: "challenge", req: Request{ChallengeID: "abc"}},
+		{name: "ip", req: Request{IP: "2001:db8::1"}},
+		{name: "issued before", req: Request{IssuedBefore: &now}},
+		{name: "nothing", req: Request{}, err: ErrNeedsOneTarget},
+		{name: "two targets", req: Request{ChallengeID: "abc", IP: "198.51.100.7"}, err: ErrNeedsOneTarget},
+		{name: "bad ip", req: Request{IP: "198.51.100.0/24"}, err: ErrBadIP},
+		{name: "future", req: Request{IssuedBefore: &later}, err: ErrIssuedBeforeIsLater},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Valid(); !errors.Is(err, tt.err) {
+				t.Errorf("wanted %v, got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	ctx := t.Context()
+	l := New(memory.New(ctx), time.Hour)
+
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	before := now.Add(-time.Minute)
+	after := now.Add(time.Minute)
+
+	check := func(challengeID, ip string, issuedAt time.Time, want string) {
+		t.Helper()
+
+		got, err := l.Check(ctx, challengeID, ip, issuedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Check(%q, %q, %s): wanted %q, got %q", challengeID, ip, issuedAt, want, got)
+		}
+	}
+
+	check("abc", "198.51.100.7", before, "")
+
+	// By challenge ID.
+	if err := l.Revoke(ctx, Request{ChallengeID: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	check("abc", "198.51.100.7", before, ReasonChallenge)
+	check("def", "198.51.100.7", before, "")
+
+	if err := l.Lift(ctx, Request{ChallengeID: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	check("abc", "198.51.100.7", before, "")
+
+	// By IP, only for tokens issued until the revocation.
+	if err := l.Revoke(ctx, Request{IP: "::ffff:198.51.100.7"}); err != nil {
+		t.Fatal(err)
+	}
+	check("abc", "198.51.100.7", before, ReasonIP)
+	check("abc", "198.51.100.7", now, ReasonIP)
+	check("abc", "198.51.100.7", after, "")
+	check("abc", "198.51.100.8", before, "")
+
+	// By issue time, which only ever moves forward.
+	cutoff := now.Add(-30 * time.Second)
+	if err := l.Revoke(ctx, Request{IssuedBefore: &cutoff}); err != nil {
+		t.Fatal(err)
+	}
+	earlier := now.Add(-time.Hour)
+	if err := l.Revoke(ctx, Request{IssuedBefore: &earlier}); err != nil {
+		t.Fatal(err)
+	}
+	check("def", "203.0.113.1", before, ReasonIssuedBefore)
+	check("def", "203.0.113.1", now, "")
+
+	// Cutoffs older than the token lifetime can't match any valid token.
+	if err := l.Lift(ctx, Request{IssuedBefore: &cutoff}); err != nil {
+		t.Fatal(err)
+	}
+	ancient := now.Add(-2 * time.Hour)
+	if err := l.Revoke(ctx, Request{IssuedBefore: &ancient}); err != nil {
+		t.Fatal(err)
+	}
+	check("def", "203.0.113.1", ancient.Add(-time.Minute), "")
+}
+
+// countingStore counts how often each key is read.
+type countingStore struct {
+	store.Interface
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (cs *countingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	cs.mu.Lock()
+	cs.reads[key]++
+	cs.mu.Unlock()
+
+	return cs.Interface.Get(ctx, key)
+}
+
+func TestBeforeIsCached(t *testing.T) {
+	ctx := t.Context()
+	cs := &countingStore{Interface: memory.New(ctx), reads: map[string]int{}}
+	l := New(cs, time.Hour)
+
+	now := time.Now().Truncate(time.Second)
+	l.now = func() time.Time { return now }
+
+	for range 10 {
+		if _, err := l.Check(ctx, "abc", "198.51.100.7", now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := cs.reads[beforeKey]; n != 1 {
+		t.Errorf("wanted the cutoff to be read once, got %d reads", n)
+	}
+
+	// Another instance sets a cutoff, which is only seen once the cached
+	// one is refreshed.
+	cutoff := now.Add(-time.Minute)
+	if err := New(cs, time.Hour).Revoke(ctx, Request{IssuedBefore: &cutoff}); err != nil {
+		t.Fatal(err)
+	}
+
+	if reason, _ := l.Check(ctx, "abc", "198.51.100.7", cutoff); reason != "" {
+		t.Errorf("cutoff was read again before BeforeRefreshInterval passed, got: %q", reason)
+	}
+
+	now = now.Add(BeforeRefreshInterval)
+	if reason, _ := l.Check(ctx, "abc", "198.51.100.7", cutoff); reason != ReasonIssuedBefore {
+		t.Errorf("wanted %q after the refresh, got: %q", ReasonIssuedBefore, reason)
+	}
+}
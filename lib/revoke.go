@@ -0,0 +1,128 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/revocation"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// revocationErrorLogInterval is how often failures to read the revocation
+// list are logged. During a store outage every request fails, so logging each
+// of them would flood the logs.
+const revocationErrorLogInterval = time.Minute
+
+var revocationCheckErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "anubis_revocation_check_errors_total",
+	Help: "Tokens that could not be checked against the revocation list because it could not be read",
+})
+
+// revocationErrorLog rate-limits the errors logged by tokenRevoked.
+type revocationErrorLog struct {
+	last       atomic.Int64 // unix nanoseconds
+	suppressed atomic.Int64
+}
+
+// allow reports whether an error seen at now should be logged, and how many
+// were not logged since the last one that was.
+func (l *revocationErrorLog) allow(now time.Time) (bool, int64) {
+	last := l.last.Load()
+	if now.UnixNano()-last < int64(revocationErrorLogInterval) || !l.last.CompareAndSwap(last, now.UnixNano()) {
+		l.suppressed.Add(1)
+		return false, 0
+	}
+
+	return true, l.suppressed.Swap(0)
+}
+
+// tokenRevoked reports whether the token with claims was revoked. If the
+// revocation list can't be read, the token is accepted so that a store outage
+// doesn't make every visitor solve a challenge again, unless
+// Options.RevocationFailClosed is set.
+func (s *Server) tokenRevoked(r *http.Request, lg *slog.Logger, claims jwt.MapClaims) bool {
+	challengeID, _ := claims["challenge"].(string)
+
+	// Revoking by issue time is meant to end every session started before the
+	// cutoff, including the ones renewed after it.
+	issuedAt, _ := sessionStart(claims)
+
+	reason, err := s.revocations.Check(r.Context(), challengeID, r.Header.Get("X-Real-Ip"), issuedAt)
+	if err != nil {
+		revocationCheckErrors.Inc()
+		if ok, suppressed := s.revocationErrors.allow(time.Now()); ok {
+			lg.ErrorContext(r.Context(), "can't check if token was revoked", "err", err, "fail_closed", s.opts.RevocationFailClosed, "suppressed", suppressed)
+		}
+		return s.opts.RevocationFailClosed
+	}
+
+	if reason != "" {
+		lg.InfoContext(r.Context(), "token was revoked", "reason", reason, "challenge", challengeID)
+		return true
+	}
+
+	return false
+}
+
+// requireAdmin only lets requests that present the admin token through.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	want := sha256.Sum256([]byte(s.opts.AdminToken))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		got := sha256.Sum256([]byte(strings.TrimSpace(token)))
+
+		if !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare(got[:], want[:]) != 1 {
+			lg, r := s.getRequestLogger(r)
+			lg.WarnContext(r.Context(), "rejected admin API request without a valid token", "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="anubis-admin"`)
+			s.respondWithAPIError(w, r, lg, http.StatusUnauthorized, "a valid admin token is required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RevocationsAPI revokes tokens on POST and lifts revocations on DELETE. The
+// body is a revocation.Request.
+func (s *Server) RevocationsAPI(w http.ResponseWriter, r *http.Request) {
+	lg, r := s.getRequestLogger(r)
+
+	var req revocation.Request
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		s.respondWithAPIError(w, r, lg, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := req.Valid(); err != nil {
+		s.respondWithAPIError(w, r, lg, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		err = s.revocations.Revoke(r.Context(), req)
+	case http.MethodDelete:
+		err = s.revocations.Lift(r.Context(), req)
+	}
+	if err != nil {
+		lg.ErrorContext(r.Context(), "can't update revocations", "err", err)
+		s.respondWithAPIError(w, r, lg, http.StatusInternalServerError, "can't update revocations")
+		return
+	}
+
+	lg.InfoContext(r.Context(), "revocations updated", "method", r.Method, "challenge_id", req.ChallengeID, "ip", req.IP, "issued_before", req.IssuedBefore)
+	w.WriteHeader(http.StatusNoContent)
+}
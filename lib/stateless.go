@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/challenge"
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/degraded"
+)
+
+// statelessChallenges reports whether new challenges should be handed to the
+// client in a sealed token instead of being stored, either because the policy
+// asks for it or because the store is unavailable and its degraded mode is
+// stateless.
+func (s *Server) statelessChallenges() bool {
+	if s.policy.Challenges.Stateless {
+		return true
+	}
+
+	ds, ok := s.store.(*degraded.Store)
+	return ok && ds.Mode() == degraded.ModeStateless && ds.Unavailable()
+}
+
+// sealChallenge returns the ID a stateless challenge is known by to the
+// client: its UUID, a dot and the whole challenge sealed with the keyring.
+// The UUID is authenticated along with the sealed challenge, so neither can
+// be swapped out.
+func (s *Server) sealChallenge(chall *challenge.Challenge) (string, error) {
+	data, err := json.Marshal(chall)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", store.ErrCantEncode, err)
+	}
+
+	sealed, err := s.keyring.Seal(data, []byte(chall.ID))
+	if err != nil {
+		return "", err
+	}
+
+	return chall.ID + "." + sealed, nil
+}
+
+// openChallenge unseals a challenge made by sealChallenge. Tokens that can't
+// be opened or have expired are reported as store.ErrNotFound, just like
+// stored challenges that don't exist.
+func (s *Server) openChallenge(id string) (*challenge.Challenge, error) {
+	uuid, sealed, _ := strings.Cut(id, ".")
+
+	data, err := s.keyring.Open(sealed, []byte(uuid))
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't open stateless challenge: %w", store.ErrNotFound, err)
+	}
+
+	var chall challenge.Challenge
+	if err := json.Unmarshal(data, &chall); err != nil {
+		return nil, fmt.Errorf("%w: %w", store.ErrCantDecode, err)
+	}
+
+	if time.Since(chall.IssuedAt) > s.policy.Challenges.TTLDuration() {
+		return nil, fmt.Errorf("%w: stateless challenge %s has expired", store.ErrNotFound, uuid)
+	}
+
+	chall.ID = id
+	chall.Stateless = true
+
+	return &chall, nil
+}
+
+// challengeID returns the UUID of a challenge, leaving out the sealed
+// challenge that stateless challenge IDs carry.
+func challengeID(id string) string {
+	uuid, _, _ := strings.Cut(id, ".")
+	return uuid
+}
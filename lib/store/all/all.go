@@ -5,7 +5,10 @@ package all
 
 import (
 	_ "github.com/TecharoHQ/anubis/lib/store/bbolt"
+	_ "github.com/TecharoHQ/anubis/lib/store/cache"
+	_ "github.com/TecharoHQ/anubis/lib/store/encrypted"
 	_ "github.com/TecharoHQ/anubis/lib/store/memory"
 	_ "github.com/TecharoHQ/anubis/lib/store/s3api"
+	_ "github.com/TecharoHQ/anubis/lib/store/sqlstore"
 	_ "github.com/TecharoHQ/anubis/lib/store/valkey"
 )
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Incrementer is implemented by storage backends that can add to a counter
+// atomically, even when several instances of Anubis share the backend.
+type Incrementer interface {
+	// Increment adds delta to the counter at key and returns its new value.
+	// A missing or expired counter starts at zero. The counter expires after
+	// expiry, counted from this call.
+	//
+	// Counters are stored as base 10 integers, so they can also be read with
+	// Get and JSON[int].
+	Increment(ctx context.Context, key string, delta int64, expiry time.Duration) (int64, error)
+}
+
+// CompareAndSwapper is implemented by storage backends that can set a value
+// only if the current value is what the caller expects, atomically, even when
+// several instances of Anubis share the backend.
+type CompareAndSwapper interface {
+	// CompareAndSwap sets key to value only if its current value is old. A nil
+	// old means that key must not exist or must have expired, which makes this
+	// a set-if-not-exists. It reports whether value was stored.
+	CompareAndSwap(ctx context.Context, key string, old, value []byte, expiry time.Duration) (bool, error)
+}
+
+// Increment adds delta to the counter at key using s's Incrementer if it has
+// one. Otherwise it falls back to Get and Set under a lock, which is only
+// atomic within this process.
+func Increment(ctx context.Context, s Interface, key string, delta int64, expiry time.Duration) (int64, error) {
+	if inc, ok := s.(Incrementer); ok {
+		return inc.Increment(ctx, key, delta, expiry)
+	}
+
+	mu := fallbackLock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	data, err := s.Get(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+
+	var result int64
+	if err == nil {
+		if result, err = ParseCounter(data); err != nil {
+			return 0, err
+		}
+	}
+
+	result += delta
+	if err := s.Set(ctx, key, FormatCounter(result), expiry); err != nil {
+		return 0, err
+	}
+
+	return result, nil
+}
+
+// CompareAndSwap sets key to value if its current value is old using s's
+// CompareAndSwapper if it has one. Otherwise it falls back to Get and Set
+// under a lock, which is only atomic within this process.
+func CompareAndSwap(ctx context.Context, s Interface, key string, old, value []byte, expiry time.Duration) (bool, error) {
+	if cas, ok := s.(CompareAndSwapper); ok {
+		return cas.CompareAndSwap(ctx, key, old, value, expiry)
+	}
+
+	mu := fallbackLock(key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	current, err := s.Get(ctx, key)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if old != nil {
+			return false, nil
+		}
+	case err != nil:
+		return false, err
+	case old == nil || !bytes.Equal(current, old):
+		return false, nil
+	}
+
+	if err := s.Set(ctx, key, value, expiry); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetNX sets key to value only if key does not exist or has expired. It
+// reports whether value was stored.
+func SetNX(ctx context.Context, s Interface, key string, value []byte, expiry time.Duration) (bool, error) {
+	return CompareAndSwap(ctx, s, key, nil, value, expiry)
+}
+
+// ParseCounter decodes a counter written by Increment.
+func ParseCounter(data []byte) (int64, error) {
+	result, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: counter is not an integer: %w", ErrCantDecode, err)
+	}
+
+	return result, nil
+}
+
+// FormatCounter encodes a counter the way Increment stores it.
+func FormatCounter(n int64) []byte {
+	return strconv.AppendInt(nil, n, 10)
+}
+
+// fallbackLocks serialise read-modify-write operations on backends that
+// can't do them atomically. Keys are spread over a fixed number of locks so
+// that this doesn't grow with the number of keys.
+var (
+	fallbackLocks [64]sync.Mutex
+	fallbackSeed  = maphash.MakeSeed()
+)
+
+func fallbackLock(key string) *sync.Mutex {
+	return &fallbackLocks[maphash.String(fallbackSeed, key)%uint64(len(fallbackLocks))]
+}
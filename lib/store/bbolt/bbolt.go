@@ -1,6 +1,7 @@
 package bbolt
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -128,24 +129,136 @@ func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
 
 // Set a value into the store with a given expiry.
 func (s *Store) Set(ctx context.Context, key string, value []byte, expiry time.Duration) error {
-	expires := time.Now().Add(expiry)
-
 	return s.bdb.Update(func(tx *bbolt.Tx) error {
-		valueBkt, err := tx.CreateBucketIfNotExists([]byte(key))
-		if err != nil {
-			return fmt.Errorf("%w: %w: %q (create bucket)", store.ErrCantEncode, err, key)
+		return put(tx, key, value, expiry)
+	})
+}
+
+// Increment adds delta to the counter at key. The whole read-modify-write
+// happens in one write transaction, which bbolt runs one at a time.
+func (s *Store) Increment(ctx context.Context, key string, delta int64, expiry time.Duration) (int64, error) {
+	var result int64
+
+	if err := s.bdb.Update(func(tx *bbolt.Tx) error {
+		result = 0
+		if data, ok := liveData(tx, key); ok {
+			n, err := store.ParseCounter(data)
+			if err != nil {
+				return err
+			}
+			result = n
 		}
 
-		if err := valueBkt.Put([]byte("expiry"), []byte(expires.Format(time.RFC3339Nano))); err != nil {
-			return fmt.Errorf("%w: %q (expiry)", store.ErrCantEncode, key)
+		result += delta
+		return put(tx, key, store.FormatCounter(result), expiry)
+	}); err != nil {
+		return 0, err
+	}
+
+	return result, nil
+}
+
+// CompareAndSwap sets key to value if its current value is old, in one write
+// transaction.
+func (s *Store) CompareAndSwap(ctx context.Context, key string, old, value []byte, expiry time.Duration) (bool, error) {
+	var swapped bool
+
+	if err := s.bdb.Update(func(tx *bbolt.Tx) error {
+		current, ok := liveData(tx, key)
+		switch {
+		case old == nil && ok:
+			return nil
+		case old != nil && (!ok || !bytes.Equal(current, old)):
+			return nil
 		}
 
-		if err := valueBkt.Put([]byte("data"), value); err != nil {
-			return fmt.Errorf("%w: %q (data)", store.ErrCantEncode, key)
+		swapped = true
+		return put(tx, key, value, expiry)
+	}); err != nil {
+		return false, err
+	}
+
+	return swapped, nil
+}
+
+// liveData returns the data stored for key in tx, unless it is missing or
+// has expired.
+func liveData(tx *bbolt.Tx, key string) ([]byte, bool) {
+	valueBkt := tx.Bucket([]byte(key))
+	if valueBkt == nil {
+		return nil, false
+	}
+
+	expiry, err := time.Parse(time.RFC3339Nano, string(valueBkt.Get([]byte("expiry"))))
+	if err != nil || time.Now().After(expiry) {
+		return nil, false
+	}
+
+	data := valueBkt.Get([]byte("data"))
+	return data, data != nil
+}
+
+// put writes value and its expiry into the bucket for key, creating it if
+// needed.
+func put(tx *bbolt.Tx, key string, value []byte, expiry time.Duration) error {
+	expires := time.Now().Add(expiry)
+
+	valueBkt, err := tx.CreateBucketIfNotExists([]byte(key))
+	if err != nil {
+		return fmt.Errorf("%w: %w: %q (create bucket)", store.ErrCantEncode, err, key)
+	}
+
+	if err := valueBkt.Put([]byte("expiry"), []byte(expires.Format(time.RFC3339Nano))); err != nil {
+		return fmt.Errorf("%w: %q (expiry)", store.ErrCantEncode, key)
+	}
+
+	if err := valueBkt.Put([]byte("data"), value); err != nil {
+		return fmt.Errorf("%w: %q (data)", store.ErrCantEncode, key)
+	}
+
+	return nil
+}
+
+// List calls fn for every key starting with prefix that has not expired.
+// Buckets are kept in key order, so only the buckets with the prefix are
+// read.
+func (s *Store) List(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	var entries []store.Entry
+	now := time.Now()
+
+	// fn may use the store, and bbolt transactions can't be nested, so
+	// collect the keys before calling it.
+	if err := s.bdb.View(func(tx *bbolt.Tx) error {
+		c := tx.Cursor()
+		for key, _ := c.Seek([]byte(prefix)); key != nil && bytes.HasPrefix(key, []byte(prefix)); key, _ = c.Next() {
+			valueBkt := tx.Bucket(key)
+			if valueBkt == nil {
+				continue
+			}
+
+			expiry, err := time.Parse(time.RFC3339Nano, string(valueBkt.Get([]byte("expiry"))))
+			if err != nil || now.After(expiry) {
+				continue
+			}
+
+			entries = append(entries, store.Entry{Key: string(key), Expires: expiry})
 		}
 
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (s *Store) cleanup(ctx context.Context) error {
@@ -0,0 +1,254 @@
+// Package cache implements a storage backend that keeps recently used values
+// of another storage backend in memory, so that repeated reads don't have to
+// go over the network.
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var lookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "anubis_store_cache_lookups_total",
+	Help: "Reads from the caching storage backend by whether they were answered locally",
+}, []string{"result"})
+
+// Store is a write-through cache in front of another store.Interface.
+//
+// Reads are answered from memory when possible. Values read from the backend
+// are kept for maxTTL, and keys the backend doesn't have are remembered as
+// missing for negativeTTL. Writes go to the backend first and only change the
+// local copy once the backend accepted them.
+//
+// Values written through the cache are kept no longer than the expiry they
+// were written with. Values read from the backend are kept for maxTTL even if
+// the backend drops them sooner, as finding out when a key expires would take
+// another round trip (or a scan of the keyspace) on every miss.
+//
+// Each instance of Anubis has its own local copy, so changes made by another
+// instance sharing the backend can take up to maxTTL (or negativeTTL for keys
+// that used to be missing) to be seen. Atomic operations always go to the
+// backend.
+type Store struct {
+	backend     store.Interface
+	maxEntries  int
+	maxTTL      time.Duration
+	negativeTTL time.Duration
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+
+	// gen counts local writes. A value read from the backend is only cached
+	// if nothing was written while it was being read, so that a slow read
+	// can't replace a newer value.
+	gen uint64
+
+	// Overridden in tests.
+	now func() time.Time
+}
+
+type entry struct {
+	key     string
+	value   []byte
+	missing bool
+	expires time.Time
+}
+
+var (
+	_ store.Interface         = (*Store)(nil)
+	_ store.Incrementer       = (*Store)(nil)
+	_ store.CompareAndSwapper = (*Store)(nil)
+	_ store.Lister            = (*Store)(nil)
+)
+
+// New puts a cache holding at most maxEntries values in front of backend.
+// A negativeTTL of zero disables caching missing keys.
+func New(backend store.Interface, maxEntries int, maxTTL, negativeTTL time.Duration) *Store {
+	return &Store{
+		backend:     backend,
+		maxEntries:  maxEntries,
+		maxTTL:      maxTTL,
+		negativeTTL: min(negativeTTL, maxTTL),
+		entries:     map[string]*list.Element{},
+		lru:         list.New(),
+		now:         time.Now,
+	}
+}
+
+// Get a value from the local cache, or from the backend if it isn't cached.
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	s.lock.Lock()
+	if e, ok := s.lookup(key); ok {
+		s.lock.Unlock()
+
+		if e.missing {
+			lookups.WithLabelValues("negative_hit").Inc()
+			return nil, fmt.Errorf("%w: %q", store.ErrNotFound, key)
+		}
+
+		lookups.WithLabelValues("hit").Inc()
+		return bytes.Clone(e.value), nil
+	}
+	gen := s.gen
+	s.lock.Unlock()
+
+	lookups.WithLabelValues("miss").Inc()
+
+	value, err := s.backend.Get(ctx, key)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		if s.negativeTTL > 0 {
+			s.fill(gen, &entry{key: key, missing: true, expires: s.now().Add(s.negativeTTL)})
+		}
+		return nil, err
+	case err != nil:
+		return nil, err
+	}
+
+	s.fill(gen, &entry{key: key, value: bytes.Clone(value), expires: s.now().Add(s.maxTTL)})
+	return value, nil
+}
+
+// Set a value in the backend and, once that worked, in the local cache.
+func (s *Store) Set(ctx context.Context, key string, value []byte, expiry time.Duration) error {
+	if err := s.backend.Set(ctx, key, value, expiry); err != nil {
+		s.forget(key)
+		return err
+	}
+
+	s.remember(key, value, expiry)
+	return nil
+}
+
+// Delete a value from the backend and the local cache.
+func (s *Store) Delete(ctx context.Context, key string) error {
+	defer s.forget(key)
+	return s.backend.Delete(ctx, key)
+}
+
+// Increment a counter in the backend. The result is cached.
+func (s *Store) Increment(ctx context.Context, key string, delta int64, expiry time.Duration) (int64, error) {
+	result, err := store.Increment(ctx, s.backend, key, delta, expiry)
+	if err != nil {
+		s.forget(key)
+		return 0, err
+	}
+
+	s.remember(key, store.FormatCounter(result), expiry)
+	return result, nil
+}
+
+// CompareAndSwap a value in the backend. The comparison is always done by the
+// backend, never against the local copy.
+func (s *Store) CompareAndSwap(ctx context.Context, key string, old, value []byte, expiry time.Duration) (bool, error) {
+	swapped, err := store.CompareAndSwap(ctx, s.backend, key, old, value, expiry)
+	if err != nil || !swapped {
+		s.forget(key)
+		return swapped, err
+	}
+
+	s.remember(key, value, expiry)
+	return true, nil
+}
+
+// List the keys of the backend. The local cache only holds some of them, so
+// it is not used.
+func (s *Store) List(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	return store.List(ctx, s.backend, prefix, fn)
+}
+
+func (s *Store) IsPersistent() bool {
+	return s.backend.IsPersistent()
+}
+
+// Len returns the number of keys cached locally, including expired ones that
+// haven't been dropped yet.
+func (s *Store) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.lru.Len()
+}
+
+// lookup returns the cached entry for key if it has not expired and marks it
+// as recently used. s.lock must be held.
+func (s *Store) lookup(key string) (*entry, bool) {
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := elem.Value.(*entry)
+	if !s.now().Before(e.expires) {
+		s.remove(elem)
+		return nil, false
+	}
+
+	s.lru.MoveToFront(elem)
+	return e, true
+}
+
+// remember caches value for key after a local write.
+func (s *Store) remember(key string, value []byte, expiry time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.gen++
+	s.put(&entry{key: key, value: bytes.Clone(value), expires: s.now().Add(min(expiry, s.maxTTL))})
+}
+
+// forget drops key from the local cache.
+func (s *Store) forget(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.gen++
+	if elem, ok := s.entries[key]; ok {
+		s.remove(elem)
+	}
+}
+
+// fill caches e after a read from the backend, unless anything was written
+// locally since gen.
+func (s *Store) fill(gen uint64, e *entry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.gen != gen {
+		return
+	}
+
+	s.put(e)
+}
+
+// put adds or replaces an entry, dropping the least recently used entries
+// when the cache is full. s.lock must be held.
+func (s *Store) put(e *entry) {
+	if elem, ok := s.entries[e.key]; ok {
+		elem.Value = e
+		s.lru.MoveToFront(elem)
+		return
+	}
+
+	s.entries[e.key] = s.lru.PushFront(e)
+
+	for s.lru.Len() > s.maxEntries {
+		s.remove(s.lru.Back())
+	}
+}
+
+// remove drops elem from the cache. s.lock must be held.
+func (s *Store) remove(elem *list.Element) {
+	s.lru.Remove(elem)
+	delete(s.entries, elem.Value.(*entry).key)
+}
@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/memory"
+	"github.com/TecharoHQ/anubis/lib/store/storetest"
+)
+
+func TestImpl(t *testing.T) {
+	storetest.Common(t, Factory{}, json.RawMessage(`{"backend": "memory", "negativeTTL": "0s"}`))
+}
+
+// countingStore counts reads that reach the backend and can be told to fail
+// writes.
+type countingStore struct {
+	store.Interface
+	gets      atomic.Int32
+	failWrite bool
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (c *countingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	c.gets.Add(1)
+	return c.Interface.Get(ctx, key)
+}
+
+func (c *countingStore) Set(ctx context.Context, key string, value []byte, expiry time.Duration) error {
+	if c.failWrite {
+		return errWriteFailed
+	}
+	return c.Interface.Set(ctx, key, value, expiry)
+}
+
+// newTestStore returns a cache in front of a counting memory store and a way
+// to move the cache's clock forward.
+func newTestStore(t *testing.T, maxEntries int) (*Store, *countingStore, func(time.Duration)) {
+	t.Helper()
+
+	backend := &countingStore{Interface: memory.New(t.Context())}
+	s := New(backend, maxEntries, time.Minute, 5*time.Second)
+
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	return s, backend, func(d time.Duration) { now = now.Add(d) }
+}
+
+func mustGet(t *testing.T, s store.Interface, key, want string) {
+	t.Helper()
+
+	got, err := s.Get(t.Context(), key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	if string(got) != want {
+		t.Fatalf("Get(%q) = %q, want %q", key, got, want)
+	}
+}
+
+func TestReadsAreCached(t *testing.T) {
+	s, backend, advance := newTestStore(t, 10)
+
+	if err := backend.Interface.Set(t.Context(), "key", []byte("value"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	mustGet(t, s, "key", "value")
+	mustGet(t, s, "key", "value")
+
+	if n := backend.gets.Load(); n != 1 {
+		t.Errorf("wanted one read from the backend, got %d", n)
+	}
+
+	// Values read from the backend are only trusted for maxTTL.
+	advance(time.Minute)
+	mustGet(t, s, "key", "value")
+
+	if n := backend.gets.Load(); n != 2 {
+		t.Errorf("wanted the value to be read again after maxTTL, got %d reads", n)
+	}
+}
+
+func TestNegativeCaching(t *testing.T) {
+	s, backend, advance := newTestStore(t, 10)
+
+	for range 2 {
+		if _, err := s.Get(t.Context(), "missing"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("wanted ErrNotFound, got: %v", err)
+		}
+	}
+
+	if n := backend.gets.Load(); n != 1 {
+		t.Errorf("wanted the missing key to be remembered, got %d reads", n)
+	}
+
+	// Another instance creates the key. It is seen once negativeTTL is up.
+	if err := backend.Interface.Set(t.Context(), "missing", []byte("here"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	advance(5 * time.Second)
+	mustGet(t, s, "missing", "here")
+}
+
+func TestWriteThrough(t *testing.T) {
+	s, backend, _ := newTestStore(t, 10)
+
+	if _, err := s.Get(t.Context(), "key"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("wanted ErrNotFound, got: %v", err)
+	}
+
+	// Local writes replace remembered misses right away.
+	if err := s.Set(t.Context(), "key", []byte("v1"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	mustGet(t, backend.Interface, "key", "v1")
+	mustGet(t, s, "key", "v1")
+
+	// A write the backend refused must not be visible locally.
+	backend.failWrite = true
+	if err := s.Set(t.Context(), "key", []byte("v2"), time.Hour); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("wanted the backend error, got: %v", err)
+	}
+	mustGet(t, s, "key", "v1")
+
+	if err := s.Delete(t.Context(), "key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(t.Context(), "key"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("wanted deleted key to be gone, got: %v", err)
+	}
+}
+
+func TestShortExpiryIsKept(t *testing.T) {
+	s, backend, advance := newTestStore(t, 10)
+
+	if err := s.Set(t.Context(), "key", []byte("value"), time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	mustGet(t, s, "key", "value")
+	advance(2 * time.Second)
+	s.Get(t.Context(), "key") //nolint:errcheck
+
+	if n := backend.gets.Load(); n != 1 {
+		t.Errorf("local copy outlived the expiry it was written with, got %d backend reads", n)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	s, backend, _ := newTestStore(t, 2)
+
+	for _, key := range []string{"a", "b"} {
+		if err := s.Set(t.Context(), key, []byte(key), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Use a so that b is the least recently used, then push b out with c.
+	mustGet(t, s, "a", "a")
+	if err := s.Set(t.Context(), "c", []byte("c"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := s.Len(); n != 2 {
+		t.Errorf("cache holds %d entries, want at most 2", n)
+	}
+
+	mustGet(t, s, "a", "a")
+	mustGet(t, s, "c", "c")
+	if n := backend.gets.Load(); n != 0 {
+		t.Errorf("recently used entries should still be cached, got %d backend reads", n)
+	}
+
+	mustGet(t, s, "b", "b")
+	if n := backend.gets.Load(); n != 1 {
+		t.Errorf("the evicted entry should be read from the backend, got %d backend reads", n)
+	}
+}
+
+func TestAtomicOperationsUseBackend(t *testing.T) {
+	s, backend, _ := newTestStore(t, 10)
+
+	if err := s.Set(t.Context(), "key", []byte("old"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance changes the value behind the cache's back.
+	if err := backend.Interface.Set(t.Context(), "key", []byte("changed"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	swapped, err := s.CompareAndSwap(t.Context(), "key", []byte("old"), []byte("new"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swapped {
+		t.Error("swap compared against the stale local copy")
+	}
+	mustGet(t, s, "key", "changed")
+
+	n, err := store.Increment(t.Context(), s, "counter", 3, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("wanted counter to be 3, got: %d", n)
+	}
+	mustGet(t, backend.Interface, "counter", "3")
+}
+
+func TestReadsKeepMaxTTL(t *testing.T) {
+	s, backend, advance := newTestStore(t, 10)
+
+	// Written by another instance with an expiry shorter than maxTTL.
+	if err := backend.Set(t.Context(), "key", []byte("value"), time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	mustGet(t, s, "key", "value")
+	advance(30 * time.Second)
+	mustGet(t, s, "key", "value")
+
+	if n := backend.gets.Load(); n != 1 {
+		t.Errorf("a value read from the backend was dropped before maxTTL, got %d backend reads", n)
+	}
+
+	advance(31 * time.Second)
+	s.Get(t.Context(), "key") //nolint:errcheck
+
+	if n := backend.gets.Load(); n != 2 {
+		t.Errorf("a value read from the backend outlived maxTTL, got %d backend reads", n)
+	}
+}
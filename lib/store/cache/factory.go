@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+)
+
+const (
+	// DefaultMaxEntries is how many values are kept locally when no limit is
+	// set.
+	DefaultMaxEntries = 10000
+
+	// DefaultMaxTTL is how long values are kept locally at most when no
+	// limit is set.
+	DefaultMaxTTL = time.Minute
+
+	// DefaultNegativeTTL is how long missing keys are remembered when no
+	// duration is set.
+	DefaultNegativeTTL = 5 * time.Second
+)
+
+var (
+	ErrNoBackend       = errors.New("cache.Config: backend is missing from config")
+	ErrUnknownBackend  = errors.New("cache.Config: unknown backend")
+	ErrNestedCache     = errors.New("cache.Config: backend can't be another cache")
+	ErrBackendNotValid = errors.New("cache.Config: backend parameters are not valid")
+	ErrBadMaxEntries   = errors.New("cache.Config: maxEntries must not be negative")
+	ErrBadMaxTTL       = errors.New("cache.Config: maxTTL must be a positive duration")
+	ErrBadNegativeTTL  = errors.New("cache.Config: negativeTTL must be a duration that is not negative")
+)
+
+func init() {
+	store.Register("cache", Factory{})
+}
+
+// Factory builds new instances of the caching storage backend according to
+// configuration passed via a json.RawMessage.
+type Factory struct{}
+
+// Build parses and validates the cache Config, builds the backend it wraps
+// and puts a local cache in front of it.
+func (Factory) Build(ctx context.Context, data json.RawMessage) (store.Interface, error) {
+	var config Config
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		return nil, fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	if err := config.Valid(); err != nil {
+		return nil, fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	fac, _ := store.Get(config.Backend)
+	backend, err := fac.Build(ctx, config.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("cache: can't build %s backend: %w", config.Backend, err)
+	}
+
+	return New(backend, config.maxEntries(), config.maxTTL(), config.negativeTTL()), nil
+}
+
+// Valid parses and validates the cache Config, including the parameters of
+// the backend it wraps, or returns an error.
+func (Factory) Valid(data json.RawMessage) error {
+	var config Config
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		return fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	if err := config.Valid(); err != nil {
+		return fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	return nil
+}
+
+// Config is the caching storage backend configuration.
+type Config struct {
+	// Backend is the name of the storage backend to cache, such as valkey.
+	Backend string `json:"backend"`
+
+	// Parameters are passed to Backend as is.
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+
+	// MaxEntries is how many values are kept locally. When the cache is
+	// full, the least recently used value is dropped. Defaults to
+	// DefaultMaxEntries.
+	MaxEntries int `json:"maxEntries,omitempty"`
+
+	// MaxTTL is the longest a value is kept locally, as a Go duration
+	// string. Changes made by other instances of Anubis can take this long
+	// to be seen. Defaults to DefaultMaxTTL.
+	MaxTTL string `json:"maxTTL,omitempty"`
+
+	// NegativeTTL is how long keys that don't exist in Backend are
+	// remembered as missing, as a Go duration string. "0s" turns this off.
+	// Defaults to DefaultNegativeTTL.
+	NegativeTTL string `json:"negativeTTL,omitempty"`
+}
+
+// Valid validates the configuration.
+func (c Config) Valid() error {
+	var errs []error
+
+	switch c.Backend {
+	case "":
+		errs = append(errs, ErrNoBackend)
+	case "cache":
+		errs = append(errs, ErrNestedCache)
+	default:
+		fac, ok := store.Get(c.Backend)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrUnknownBackend, c.Backend))
+			break
+		}
+
+		if err := fac.Valid(c.Parameters); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", ErrBackendNotValid, err))
+		}
+	}
+
+	if c.MaxEntries < 0 {
+		errs = append(errs, fmt.Errorf("%w, got: %d", ErrBadMaxEntries, c.MaxEntries))
+	}
+
+	if c.MaxTTL != "" {
+		if d, err := time.ParseDuration(c.MaxTTL); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("%w, got: %q", ErrBadMaxTTL, c.MaxTTL))
+		}
+	}
+
+	if c.NegativeTTL != "" {
+		if d, err := time.ParseDuration(c.NegativeTTL); err != nil || d < 0 {
+			errs = append(errs, fmt.Errorf("%w, got: %q", ErrBadNegativeTTL, c.NegativeTTL))
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+func (c Config) maxEntries() int {
+	if c.MaxEntries == 0 {
+		return DefaultMaxEntries
+	}
+	return c.MaxEntries
+}
+
+func (c Config) maxTTL() time.Duration {
+	d, err := time.ParseDuration(c.MaxTTL)
+	if err != nil {
+		return DefaultMaxTTL
+	}
+	return d
+}
+
+func (c Config) negativeTTL() time.Duration {
+	d, err := time.ParseDuration(c.NegativeTTL)
+	if err != nil {
+		return DefaultNegativeTTL
+	}
+	return d
+}
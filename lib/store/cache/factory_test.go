@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/lib/store/bbolt"
+	_ "github.com/TecharoHQ/anubis/lib/store/memory"
+)
+
+func TestFactoryValid(t *testing.T) {
+	f := Factory{}
+
+	t.Run("bad config", func(t *testing.T) {
+		if err := f.Valid(json.RawMessage(`}`)); err == nil {
+			t.Error("wanted parsing failure but got a successful result")
+		}
+	})
+
+	for _, tt := range []struct {
+		err  error
+		name string
+		cfg  string
+	}{
+		{
+			name: "memory backend",
+			cfg:  `{"backend": "memory"}`,
+		},
+		{
+			name: "all options",
+			cfg:  `{"backend": "memory", "maxEntries": 100, "maxTTL": "30s", "negativeTTL": "0s"}`,
+		},
+		{
+			name: "missing backend",
+			cfg:  `{}`,
+			err:  ErrNoBackend,
+		},
+		{
+			name: "unknown backend",
+			cfg:  `{"backend": "floppy"}`,
+			err:  ErrUnknownBackend,
+		},
+		{
+			name: "cache in front of a cache",
+			cfg:  `{"backend": "cache", "parameters": {"backend": "memory"}}`,
+			err:  ErrNestedCache,
+		},
+		{
+			name: "invalid backend parameters",
+			cfg:  `{"backend": "bbolt", "parameters": {}}`,
+			err:  bbolt.ErrMissingPath,
+		},
+		{
+			name: "negative maxEntries",
+			cfg:  `{"backend": "memory", "maxEntries": -1}`,
+			err:  ErrBadMaxEntries,
+		},
+		{
+			name: "zero maxTTL",
+			cfg:  `{"backend": "memory", "maxTTL": "0s"}`,
+			err:  ErrBadMaxTTL,
+		},
+		{
+			name: "bad negativeTTL",
+			cfg:  `{"backend": "memory", "negativeTTL": "soon"}`,
+			err:  ErrBadNegativeTTL,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := f.Valid(json.RawMessage(tt.cfg)); !errors.Is(err, tt.err) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+		})
+	}
+}
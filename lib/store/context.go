@@ -0,0 +1,16 @@
+package store
+
+import "context"
+
+type ctxKey struct{}
+
+// With returns a context that carries the given store, so that components
+// built during config parsing can use it.
+func With(ctx context.Context, st Interface) context.Context {
+	return context.WithValue(ctx, ctxKey{}, st)
+}
+
+func FromContext(ctx context.Context) (Interface, bool) {
+	st, ok := ctx.Value(ctxKey{}).(Interface)
+	return st, ok
+}
@@ -0,0 +1,108 @@
+package degraded
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Mode is what Anubis does while the storage backend is unavailable.
+type Mode string
+
+const (
+	// ModeOpen lets every request that would be challenged through to the
+	// upstream without a challenge.
+	ModeOpen Mode = "open"
+
+	// ModeMemory keeps issuing challenges, storing them in memory local to
+	// this instance of Anubis until the backend is back.
+	ModeMemory Mode = "memory"
+
+	// ModeStateless hands out challenges in sealed tokens, so that they
+	// don't need to be stored and can be solved on any instance of Anubis.
+	// Everything else is kept in memory like in ModeMemory.
+	ModeStateless Mode = "stateless"
+
+	// ModeDeny answers every request that would be challenged with a 503
+	// Service Unavailable error.
+	ModeDeny Mode = "deny"
+)
+
+const (
+	// DefaultFailureThreshold is how many backend failures in a row mark the
+	// backend as unavailable when no threshold is set.
+	DefaultFailureThreshold = 5
+
+	// DefaultProbeInterval is how often the backend is probed when no
+	// interval is set.
+	DefaultProbeInterval = 5 * time.Second
+)
+
+var (
+	ErrUnknownMode          = errors.New("degraded.Config: mode must be one of open, memory, stateless or deny")
+	ErrBadFailureThreshold  = errors.New("degraded.Config: failureThreshold must not be negative")
+	ErrBadProbeInterval     = errors.New("degraded.Config: probeInterval must be a positive duration")
+	ErrProbeIntervalTooLong = errors.New("degraded.Config: probeInterval must be at most an hour")
+)
+
+// Config is the degraded mode configuration, set in the degraded block of
+// the store block of a policy file.
+type Config struct {
+	// Mode is what to do while the backend is unavailable.
+	Mode Mode `json:"mode"`
+
+	// FailureThreshold is how many backend operations have to fail in a row
+	// for the backend to be marked unavailable. Defaults to
+	// DefaultFailureThreshold.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+
+	// ProbeInterval is how often the backend is checked, as a Go duration
+	// string. Defaults to DefaultProbeInterval.
+	ProbeInterval string `json:"probeInterval,omitempty"`
+}
+
+// Valid validates the configuration.
+func (c Config) Valid() error {
+	var errs []error
+
+	switch c.Mode {
+	case ModeOpen, ModeMemory, ModeStateless, ModeDeny:
+	default:
+		errs = append(errs, fmt.Errorf("%w, got: %q", ErrUnknownMode, c.Mode))
+	}
+
+	if c.FailureThreshold < 0 {
+		errs = append(errs, fmt.Errorf("%w, got: %d", ErrBadFailureThreshold, c.FailureThreshold))
+	}
+
+	if c.ProbeInterval != "" {
+		d, err := time.ParseDuration(c.ProbeInterval)
+		switch {
+		case err != nil || d <= 0:
+			errs = append(errs, fmt.Errorf("%w, got: %q", ErrBadProbeInterval, c.ProbeInterval))
+		case d > time.Hour:
+			errs = append(errs, fmt.Errorf("%w, got: %q", ErrProbeIntervalTooLong, c.ProbeInterval))
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+func (c Config) failureThreshold() int64 {
+	if c.FailureThreshold == 0 {
+		return DefaultFailureThreshold
+	}
+	return int64(c.FailureThreshold)
+}
+
+func (c Config) probeInterval() time.Duration {
+	d, err := time.ParseDuration(c.ProbeInterval)
+	if err != nil {
+		return DefaultProbeInterval
+	}
+	return d
+}
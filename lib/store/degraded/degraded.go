@@ -0,0 +1,290 @@
+// Package degraded wraps a storage backend with a circuit breaker, so that
+// Anubis keeps answering requests in a predictable way while the backend is
+// down instead of failing every request that needs it.
+package degraded
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/instrumented"
+	"github.com/TecharoHQ/anubis/lib/store/memory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// HealthService is the name of the health service that reports whether
+	// the storage backend is available.
+	HealthService = "store"
+
+	// probeKey is written to the backend to check if it is up. Get can't be
+	// used for this, as some backends report every error as a missing key.
+	probeKey = "anubis-health-probe"
+
+	// fallbackMaxEntries bounds the local store used in ModeMemory and
+	// ModeStateless, so that a long outage during a flood of clients can't
+	// use up all memory.
+	fallbackMaxEntries = 100000
+)
+
+// ErrUnavailable is returned for operations that weren't sent to the backend
+// because it is unavailable.
+var ErrUnavailable = errors.New("degraded: storage backend is unavailable")
+
+var (
+	unavailableGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "anubis_store_unavailable",
+		Help: "1 while the storage backend is marked unavailable and Anubis is in degraded mode, 0 otherwise",
+	})
+
+	trips = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "anubis_store_unavailable_total",
+		Help: "How often the storage backend was marked unavailable",
+	})
+)
+
+// Store sends operations to a backend until it fails FailureThreshold times
+// in a row. From then on the backend is unavailable: operations fail with
+// ErrUnavailable right away, or go to a local memory store in ModeMemory and
+// ModeStateless, until a probe of the backend succeeds again.
+//
+// Only errors talking to the backend, such as connection errors and
+// timeouts, count as failures. Missing keys and values that can't be decoded
+// don't.
+type Store struct {
+	backend   store.Interface
+	fallback  store.Interface
+	mode      Mode
+	threshold int64
+
+	failures    atomic.Int64
+	unavailable atomic.Bool
+}
+
+var (
+	_ store.Interface         = (*Store)(nil)
+	_ store.Incrementer       = (*Store)(nil)
+	_ store.CompareAndSwapper = (*Store)(nil)
+	_ store.Lister            = (*Store)(nil)
+)
+
+// New wraps backend according to config, which must be valid. The backend is
+// probed in the background until ctx is canceled.
+func New(ctx context.Context, backend store.Interface, config Config) *Store {
+	s := &Store{
+		backend:   backend,
+		mode:      config.Mode,
+		threshold: config.failureThreshold(),
+	}
+
+	if s.mode == ModeMemory || s.mode == ModeStateless {
+		s.fallback = memory.NewWithConfig(ctx, memory.Config{MaxEntries: fallbackMaxEntries})
+	}
+
+	internal.SetHealth(HealthService, healthv1.HealthCheckResponse_SERVING)
+	unavailableGauge.Set(0)
+
+	go s.probe(ctx, config.probeInterval())
+
+	return s
+}
+
+// Mode returns what Anubis does while the backend is unavailable.
+func (s *Store) Mode() Mode {
+	return s.mode
+}
+
+// Unavailable reports whether the backend is marked unavailable.
+func (s *Store) Unavailable() bool {
+	return s.unavailable.Load()
+}
+
+// probe writes to the backend every interval, marking it unavailable when
+// it keeps failing and available again when it works.
+func (s *Store) probe(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		pctx, cancel := context.WithTimeout(ctx, interval)
+		err := s.backend.Set(pctx, probeKey, []byte("1"), time.Minute)
+		cancel()
+
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			s.fail(ctx, err)
+		case s.unavailable.CompareAndSwap(true, false):
+			s.failures.Store(0)
+			unavailableGauge.Set(0)
+			internal.SetHealth(HealthService, healthv1.HealthCheckResponse_SERVING)
+			slog.InfoContext(ctx, "storage backend is available again, leaving degraded mode")
+		default:
+			s.failures.Store(0)
+		}
+	}
+}
+
+// record counts err against the backend and reports whether it is a
+// failure to talk to the backend.
+func (s *Store) record(ctx context.Context, err error) bool {
+	if err == nil {
+		s.failures.Store(0)
+		return false
+	}
+
+	switch instrumented.Class(err) {
+	case instrumented.ClassTransport, instrumented.ClassTimeout:
+		s.fail(ctx, err)
+		return true
+	default:
+		return false
+	}
+}
+
+// fail counts a failure and marks the backend unavailable once there were
+// enough of them in a row.
+func (s *Store) fail(ctx context.Context, err error) {
+	if s.failures.Add(1) < s.threshold {
+		return
+	}
+
+	if s.unavailable.CompareAndSwap(false, true) {
+		trips.Inc()
+		unavailableGauge.Set(1)
+		internal.SetHealth(HealthService, healthv1.HealthCheckResponse_NOT_SERVING)
+		slog.ErrorContext(ctx, "storage backend is unavailable, entering degraded mode", "mode", s.mode, "err", err)
+	}
+}
+
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	if s.Unavailable() {
+		if s.fallback == nil {
+			return nil, ErrUnavailable
+		}
+		return s.fallback.Get(ctx, key)
+	}
+
+	value, err := s.backend.Get(ctx, key)
+	failed := s.record(ctx, err)
+
+	// Values written while the backend was unavailable only exist locally.
+	if s.fallback != nil && (failed || errors.Is(err, store.ErrNotFound)) {
+		return s.fallback.Get(ctx, key)
+	}
+
+	return value, err
+}
+
+func (s *Store) Set(ctx context.Context, key string, value []byte, expiry time.Duration) error {
+	if s.Unavailable() {
+		if s.fallback == nil {
+			return ErrUnavailable
+		}
+		return s.fallback.Set(ctx, key, value, expiry)
+	}
+
+	err := s.backend.Set(ctx, key, value, expiry)
+	if s.record(ctx, err) && s.fallback != nil {
+		return s.fallback.Set(ctx, key, value, expiry)
+	}
+
+	return err
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	if s.fallback != nil {
+		// The key may have been written locally while the backend was
+		// unavailable.
+		_ = s.fallback.Delete(ctx, key)
+	}
+
+	if s.Unavailable() {
+		if s.fallback == nil {
+			return ErrUnavailable
+		}
+		return nil
+	}
+
+	err := s.backend.Delete(ctx, key)
+	if s.record(ctx, err) && s.fallback != nil {
+		return nil
+	}
+
+	return err
+}
+
+func (s *Store) Increment(ctx context.Context, key string, delta int64, expiry time.Duration) (int64, error) {
+	if s.Unavailable() {
+		if s.fallback == nil {
+			return 0, ErrUnavailable
+		}
+		return store.Increment(ctx, s.fallback, key, delta, expiry)
+	}
+
+	result, err := store.Increment(ctx, s.backend, key, delta, expiry)
+	if s.record(ctx, err) && s.fallback != nil {
+		return store.Increment(ctx, s.fallback, key, delta, expiry)
+	}
+
+	return result, err
+}
+
+func (s *Store) CompareAndSwap(ctx context.Context, key string, old, value []byte, expiry time.Duration) (bool, error) {
+	if s.Unavailable() {
+		if s.fallback == nil {
+			return false, ErrUnavailable
+		}
+		return store.CompareAndSwap(ctx, s.fallback, key, old, value, expiry)
+	}
+
+	if s.fallback != nil && old == nil {
+		// Don't let a key that was set locally while the backend was
+		// unavailable, such as a spent challenge, be set again.
+		if _, err := s.fallback.Get(ctx, key); err == nil {
+			return false, nil
+		}
+	}
+
+	swapped, err := store.CompareAndSwap(ctx, s.backend, key, old, value, expiry)
+	failed := s.record(ctx, err)
+
+	// A value to replace may only exist locally if it was written while the
+	// backend was unavailable.
+	if s.fallback != nil && (failed || (err == nil && !swapped && old != nil)) {
+		return store.CompareAndSwap(ctx, s.fallback, key, old, value, expiry)
+	}
+
+	return swapped, err
+}
+
+func (s *Store) List(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	if s.Unavailable() {
+		if s.fallback == nil {
+			return ErrUnavailable
+		}
+		return store.List(ctx, s.fallback, prefix, fn)
+	}
+
+	err := store.List(ctx, s.backend, prefix, fn)
+	s.record(ctx, err)
+	return err
+}
+
+func (s *Store) IsPersistent() bool {
+	return s.backend.IsPersistent()
+}
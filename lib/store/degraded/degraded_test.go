@@ -0,0 +1,222 @@
+package degraded
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/internal"
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/memory"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var errDown = errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+
+// flakyStore is a memory store that fails every operation while it is down.
+type flakyStore struct {
+	store.Interface
+	down atomic.Bool
+}
+
+func (f *flakyStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if f.down.Load() {
+		return nil, errDown
+	}
+	return f.Interface.Get(ctx, key)
+}
+
+func (f *flakyStore) Set(ctx context.Context, key string, value []byte, expiry time.Duration) error {
+	if f.down.Load() {
+		return errDown
+	}
+	return f.Interface.Set(ctx, key, value, expiry)
+}
+
+func (f *flakyStore) Delete(ctx context.Context, key string) error {
+	if f.down.Load() {
+		return errDown
+	}
+	return f.Interface.Delete(ctx, key)
+}
+
+func newTestStore(t *testing.T, mode Mode) (*Store, *flakyStore) {
+	t.Helper()
+
+	backend := &flakyStore{Interface: memory.New(t.Context())}
+	s := New(t.Context(), backend, Config{
+		Mode:             mode,
+		FailureThreshold: 2,
+		ProbeInterval:    "10ms",
+	})
+
+	return s, backend
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func health(t *testing.T) healthv1.HealthCheckResponse_ServingStatus {
+	t.Helper()
+
+	st, ok := internal.GetHealth(HealthService)
+	if !ok {
+		t.Fatalf("health service %s does not exist", HealthService)
+	}
+	return st
+}
+
+func TestConfigValid(t *testing.T) {
+	for _, tt := range []struct {
+		err   error
+		name  string
+		input Config
+	}{
+		{
+			name:  "open",
+			input: Config{Mode: ModeOpen},
+		},
+		{
+			name:  "memory with options",
+			input: Config{Mode: ModeMemory, FailureThreshold: 3, ProbeInterval: "2s"},
+		},
+		{
+			name:  "stateless",
+			input: Config{Mode: ModeStateless},
+		},
+		{
+			name:  "no mode",
+			input: Config{},
+			err:   ErrUnknownMode,
+		},
+		{
+			name:  "unknown mode",
+			input: Config{Mode: "yolo"},
+			err:   ErrUnknownMode,
+		},
+		{
+			name:  "negative failure threshold",
+			input: Config{Mode: ModeDeny, FailureThreshold: -1},
+			err:   ErrBadFailureThreshold,
+		},
+		{
+			name:  "bad probe interval",
+			input: Config{Mode: ModeDeny, ProbeInterval: "soon"},
+			err:   ErrBadProbeInterval,
+		},
+		{
+			name:  "probe interval too long",
+			input: Config{Mode: ModeDeny, ProbeInterval: "24h"},
+			err:   ErrProbeIntervalTooLong,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.input.Valid(); !errors.Is(err, tt.err) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestDeny(t *testing.T) {
+	s, backend := newTestStore(t, ModeDeny)
+
+	if err := s.Set(t.Context(), "challenge:1", []byte("1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	backend.down.Store(true)
+
+	for range 2 {
+		// The probe may notice the outage first.
+		if _, err := s.Get(t.Context(), "challenge:1"); !errors.Is(err, errDown) && !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("wanted the backend's error, got: %v", err)
+		}
+	}
+
+	if !s.Unavailable() {
+		t.Fatal("backend is not unavailable after failing twice in a row")
+	}
+	if st := health(t); st != healthv1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("wanted health to be NOT_SERVING, got: %v", st)
+	}
+	if _, err := s.Get(t.Context(), "challenge:1"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("wanted ErrUnavailable, got: %v", err)
+	}
+
+	backend.down.Store(false)
+	waitFor(t, "the probe to notice the backend is back", func() bool { return !s.Unavailable() })
+
+	if st := health(t); st != healthv1.HealthCheckResponse_SERVING {
+		t.Errorf("wanted health to be SERVING, got: %v", st)
+	}
+	if val, err := s.Get(t.Context(), "challenge:1"); err != nil || string(val) != "1" {
+		t.Errorf("wanted challenge:1 to be 1, got: %q, %v", val, err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	s, backend := newTestStore(t, ModeMemory)
+
+	backend.down.Store(true)
+
+	// Writes that fail go to memory right away, before the backend is
+	// marked unavailable.
+	if err := s.Set(t.Context(), "challenge:1", []byte("1"), time.Minute); err != nil {
+		t.Fatalf("wanted the write to go to memory, got: %v", err)
+	}
+	if err := s.Set(t.Context(), "challenge:2", []byte("2"), time.Minute); err != nil {
+		t.Fatalf("wanted the write to go to memory, got: %v", err)
+	}
+
+	if !s.Unavailable() {
+		t.Fatal("backend is not unavailable after failing twice in a row")
+	}
+
+	if ok, err := store.SetNX(t.Context(), s, "challenge-spent:1", []byte("1"), time.Minute); err != nil || !ok {
+		t.Fatalf("wanted the challenge to be marked as spent, got: %v, %v", ok, err)
+	}
+
+	backend.down.Store(false)
+	waitFor(t, "the probe to notice the backend is back", func() bool { return !s.Unavailable() })
+
+	if val, err := s.Get(t.Context(), "challenge:2"); err != nil || string(val) != "2" {
+		t.Errorf("value written during the outage was lost, got: %q, %v", val, err)
+	}
+
+	if ok, err := store.SetNX(t.Context(), s, "challenge-spent:1", []byte("1"), time.Minute); err != nil || ok {
+		t.Errorf("challenge spent during the outage could be spent again, got: %v, %v", ok, err)
+	}
+
+	if err := s.Delete(t.Context(), "challenge:2"); err != nil && !errors.Is(err, store.ErrNotFound) {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(t.Context(), "challenge:2"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("wanted deleted value to be gone, got: %v", err)
+	}
+}
+
+func TestMissingKeysAreNotFailures(t *testing.T) {
+	s, _ := newTestStore(t, ModeDeny)
+
+	for range 10 {
+		if _, err := s.Get(t.Context(), "challenge:missing"); !errors.Is(err, store.ErrNotFound) {
+			t.Fatalf("wanted ErrNotFound, got: %v", err)
+		}
+	}
+
+	if s.Unavailable() {
+		t.Error("missing keys marked the backend unavailable")
+	}
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Record is a single line of a store dump.
+type Record struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+
+	// Expires is when the key expires. It is omitted if the key never
+	// expires.
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// Dump writes every key in s starting with prefix to w as JSON lines, one
+// Record per line. Keys that expire or are deleted while Dump runs are left
+// out. It returns how many records it wrote.
+func Dump(ctx context.Context, s Interface, prefix string, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	n := 0
+
+	err := List(ctx, s, prefix, func(e Entry) error {
+		value, err := s.Get(ctx, e.Key)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			return nil
+		case err != nil:
+			return fmt.Errorf("store: can't get %q: %w", e.Key, err)
+		}
+
+		if err := enc.Encode(Record{Key: e.Key, Value: value, Expires: e.Expires}); err != nil {
+			return err
+		}
+
+		n++
+		return nil
+	})
+
+	return n, err
+}
+
+// Restore reads records written by Dump from r and sets them in s. Records
+// that have expired since they were dumped are skipped. Records that never
+// expire are set to expire after defaultExpiry, as not every storage backend
+// can keep values forever. It returns how many records it restored.
+func Restore(ctx context.Context, s Interface, r io.Reader, defaultExpiry time.Duration) (int, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64*1024*1024)
+
+	n, line := 0, 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return n, fmt.Errorf("%w: line %d: %w", ErrCantDecode, line, err)
+		}
+
+		expiry := defaultExpiry
+		if !rec.Expires.IsZero() {
+			expiry = time.Until(rec.Expires)
+			if expiry <= 0 {
+				continue
+			}
+		}
+
+		if err := s.Set(ctx, rec.Key, rec.Value, expiry); err != nil {
+			return n, fmt.Errorf("store: can't set %q: %w", rec.Key, err)
+		}
+
+		n++
+	}
+
+	return n, sc.Err()
+}
@@ -0,0 +1,95 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/memory"
+)
+
+func TestDumpRestore(t *testing.T) {
+	src := memory.New(t.Context())
+
+	for key, value := range map[string]string{
+		"challenge:1":               `{"id":"1"}`,
+		"challenge:2":               `{"id":"2"}`,
+		"ogtags:allow:example.com/": "1",
+	} {
+		if err := src.Set(t.Context(), key, []byte(value), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := store.Dump(t.Context(), src, "challenge:", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("wanted 2 records to be dumped, got: %d", n)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("wanted one line per record, got: %q", buf.String())
+	}
+
+	var rec store.Record
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(rec.Expires); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("wanted the record to expire in an hour, got: %v", d)
+	}
+
+	dst := memory.New(t.Context())
+	if n, err := store.Restore(t.Context(), dst, &buf, time.Hour); err != nil || n != 2 {
+		t.Fatalf("wanted 2 records to be restored, got: %d, %v", n, err)
+	}
+
+	got, err := dst.Get(t.Context(), "challenge:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"id":"2"}` {
+		t.Errorf("restored the wrong value: %q", got)
+	}
+
+	if _, err := dst.Get(t.Context(), "ogtags:allow:example.com/"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("key outside the prefix was restored: %v", err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	s := memory.New(t.Context())
+
+	input := strings.Join([]string{
+		`{"key":"expired","value":"MQ==","expires":"2001-01-01T00:00:00Z"}`,
+		``,
+		`{"key":"forever","value":"MQ=="}`,
+	}, "\n")
+
+	n, err := store.Restore(t.Context(), s, strings.NewReader(input), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("wanted only the record without an expiry to be restored, got: %d", n)
+	}
+
+	if _, err := s.Get(t.Context(), "expired"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expired record was restored: %v", err)
+	}
+	if val, err := s.Get(t.Context(), "forever"); err != nil || string(val) != "1" {
+		t.Errorf("wanted forever to be 1, got: %q, %v", val, err)
+	}
+
+	if _, err := store.Restore(t.Context(), s, strings.NewReader("{\"key\":"), time.Minute); !errors.Is(err, store.ErrCantDecode) {
+		t.Errorf("wanted ErrCantDecode for a broken line, got: %v", err)
+	}
+}
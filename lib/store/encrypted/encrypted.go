@@ -0,0 +1,342 @@
+// Package encrypted implements a storage backend that encrypts values before
+// they are written to another storage backend, so that the client IP
+// addresses and user agents Anubis stores are not kept in plaintext.
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// version is the first byte of every stored value.
+const version byte = 1
+
+// Algorithm IDs stored in the header of every value.
+const (
+	algAESGCM byte = iota + 1
+	algXChaCha20Poly1305
+)
+
+var (
+	ErrUnknownKeyID = errors.New("encrypted: value was encrypted with an unknown key")
+	ErrCorrupt      = errors.New("encrypted: value is corrupt or was not encrypted by Anubis")
+)
+
+// Store encrypts values with AEAD before they are written to the store it
+// wraps, and decrypts them when they are read.
+//
+// Each value is stored with a header holding the format version, the
+// algorithm and the ID of the key it was encrypted with:
+//
+//	version (1 byte) | algorithm (1 byte) | key ID length (1 byte) | key ID | nonce | ciphertext
+//
+// The header and the key name are authenticated along with the value, so a
+// value can't be moved to another key without failing to decrypt.
+type Store struct {
+	backend store.Interface
+	alg     byte
+	active  Key
+	aeads   map[string]map[byte]cipher.AEAD
+	hashKey []byte
+}
+
+var (
+	_ store.Interface         = (*Store)(nil)
+	_ store.Incrementer       = (*Store)(nil)
+	_ store.CompareAndSwapper = (*Store)(nil)
+	_ store.Lister            = (*Store)(nil)
+)
+
+// New wraps backend. New values are encrypted with algorithm and the first
+// key in keys; any key in keys can decrypt. If hashKey is not nil, key names
+// are replaced by their HMAC-SHA256 keyed with hashKey.
+func New(backend store.Interface, algorithm string, keys []Key, hashKey []byte) (*Store, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	var alg byte
+	switch algorithm {
+	case AlgorithmAESGCM:
+		alg = algAESGCM
+	case AlgorithmXChaCha20Poly1305:
+		alg = algXChaCha20Poly1305
+	default:
+		return nil, fmt.Errorf("%w, got: %q", ErrUnknownAlgorithm, algorithm)
+	}
+
+	if hashKey != nil && len(hashKey) != KeySize {
+		return nil, ErrBadKey
+	}
+
+	aeads := map[string]map[byte]cipher.AEAD{}
+	for _, k := range keys {
+		if len(k.ID) == 0 || len(k.ID) > 255 {
+			return nil, fmt.Errorf("%w: %q", ErrBadKeyID, k.ID)
+		}
+		if _, ok := aeads[k.ID]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateKeyID, k.ID)
+		}
+		if len(k.Key) != KeySize {
+			return nil, fmt.Errorf("%w: %q", ErrBadKey, k.ID)
+		}
+
+		gcmKey, err := subkey(k.Key, AlgorithmAESGCM)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(gcmKey)
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		xchachaKey, err := subkey(k.Key, AlgorithmXChaCha20Poly1305)
+		if err != nil {
+			return nil, err
+		}
+		xchacha, err := chacha20poly1305.NewX(xchachaKey)
+		if err != nil {
+			return nil, err
+		}
+
+		aeads[k.ID] = map[byte]cipher.AEAD{
+			algAESGCM:            gcm,
+			algXChaCha20Poly1305: xchacha,
+		}
+	}
+
+	return &Store{
+		backend: backend,
+		alg:     alg,
+		active:  keys[0],
+		aeads:   aeads,
+		hashKey: hashKey,
+	}, nil
+}
+
+// subkey derives the key that algorithm uses from key, so that the same key
+// is never used with both algorithms. The algorithm byte in the header of a
+// value is not secret, but a value that claims the wrong algorithm is then
+// opened with a different key and fails to decrypt.
+func subkey(key []byte, algorithm string) ([]byte, error) {
+	return hkdf.Key(sha256.New, key, nil, "anubis encrypted store "+algorithm, KeySize)
+}
+
+// name returns the key name to use in the backend for key.
+func (s *Store) name(key string) string {
+	if s.hashKey == nil {
+		return key
+	}
+
+	mac := hmac.New(sha256.New, s.hashKey)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal encrypts value for key with the active key.
+func (s *Store) seal(key string, value []byte) ([]byte, error) {
+	aead := s.aeads[s.active.ID][s.alg]
+
+	header := make([]byte, 0, 3+len(s.active.ID)+aead.NonceSize())
+	header = append(header, version, s.alg, byte(len(s.active.ID)))
+	header = append(header, s.active.ID...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("%w: can't make nonce: %w", store.ErrCantEncode, err)
+	}
+
+	result := append(header, nonce...)
+	return aead.Seal(result, nonce, value, additionalData(header, key)), nil
+}
+
+// open decrypts data stored for key.
+func (s *Store) open(key string, data []byte) ([]byte, error) {
+	if len(data) < 3 || data[0] != version {
+		return nil, fmt.Errorf("%w: %w", store.ErrCantDecode, ErrCorrupt)
+	}
+
+	idLen := int(data[2])
+	if len(data) < 3+idLen {
+		return nil, fmt.Errorf("%w: %w", store.ErrCantDecode, ErrCorrupt)
+	}
+	header, rest := data[:3+idLen], data[3+idLen:]
+
+	keyID := string(header[3:])
+	aeads, ok := s.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %w: %q", store.ErrCantDecode, ErrUnknownKeyID, keyID)
+	}
+
+	aead, ok := aeads[header[1]]
+	if !ok || len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: %w", store.ErrCantDecode, ErrCorrupt)
+	}
+
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	result, err := aead.Open(nil, nonce, ciphertext, additionalData(header, key))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", store.ErrCantDecode, ErrCorrupt)
+	}
+
+	return result, nil
+}
+
+// additionalData binds a value to its header and the key it is stored at.
+func additionalData(header []byte, key string) []byte {
+	return append(bytes.Clone(header), key...)
+}
+
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := s.backend.Get(ctx, s.name(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.open(key, data)
+}
+
+func (s *Store) Set(ctx context.Context, key string, value []byte, expiry time.Duration) error {
+	data, err := s.seal(key, value)
+	if err != nil {
+		return err
+	}
+
+	return s.backend.Set(ctx, s.name(key), data, expiry)
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	return s.backend.Delete(ctx, s.name(key))
+}
+
+// Increment a counter. The backend can't add to an encrypted counter itself,
+// so the counter is read, decrypted and written back with a compare and swap
+// on the encrypted value, retrying if another writer got there first.
+func (s *Store) Increment(ctx context.Context, key string, delta int64, expiry time.Duration) (int64, error) {
+	name := s.name(key)
+
+	for {
+		current, err := s.getRaw(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+
+		var result int64
+		if current != nil {
+			value, err := s.open(key, current)
+			if err != nil {
+				return 0, err
+			}
+			if result, err = store.ParseCounter(value); err != nil {
+				return 0, err
+			}
+		}
+
+		result += delta
+		data, err := s.seal(key, store.FormatCounter(result))
+		if err != nil {
+			return 0, err
+		}
+
+		swapped, err := store.CompareAndSwap(ctx, s.backend, name, current, data, expiry)
+		if err != nil {
+			return 0, err
+		}
+		if swapped {
+			return result, nil
+		}
+	}
+}
+
+// CompareAndSwap a value. Values are encrypted with a random nonce, so the
+// same value is stored differently every time. The current value is read and
+// decrypted to compare it with old, then swapped with a compare and swap on
+// the encrypted value, retrying if another writer changed it in between.
+func (s *Store) CompareAndSwap(ctx context.Context, key string, old, value []byte, expiry time.Duration) (bool, error) {
+	name := s.name(key)
+
+	data, err := s.seal(key, value)
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		current, err := s.getRaw(ctx, name)
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case current == nil && old != nil, current != nil && old == nil:
+			return false, nil
+		case current != nil:
+			plain, err := s.open(key, current)
+			if err != nil {
+				return false, err
+			}
+			if !bytes.Equal(plain, old) {
+				return false, nil
+			}
+		}
+
+		swapped, err := store.CompareAndSwap(ctx, s.backend, name, current, data, expiry)
+		if err != nil || swapped {
+			return swapped, err
+		}
+
+		// Another writer created the key first, so it can't be missing any
+		// more.
+		if current == nil {
+			return false, nil
+		}
+	}
+}
+
+// getRaw returns the encrypted value at name in the backend, or nil if there
+// is none.
+func (s *Store) getRaw(ctx context.Context, name string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	data, err := s.backend.Get(ctx, name)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// List the keys of the backend. Hashed key names can't be turned back into
+// keys, so this only works if key names are not hashed.
+func (s *Store) List(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	if s.hashKey != nil {
+		return fmt.Errorf("%w: key names are hashed", store.ErrCantList)
+	}
+
+	return store.List(ctx, s.backend, prefix, fn)
+}
+
+func (s *Store) IsPersistent() bool {
+	return s.backend.IsPersistent()
+}
@@ -0,0 +1,256 @@
+package encrypted
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/memory"
+	"github.com/TecharoHQ/anubis/lib/store/storetest"
+)
+
+func newKey(t *testing.T, id string) Key {
+	t.Helper()
+
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	return Key{ID: id, Key: key}
+}
+
+func writeFile(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+
+	fname := filepath.Join(dir, name)
+	if err := os.WriteFile(fname, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return fname
+}
+
+func TestImpl(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmAESGCM, AlgorithmXChaCha20Poly1305} {
+		t.Run(algorithm, func(t *testing.T) {
+			dir := t.TempDir()
+			k := newKey(t, "test")
+			keyFile := writeFile(t, dir, "keys", fmt.Sprintf("%s %x\n", k.ID, k.Key))
+			// Only hash key names with one of the algorithms, so that listing
+			// keys is tested too.
+			var hashKeyFile string
+			if algorithm == AlgorithmAESGCM {
+				hashKeyFile = writeFile(t, dir, "hash-key", fmt.Sprintf("%x\n", newKey(t, "").Key))
+			}
+
+			data, err := json.Marshal(Config{
+				Backend:     "memory",
+				Algorithm:   algorithm,
+				KeyFile:     keyFile,
+				HashKeyFile: hashKeyFile,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			storetest.Common(t, Factory{}, json.RawMessage(data))
+		})
+	}
+}
+
+func TestNothingInPlaintext(t *testing.T) {
+	backend := memory.New(t.Context())
+	s, err := New(backend, AlgorithmAESGCM, []Key{newKey(t, "test")}, newKey(t, "").Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		key   = "challenge:198.51.100.7"
+		value = `{"remoteAddr":"198.51.100.7","userAgent":"Mozilla/5.0"}`
+	)
+
+	if err := s.Set(t.Context(), key, []byte(value), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.Get(t.Context(), key); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("key name was stored as is, got: %v", err)
+	}
+
+	data, err := backend.Get(t.Context(), s.name(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("198.51.100.7")) {
+		t.Error("value was stored in plaintext")
+	}
+
+	got, err := s.Get(t.Context(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != value {
+		t.Errorf("want: %q, got: %q", value, got)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	backend := memory.New(t.Context())
+	oldKey, currentKey := newKey(t, "old"), newKey(t, "new")
+
+	before, err := New(backend, AlgorithmAESGCM, []Key{oldKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := before.Set(t.Context(), "key", []byte("value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new key is active, and the old one can still decrypt. Switching the
+	// algorithm at the same time must not matter either.
+	after, err := New(backend, AlgorithmXChaCha20Poly1305, []Key{currentKey, oldKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := after.Get(t.Context(), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "value" {
+		t.Errorf("want: %q, got: %q", "value", got)
+	}
+
+	if err := after.Set(t.Context(), "key", []byte("value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the old key is gone, only values encrypted with the new key can be
+	// read.
+	retired, err := New(backend, AlgorithmAESGCM, []Key{currentKey}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retired.Get(t.Context(), "key"); err != nil {
+		t.Errorf("value written with the new key can't be read: %v", err)
+	}
+
+	if err := before.Set(t.Context(), "key", []byte("value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := retired.Get(t.Context(), "key"); !errors.Is(err, store.ErrCantDecode) || !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("wanted ErrCantDecode and ErrUnknownKeyID, got: %v", err)
+	}
+}
+
+func TestValueBoundToKey(t *testing.T) {
+	backend := memory.New(t.Context())
+	s, err := New(backend, AlgorithmAESGCM, []Key{newKey(t, "test")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set(t.Context(), "a", []byte("value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// Copying the encrypted value of one key to another must not work.
+	data, err := backend.Get(t.Context(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Set(t.Context(), "b", data, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(t.Context(), "b"); !errors.Is(err, store.ErrCantDecode) {
+		t.Errorf("wanted ErrCantDecode, got: %v", err)
+	}
+
+	// Nor must claiming another algorithm in the header, as each algorithm
+	// uses its own key derived from the configured one.
+	data[1] = algXChaCha20Poly1305
+	if err := backend.Set(t.Context(), "a", data, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(t.Context(), "a"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("wanted ErrCorrupt for a value with the wrong algorithm, got: %v", err)
+	}
+
+	// Neither must values that were never encrypted.
+	if err := backend.Set(t.Context(), "c", []byte("plaintext"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(t.Context(), "c"); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("wanted ErrCorrupt, got: %v", err)
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	dir := t.TempDir()
+	k1, k2 := newKey(t, "2026-10"), newKey(t, "2026-04")
+	hexKey := hex.EncodeToString(k1.Key)
+
+	for _, tt := range []struct {
+		err      error
+		name     string
+		contents string
+		want     []string
+	}{
+		{
+			name:     "two keys",
+			contents: fmt.Sprintf("# new values use the first key\n\n%s %x\n  %s   %x  \n", k1.ID, k1.Key, k2.ID, k2.Key),
+			want:     []string{"2026-10", "2026-04"},
+		},
+		{
+			name:     "empty",
+			contents: "# nothing here\n",
+			err:      ErrNoKeys,
+		},
+		{
+			name:     "missing key",
+			contents: "2026-10\n",
+			err:      ErrBadKeyLine,
+		},
+		{
+			name:     "short key",
+			contents: "2026-10 abcd\n",
+			err:      ErrBadKey,
+		},
+		{
+			name:     "not hex",
+			contents: "2026-10 " + hexKey[:62] + "zz\n",
+			err:      ErrBadKey,
+		},
+		{
+			name:     "duplicate ID",
+			contents: "a " + hexKey + "\na " + hexKey + "\n",
+			err:      ErrDuplicateKeyID,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := LoadKeys(writeFile(t, dir, "keys", tt.contents))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("want: %v, got: %v", tt.err, err)
+			}
+
+			var ids []string
+			for _, k := range keys {
+				ids = append(ids, k.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("want key IDs %v, got: %v", tt.want, ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package encrypted
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+)
+
+const (
+	AlgorithmAESGCM            = "aes-256-gcm"
+	AlgorithmXChaCha20Poly1305 = "xchacha20-poly1305"
+)
+
+var (
+	ErrNoBackend        = errors.New("encrypted.Config: backend is missing from config")
+	ErrUnknownBackend   = errors.New("encrypted.Config: unknown backend")
+	ErrNestedEncryption = errors.New("encrypted.Config: backend can't be another encrypted store")
+	ErrBackendNotValid  = errors.New("encrypted.Config: backend parameters are not valid")
+	ErrNoKeyFile        = errors.New("encrypted.Config: keyFile is missing from config")
+	ErrUnknownAlgorithm = errors.New("encrypted.Config: algorithm must be aes-256-gcm or xchacha20-poly1305")
+)
+
+func init() {
+	store.Register("encrypted", Factory{})
+}
+
+// Factory builds new instances of the encrypting storage backend according
+// to configuration passed via a json.RawMessage.
+type Factory struct{}
+
+// Build parses and validates the encrypted Config, loads its keys and builds
+// the backend it wraps.
+func (Factory) Build(ctx context.Context, data json.RawMessage) (store.Interface, error) {
+	var config Config
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		return nil, fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	if err := config.Valid(); err != nil {
+		return nil, fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	keys, err := LoadKeys(config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	var hashKey []byte
+	if config.HashKeyFile != "" {
+		if hashKey, err = LoadHashKey(config.HashKeyFile); err != nil {
+			return nil, fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+		}
+	}
+
+	fac, _ := store.Get(config.Backend)
+	backend, err := fac.Build(ctx, config.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted: can't build %s backend: %w", config.Backend, err)
+	}
+
+	return New(backend, config.algorithm(), keys, hashKey)
+}
+
+// Valid parses and validates the encrypted Config, including the parameters
+// of the backend it wraps, or returns an error.
+func (Factory) Valid(data json.RawMessage) error {
+	var config Config
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		return fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	if err := config.Valid(); err != nil {
+		return fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	return nil
+}
+
+// Config is the encrypting storage backend configuration.
+type Config struct {
+	// Backend is the name of the storage backend to encrypt values for, such
+	// as s3api.
+	Backend string `json:"backend"`
+
+	// Parameters are passed to Backend as is.
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+
+	// Algorithm encrypts new values. Values written with the other algorithm
+	// can still be read. Defaults to AlgorithmXChaCha20Poly1305, whose 192-bit
+	// random nonces can't realistically repeat no matter how many values are
+	// written with one key. AES-GCM's 96-bit random nonces limit a key to
+	// about 2^32 writes, which a busy instance can reach with counters.
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// KeyFile is the path to the file holding the encryption keys. See
+	// LoadKeys for its format.
+	KeyFile string `json:"keyFile"`
+
+	// HashKeyFile is the path to a file holding a hex-encoded 32 byte secret.
+	// When set, key names are replaced by their HMAC-SHA256 before they are
+	// passed to Backend, so that IP addresses in them are not stored either.
+	HashKeyFile string `json:"hashKeyFile,omitempty"`
+}
+
+// Valid validates the configuration.
+func (c Config) Valid() error {
+	var errs []error
+
+	switch c.Backend {
+	case "":
+		errs = append(errs, ErrNoBackend)
+	case "encrypted":
+		errs = append(errs, ErrNestedEncryption)
+	default:
+		fac, ok := store.Get(c.Backend)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrUnknownBackend, c.Backend))
+			break
+		}
+
+		if err := fac.Valid(c.Parameters); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %w", ErrBackendNotValid, err))
+		}
+	}
+
+	switch c.Algorithm {
+	case "", AlgorithmAESGCM, AlgorithmXChaCha20Poly1305:
+	default:
+		errs = append(errs, fmt.Errorf("%w, got: %q", ErrUnknownAlgorithm, c.Algorithm))
+	}
+
+	if c.KeyFile == "" {
+		errs = append(errs, ErrNoKeyFile)
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+func (c Config) algorithm() string {
+	if c.Algorithm == "" {
+		return AlgorithmXChaCha20Poly1305
+	}
+	return c.Algorithm
+}
@@ -0,0 +1,71 @@
+package encrypted
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/TecharoHQ/anubis/lib/store/bbolt"
+	_ "github.com/TecharoHQ/anubis/lib/store/memory"
+)
+
+func TestFactoryValid(t *testing.T) {
+	f := Factory{}
+
+	t.Run("bad config", func(t *testing.T) {
+		if err := f.Valid(json.RawMessage(`}`)); err == nil {
+			t.Error("wanted parsing failure but got a successful result")
+		}
+	})
+
+	for _, tt := range []struct {
+		err  error
+		name string
+		cfg  string
+	}{
+		{
+			name: "memory backend",
+			cfg:  `{"backend": "memory", "keyFile": "/run/secrets/anubis-store-keys"}`,
+		},
+		{
+			name: "all options",
+			cfg:  `{"backend": "memory", "algorithm": "xchacha20-poly1305", "keyFile": "/run/secrets/anubis-store-keys", "hashKeyFile": "/run/secrets/anubis-store-hash-key"}`,
+		},
+		{
+			name: "missing backend",
+			cfg:  `{"keyFile": "/run/secrets/anubis-store-keys"}`,
+			err:  ErrNoBackend,
+		},
+		{
+			name: "unknown backend",
+			cfg:  `{"backend": "floppy", "keyFile": "/run/secrets/anubis-store-keys"}`,
+			err:  ErrUnknownBackend,
+		},
+		{
+			name: "encrypted twice",
+			cfg:  `{"backend": "encrypted", "keyFile": "/run/secrets/anubis-store-keys"}`,
+			err:  ErrNestedEncryption,
+		},
+		{
+			name: "invalid backend parameters",
+			cfg:  `{"backend": "bbolt", "parameters": {}, "keyFile": "/run/secrets/anubis-store-keys"}`,
+			err:  bbolt.ErrMissingPath,
+		},
+		{
+			name: "missing keyFile",
+			cfg:  `{"backend": "memory"}`,
+			err:  ErrNoKeyFile,
+		},
+		{
+			name: "unknown algorithm",
+			cfg:  `{"backend": "memory", "algorithm": "rot13", "keyFile": "/run/secrets/anubis-store-keys"}`,
+			err:  ErrUnknownAlgorithm,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := f.Valid(json.RawMessage(tt.cfg)); !errors.Is(err, tt.err) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+		})
+	}
+}
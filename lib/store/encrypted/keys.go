@@ -0,0 +1,115 @@
+package encrypted
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeySize is the size of every encryption and hashing key in bytes.
+const KeySize = 32
+
+var (
+	ErrNoKeys         = errors.New("encrypted: key file holds no keys")
+	ErrBadKeyLine     = errors.New("encrypted: key file lines must be a key ID and a hex-encoded key")
+	ErrBadKey         = errors.New("encrypted: keys must be 32 bytes encoded as 64 hex characters")
+	ErrBadKeyID       = errors.New("encrypted: key IDs must be between 1 and 255 bytes long")
+	ErrDuplicateKeyID = errors.New("encrypted: duplicate key ID")
+)
+
+// Key is a single encryption key.
+type Key struct {
+	// ID is stored in front of every value encrypted with this key, so that
+	// the right key can be found to decrypt it.
+	ID  string
+	Key []byte
+}
+
+// LoadKeys reads encryption keys from a file. Each line holds a key ID and
+// a hex-encoded 32 byte key separated by whitespace. Empty lines and lines
+// starting with # are ignored:
+//
+//	# new values are encrypted with the first key
+//	2026-10 5c1e...
+//	2026-04 9a07...
+//
+// The first key encrypts new values. All keys can decrypt values that were
+// encrypted with them, so keys can be rotated by adding a new key to the top
+// of the file and removing the old one once everything it encrypted has
+// expired.
+func LoadKeys(fname string) ([]Key, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted: can't read key file: %w", err)
+	}
+
+	var (
+		keys []Key
+		seen = map[string]bool{}
+		sc   = bufio.NewScanner(bytes.NewReader(data))
+		line = 0
+	)
+
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: line %d", ErrBadKeyLine, line)
+		}
+
+		id := fields[0]
+		if len(id) > 255 {
+			return nil, fmt.Errorf("%w: line %d", ErrBadKeyID, line)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateKeyID, id)
+		}
+		seen[id] = true
+
+		key, err := parseKey(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d", err, line)
+		}
+
+		keys = append(keys, Key{ID: id, Key: key})
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("encrypted: can't read key file: %w", err)
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	return keys, nil
+}
+
+// LoadHashKey reads the hex-encoded 32 byte key used to hash key names from
+// a file.
+func LoadHashKey(fname string) ([]byte, error) {
+	data, err := os.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted: can't read hash key file: %w", err)
+	}
+
+	return parseKey(strings.TrimSpace(string(data)))
+}
+
+func parseKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != KeySize {
+		return nil, ErrBadKey
+	}
+
+	return key, nil
+}
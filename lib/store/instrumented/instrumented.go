@@ -0,0 +1,171 @@
+// Package instrumented wraps a storage backend to export how long its
+// operations take and how often they fail as Prometheus metrics.
+package instrumented
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	ClassNotFound   = "not_found"
+	ClassCantDecode = "cant_decode"
+	ClassCantEncode = "cant_encode"
+	ClassTimeout    = "timeout"
+	ClassCanceled   = "canceled"
+	ClassCantList   = "cant_list"
+	ClassTransport  = "transport"
+)
+
+var (
+	operationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "anubis_store_operation_duration_seconds",
+		Help: "How long storage backend operations take",
+		// From a tenth of a millisecond for local stores to several seconds
+		// for a struggling remote one.
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 9),
+	}, []string{"backend", "op", "prefix"})
+
+	operationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "anubis_store_errors_total",
+		Help: "Storage backend operations that returned an error, by class of error",
+	}, []string{"backend", "op", "prefix", "class"})
+)
+
+// prefixes maps the key prefixes Anubis uses to metric labels. Keys are
+// matched against these in order, so longer prefixes that share a start with
+// shorter ones come first. Everything else is labelled "other", so that the
+// number of label values stays fixed no matter what keys are used.
+var prefixes = []struct {
+	prefix, label string
+}{
+	{"challenge-spent:", "challenge_spent"},
+	{"challenge-attempts:", "challenge_attempts"},
+	{"challenge-plugin:", "challenge_plugin"},
+	{"challenges-outstanding:", "challenges_outstanding"},
+	{"challenge:", "challenge"},
+	{"ogtags:", "ogtags"},
+	{"dronebl:", "dronebl"},
+	{"honeypot:", "honeypot"},
+	{"forwardDNS", "dns"},
+	{"reverseDNS", "dns"},
+	{"revoked:", "revoked"},
+	{"webhook:", "webhook"},
+}
+
+// Prefix returns the metric label for the kind of key key is.
+func Prefix(key string) string {
+	for _, p := range prefixes {
+		if strings.HasPrefix(key, p.prefix) {
+			return p.label
+		}
+	}
+
+	return "other"
+}
+
+// Class returns the metric label for the kind of error err is.
+func Class(err error) string {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return ClassNotFound
+	case errors.Is(err, store.ErrCantDecode):
+		return ClassCantDecode
+	case errors.Is(err, store.ErrCantEncode):
+		return ClassCantEncode
+	case errors.Is(err, store.ErrCantList):
+		return ClassCantList
+	case errors.Is(err, context.DeadlineExceeded):
+		return ClassTimeout
+	case errors.Is(err, context.Canceled):
+		return ClassCanceled
+	default:
+		// Anything else is a problem talking to the backend, such as a
+		// connection error.
+		return ClassTransport
+	}
+}
+
+// Store records metrics for every operation on the store it wraps.
+type Store struct {
+	backend store.Interface
+	name    string
+}
+
+var (
+	_ store.Interface         = (*Store)(nil)
+	_ store.Incrementer       = (*Store)(nil)
+	_ store.CompareAndSwapper = (*Store)(nil)
+	_ store.Lister            = (*Store)(nil)
+)
+
+// New wraps backend, labelling its metrics with the backend name.
+func New(backend store.Interface, name string) *Store {
+	return &Store{
+		backend: backend,
+		name:    name,
+	}
+}
+
+// observe records that op on key took since start and failed with err, if
+// err is not nil.
+func (s *Store) observe(op, key string, start time.Time, err error) {
+	prefix := Prefix(key)
+	operationDuration.WithLabelValues(s.name, op, prefix).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		operationErrors.WithLabelValues(s.name, op, prefix, Class(err)).Inc()
+	}
+}
+
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	start := time.Now()
+	result, err := s.backend.Get(ctx, key)
+	s.observe("get", key, start, err)
+	return result, err
+}
+
+func (s *Store) Set(ctx context.Context, key string, value []byte, expiry time.Duration) error {
+	start := time.Now()
+	err := s.backend.Set(ctx, key, value, expiry)
+	s.observe("set", key, start, err)
+	return err
+}
+
+func (s *Store) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := s.backend.Delete(ctx, key)
+	s.observe("delete", key, start, err)
+	return err
+}
+
+func (s *Store) Increment(ctx context.Context, key string, delta int64, expiry time.Duration) (int64, error) {
+	start := time.Now()
+	result, err := store.Increment(ctx, s.backend, key, delta, expiry)
+	s.observe("increment", key, start, err)
+	return result, err
+}
+
+func (s *Store) CompareAndSwap(ctx context.Context, key string, old, value []byte, expiry time.Duration) (bool, error) {
+	start := time.Now()
+	result, err := store.CompareAndSwap(ctx, s.backend, key, old, value, expiry)
+	s.observe("compare_and_swap", key, start, err)
+	return result, err
+}
+
+func (s *Store) List(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	start := time.Now()
+	err := store.List(ctx, s.backend, prefix, fn)
+	s.observe("list", prefix, start, err)
+	return err
+}
+
+func (s *Store) IsPersistent() bool {
+	return s.backend.IsPersistent()
+}
@@ -0,0 +1,92 @@
+package instrumented
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/memory"
+	"github.com/TecharoHQ/anubis/lib/store/storetest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// factory builds instrumented memory stores for storetest.
+type factory struct{}
+
+func (factory) Build(ctx context.Context, _ json.RawMessage) (store.Interface, error) {
+	return New(memory.New(ctx), "test"), nil
+}
+
+func (factory) Valid(json.RawMessage) error { return nil }
+
+func TestImpl(t *testing.T) {
+	storetest.Common(t, factory{}, json.RawMessage(`{}`))
+}
+
+func TestPrefix(t *testing.T) {
+	for _, tt := range []struct {
+		key, want string
+	}{
+		{"challenge:0199b2f0", "challenge"},
+		{"challenge-spent:0199b2f0", "challenge_spent"},
+		{"challenges-outstanding:198.51.100.7", "challenges_outstanding"},
+		{"ogtags:allow:example.com/", "ogtags"},
+		{"dronebl:198.51.100.7", "dronebl"},
+		{"honeypot:network1234", "honeypot"},
+		{"forwardDNSexample.com", "dns"},
+		{"reverseDNS198.51.100.7", "dns"},
+		{"revoked:ip:198.51.100.7", "revoked"},
+		{"something-new:1234", "other"},
+		{"", "other"},
+	} {
+		if got := Prefix(tt.key); got != tt.want {
+			t.Errorf("Prefix(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestClass(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: %q", store.ErrNotFound, "key"), ClassNotFound},
+		{fmt.Errorf("%w: bad json", store.ErrCantDecode), ClassCantDecode},
+		{store.ErrCantEncode, ClassCantEncode},
+		{fmt.Errorf("dial: %w", context.DeadlineExceeded), ClassTimeout},
+		{context.Canceled, ClassCanceled},
+		{fmt.Errorf("%w: *s3api.Store", store.ErrCantList), ClassCantList},
+		{errors.New("connection refused"), ClassTransport},
+	} {
+		if got := Class(tt.err); got != tt.want {
+			t.Errorf("Class(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s := New(memory.New(t.Context()), t.Name())
+	series := testutil.CollectAndCount(operationDuration)
+
+	if err := s.Set(t.Context(), "challenge:1234", []byte("{}"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(t.Context(), "challenge:1234"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(t.Context(), "challenge:5678"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("wanted ErrNotFound, got: %v", err)
+	}
+
+	if n := testutil.CollectAndCount(operationDuration) - series; n != 2 {
+		t.Errorf("wanted a histogram for get and set, got %d new ones", n)
+	}
+
+	if got := testutil.ToFloat64(operationErrors.WithLabelValues(t.Name(), "get", "challenge", ClassNotFound)); got != 1 {
+		t.Errorf("wanted one not found error to be counted, got %v", got)
+	}
+}
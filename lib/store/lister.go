@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCantList is returned by List when a storage backend can't list its keys.
+var ErrCantList = errors.New("store: backend can't list keys")
+
+// Entry is a key held by a storage backend.
+type Entry struct {
+	Key string
+
+	// Expires is when the key expires. It is zero if the key never expires.
+	Expires time.Time
+}
+
+// Lister is implemented by storage backends that can list the keys they hold.
+// Anubis itself never lists keys; this is for inspecting and migrating
+// stores.
+type Lister interface {
+	// List calls fn for every key starting with prefix that has not expired,
+	// in no particular order. Keys set or deleted while List runs may or may
+	// not be seen. If fn returns an error, List stops and returns it.
+	List(ctx context.Context, prefix string, fn func(Entry) error) error
+}
+
+// List calls fn for every key in s starting with prefix, or returns
+// ErrCantList if s is not a Lister.
+func List(ctx context.Context, s Interface, prefix string, fn func(Entry) error) error {
+	l, ok := s.(Lister)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrCantList, s)
+	}
+
+	return l.List(ctx, prefix, fn)
+}
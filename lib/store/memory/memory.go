@@ -1,27 +1,174 @@
 package memory
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/TecharoHQ/anubis/decaymap"
 	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// entryOverhead is roughly how many bytes an entry takes up in addition to
+// its key and value.
+const entryOverhead = 64
+
+// protectedPrefixes are the prefixes of keys that are only evicted to stay
+// within the protected limits, as dropping them early would let clients
+// through that should be stopped: revoked tokens would be accepted again and
+// spent challenges could be redeemed again. Honeypot counters are not
+// protected, clients control how many there are and forgetting one early
+// only makes a client look less suspicious for a while.
+var protectedPrefixes = []string{
+	"revoked:",
+	"challenge-spent:",
+}
+
+// evictable reports whether the value at key may be dropped before it
+// expires.
+func evictable(key string, _ []byte) bool {
+	for _, prefix := range protectedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+var (
+	ErrBadMaxEntries = errors.New("memory.Config: maxEntries must not be negative")
+	ErrBadMaxBytes   = errors.New("memory.Config: maxBytes must not be negative")
+
+	ErrBadMaxProtectedEntries = errors.New("memory.Config: maxProtectedEntries must not be negative or more than maxEntries")
+	ErrBadMaxProtectedBytes   = errors.New("memory.Config: maxProtectedBytes must not be negative or more than maxBytes")
+)
+
+var (
+	// live holds every memory store that is in use, so that the size
+	// metrics cover all of them.
+	live sync.Map
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "anubis_store_memory_entries",
+		Help: "Number of values held by the memory storage backend, including expired ones that haven't been dropped yet",
+	}, func() float64 {
+		var n int
+		live.Range(func(key, _ any) bool {
+			n += key.(*impl).store.Len()
+			return true
+		})
+		return float64(n)
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "anubis_store_memory_bytes",
+		Help: "Approximate size of the values held by the memory storage backend",
+	}, func() float64 {
+		var n int64
+		live.Range(func(key, _ any) bool {
+			n += key.(*impl).store.Bytes()
+			return true
+		})
+		return float64(n)
+	})
+
+	evictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "anubis_store_memory_evictions_total",
+		Help: "Values the memory storage backend dropped before they expired to stay within maxEntries or maxBytes",
+	})
 )
 
 type factory struct{}
 
-func (factory) Build(ctx context.Context, _ json.RawMessage) (store.Interface, error) {
-	return New(ctx), nil
+func (factory) Build(ctx context.Context, data json.RawMessage) (store.Interface, error) {
+	config, err := parseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithConfig(ctx, config), nil
 }
 
-func (factory) Valid(json.RawMessage) error { return nil }
+func (factory) Valid(data json.RawMessage) error {
+	_, err := parseConfig(data)
+	return err
+}
 
 func init() {
 	store.Register("memory", factory{})
 }
 
+func parseConfig(data json.RawMessage) (Config, error) {
+	var config Config
+	if len(data) != 0 {
+		if err := json.Unmarshal([]byte(data), &config); err != nil {
+			return config, fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+		}
+	}
+
+	if err := config.Valid(); err != nil {
+		return config, fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	return config, nil
+}
+
+// Config is the memory storage backend configuration. The zero value has no
+// limits.
+type Config struct {
+	// MaxEntries is the most values the store holds. When it is full, the
+	// least recently used value is dropped, roughly. Zero means no limit.
+	MaxEntries int `json:"maxEntries,omitempty"`
+
+	// MaxBytes is roughly the most memory the values in the store take up.
+	// Zero means no limit.
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+
+	// MaxProtectedEntries is the most revocations and spent challenges the
+	// store holds. They are only dropped to stay within this limit and
+	// MaxProtectedBytes. Zero means half of MaxEntries.
+	MaxProtectedEntries int `json:"maxProtectedEntries,omitempty"`
+
+	// MaxProtectedBytes is roughly the most memory revocations and spent
+	// challenges take up. Zero means half of MaxBytes.
+	MaxProtectedBytes int64 `json:"maxProtectedBytes,omitempty"`
+}
+
+// Valid validates the configuration.
+func (c Config) Valid() error {
+	var errs []error
+
+	if c.MaxEntries < 0 {
+		errs = append(errs, fmt.Errorf("%w, got: %d", ErrBadMaxEntries, c.MaxEntries))
+	}
+
+	if c.MaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("%w, got: %d", ErrBadMaxBytes, c.MaxBytes))
+	}
+
+	if c.MaxProtectedEntries < 0 || (c.MaxEntries > 0 && c.MaxProtectedEntries > c.MaxEntries) {
+		errs = append(errs, fmt.Errorf("%w, got: %d", ErrBadMaxProtectedEntries, c.MaxProtectedEntries))
+	}
+
+	if c.MaxProtectedBytes < 0 || (c.MaxBytes > 0 && c.MaxProtectedBytes > c.MaxBytes) {
+		errs = append(errs, fmt.Errorf("%w, got: %d", ErrBadMaxProtectedBytes, c.MaxProtectedBytes))
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
 type impl struct {
 	store *decaymap.Impl[string, []byte]
 }
@@ -48,6 +195,61 @@ func (i *impl) Set(_ context.Context, key string, value []byte, expiry time.Dura
 	return nil
 }
 
+func (i *impl) Increment(_ context.Context, key string, delta int64, expiry time.Duration) (int64, error) {
+	var result int64
+	var err error
+
+	i.store.Update(key, expiry, func(value []byte, ok bool) ([]byte, bool) {
+		result = 0
+		if ok {
+			if result, err = store.ParseCounter(value); err != nil {
+				return nil, false
+			}
+		}
+
+		result += delta
+		return store.FormatCounter(result), true
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return result, nil
+}
+
+func (i *impl) CompareAndSwap(_ context.Context, key string, old, value []byte, expiry time.Duration) (bool, error) {
+	return i.store.Update(key, expiry, func(current []byte, ok bool) ([]byte, bool) {
+		if old == nil {
+			return value, !ok
+		}
+
+		return value, ok && bytes.Equal(current, old)
+	}), nil
+}
+
+func (i *impl) List(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	// fn may use the store, so collect the keys before calling it.
+	var entries []store.Entry
+	i.store.Range(func(key string, _ []byte, expiry time.Time) bool {
+		if strings.HasPrefix(key, prefix) {
+			entries = append(entries, store.Entry{Key: key, Expires: expiry})
+		}
+		return true
+	})
+
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (i *impl) IsPersistent() bool {
 	return false
 }
@@ -59,6 +261,7 @@ func (i *impl) cleanupThread(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
+			live.Delete(i)
 			return
 		case <-t.C:
 			i.store.Cleanup()
@@ -66,12 +269,36 @@ func (i *impl) cleanupThread(ctx context.Context) {
 	}
 }
 
-// New creates a simple in-memory store. This will not scale to multiple Anubis instances.
+// New creates a simple in-memory store without limits. This will not scale to multiple Anubis instances.
 func New(ctx context.Context) store.Interface {
+	return NewWithConfig(ctx, Config{})
+}
+
+// NewWithConfig creates an in-memory store that holds no more than config
+// allows.
+func NewWithConfig(ctx context.Context, config Config) store.Interface {
+	if config.MaxProtectedEntries == 0 {
+		config.MaxProtectedEntries = config.MaxEntries / 2
+	}
+	if config.MaxProtectedBytes == 0 {
+		config.MaxProtectedBytes = config.MaxBytes / 2
+	}
+
 	result := &impl{
-		store: decaymap.New[string, []byte](),
+		store: decaymap.NewWithLimits(decaymap.Limits[string, []byte]{
+			MaxEntries:        config.MaxEntries,
+			MaxBytes:          config.MaxBytes,
+			MaxProtected:      config.MaxProtectedEntries,
+			MaxProtectedBytes: config.MaxProtectedBytes,
+			Size: func(key string, value []byte) int64 {
+				return int64(len(key) + len(value) + entryOverhead)
+			},
+			OnEvict:   func(string, []byte) { evictions.Inc() },
+			Evictable: evictable,
+		}),
 	}
 
+	live.Store(result, struct{}{})
 	go result.cleanupThread(ctx)
 
 	return result
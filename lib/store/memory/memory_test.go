@@ -1,11 +1,156 @@
 package memory
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/TecharoHQ/anubis/lib/store"
 	"github.com/TecharoHQ/anubis/lib/store/storetest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestImpl(t *testing.T) {
 	storetest.Common(t, factory{}, nil)
 }
+
+func TestImplWithLimits(t *testing.T) {
+	storetest.Common(t, factory{}, json.RawMessage(`{"maxEntries": 1000, "maxBytes": 1048576}`))
+}
+
+func TestFactoryValid(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		name string
+		cfg  string
+	}{
+		{
+			name: "no parameters",
+			cfg:  ``,
+		},
+		{
+			name: "empty",
+			cfg:  `{}`,
+		},
+		{
+			name: "limits",
+			cfg:  `{"maxEntries": 100000, "maxBytes": 268435456}`,
+		},
+		{
+			name: "negative maxEntries",
+			cfg:  `{"maxEntries": -1}`,
+			err:  ErrBadMaxEntries,
+		},
+		{
+			name: "negative maxBytes",
+			cfg:  `{"maxBytes": -1}`,
+			err:  ErrBadMaxBytes,
+		},
+		{
+			name: "protected limits",
+			cfg:  `{"maxEntries": 100, "maxProtectedEntries": 10, "maxProtectedBytes": 4096}`,
+		},
+		{
+			name: "maxProtectedEntries over maxEntries",
+			cfg:  `{"maxEntries": 10, "maxProtectedEntries": 20}`,
+			err:  ErrBadMaxProtectedEntries,
+		},
+		{
+			name: "negative maxProtectedBytes",
+			cfg:  `{"maxProtectedBytes": -1}`,
+			err:  ErrBadMaxProtectedBytes,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := (factory{}).Valid(json.RawMessage(tt.cfg)); !errors.Is(err, tt.err) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	before := testutil.ToFloat64(evictions)
+
+	s := NewWithConfig(t.Context(), Config{MaxEntries: 10, MaxBytes: 1024}).(*impl)
+
+	// Values that keep clients out must survive the flood.
+	protected := []string{"revoked:jti", "challenge-spent:01997e6e-8f3e-7b2a-9a2e-2f0f7f6c1b2d"}
+	for _, key := range protected {
+		if err := s.Set(t.Context(), key, []byte("1"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A flood of unique clients, each leaving a challenge behind.
+	for i := range 100 {
+		key := fmt.Sprintf("challenge:%d", i)
+		if err := s.Set(t.Context(), key, []byte(`{"id":"01997e6e-8f3e-7b2a-9a2e-2f0f7f6c1b2d"}`), 30*time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := s.store.Len(); n > 10 {
+		t.Errorf("store holds %d entries, over its limit of 10", n)
+	}
+	if n := s.store.Bytes(); n > 1024 {
+		t.Errorf("store holds %d bytes, over its limit of 1024", n)
+	}
+
+	if _, err := s.Get(t.Context(), "challenge:99"); err != nil {
+		t.Errorf("the newest value was evicted: %v", err)
+	}
+
+	for _, key := range protected {
+		if _, err := s.Get(t.Context(), key); err != nil {
+			t.Errorf("%s was evicted: %v", key, err)
+		}
+	}
+
+	if n := testutil.ToFloat64(evictions) - before; n < 85 {
+		t.Errorf("wanted at least 85 evictions to be counted, got: %v", n)
+	}
+}
+
+func TestProtectedLimits(t *testing.T) {
+	s := NewWithConfig(t.Context(), Config{MaxEntries: 20, MaxProtectedEntries: 5}).(*impl)
+
+	// Honeypot counters are created by clients, so they are dropped like
+	// any other value.
+	for i := range 100 {
+		if err := s.Set(t.Context(), fmt.Sprintf("honeypot:network:%d", i), []byte("1"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := s.store.Len(); n > 20 {
+		t.Errorf("store holds %d entries, over its limit of 20", n)
+	}
+
+	// Protected values have a limit of their own.
+	for i := range 100 {
+		if err := s.Set(t.Context(), fmt.Sprintf("challenge-spent:%d", i), []byte("1"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var spent int
+	if err := s.List(t.Context(), "challenge-spent:", func(store.Entry) error {
+		spent++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if spent != 5 {
+		t.Errorf("wanted 5 spent challenges to be kept, got: %d", spent)
+	}
+	if n := s.store.Len(); n > 20 {
+		t.Errorf("store holds %d entries, over its limit of 20", n)
+	}
+	if _, err := s.Get(t.Context(), "challenge-spent:99"); err != nil {
+		t.Errorf("the newest spent challenge was evicted: %v", err)
+	}
+}
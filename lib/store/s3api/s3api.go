@@ -3,14 +3,18 @@ package s3api
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 type Store struct {
@@ -58,10 +62,12 @@ func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
 func (s *Store) Set(ctx context.Context, key string, value []byte, expiry time.Duration) error {
 	normKey := strings.ReplaceAll(key, ":", "/")
 	// S3 has no native TTL; we store object with metadata X-Anubis-Expiry as epoch seconds.
-	var meta map[string]string
+	// The original key is kept as well so that List can report it, as
+	// normKey can't be turned back into it.
+	meta := map[string]string{"x-anubis-key": url.PathEscape(key)}
 	if expiry > 0 {
 		exp := time.Now().Add(expiry).UnixMilli()
-		meta = map[string]string{"x-anubis-expiry-ms": fmt.Sprintf("%d", exp)}
+		meta["x-anubis-expiry-ms"] = fmt.Sprintf("%d", exp)
 	}
 	_, err := s.s3.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:   &s.bucket,
@@ -75,4 +81,59 @@ func (s *Store) Set(ctx context.Context, key string, value []byte, expiry time.D
 	return nil
 }
 
+// List calls fn for every object whose key starts with prefix. S3 can't list
+// object metadata, so every object is looked up to find its expiry and
+// original key. Objects written before the original key was stored are
+// reported under their object name, with slashes where the key had colons.
+func (s *Store) List(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	normPrefix := strings.ReplaceAll(prefix, ":", "/")
+
+	var names []string
+	pages := s3.NewListObjectsV2Paginator(s.s3, &s3.ListObjectsV2Input{
+		Bucket: &s.bucket,
+		Prefix: &normPrefix,
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("can't list s3 objects: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			names = append(names, aws.ToString(obj.Key))
+		}
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		head, err := s.s3.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &s.bucket, Key: &name})
+		if err != nil {
+			var notFound *types.NotFound
+			if errors.As(err, &notFound) {
+				// Deleted since it was listed.
+				continue
+			}
+			return fmt.Errorf("can't look up s3 object %q: %w", name, err)
+		}
+
+		e := store.Entry{Key: name}
+		if key, err := url.PathUnescape(head.Metadata["x-anubis-key"]); err == nil && key != "" {
+			e.Key = key
+		}
+
+		if ms, err := strconv.ParseInt(head.Metadata["x-anubis-expiry-ms"], 10, 64); err == nil {
+			e.Expires = time.UnixMilli(ms)
+			if !now.Before(e.Expires) {
+				continue
+			}
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (Store) IsPersistent() bool { return true }
@@ -4,16 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"maps"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/TecharoHQ/anubis/lib/store"
 	"github.com/TecharoHQ/anubis/lib/store/storetest"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // mockS3 is an in-memory mock of the methods we use.
@@ -69,9 +73,21 @@ func (m *mockS3) HeadObject(ctx context.Context, in *s3.HeadObjectInput, _ ...fu
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	if _, ok := m.data[aws.ToString(in.Key)]; !ok {
-		return nil, fmt.Errorf("not found")
+		return nil, &types.NotFound{}
 	}
-	return &s3.HeadObjectOutput{}, nil
+	return &s3.HeadObjectOutput{Metadata: maps.Clone(m.meta[aws.ToString(in.Key)])}, nil
+}
+
+func (m *mockS3) ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := &s3.ListObjectsV2Output{}
+	for key := range m.data {
+		if strings.HasPrefix(key, aws.ToString(in.Prefix)) {
+			out.Contents = append(out.Contents, types.Object{Key: aws.String(key)})
+		}
+	}
+	return out, nil
 }
 
 func TestImpl(t *testing.T) {
@@ -137,3 +153,35 @@ func TestKeyNormalization(t *testing.T) {
 		t.Fatalf("normalized key still exists after Delete")
 	}
 }
+
+// failingHeadS3 fails every HeadObject call with a transport error.
+type failingHeadS3 struct {
+	mockS3
+}
+
+func (m *failingHeadS3) HeadObject(ctx context.Context, in *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return nil, errors.New("connection reset by peer")
+}
+
+func TestListReportsHeadErrors(t *testing.T) {
+	mock := &failingHeadS3{}
+	f := Factory{Client: mock}
+
+	data, _ := json.Marshal(Config{
+		BucketName: "anubis",
+	})
+
+	s, err := f.Build(t.Context(), json.RawMessage(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Set(t.Context(), "a:b", []byte("value"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.List(t.Context(), s, "a:", func(store.Entry) error { return nil })
+	if err == nil {
+		t.Fatal("List hid a HeadObject failure")
+	}
+}
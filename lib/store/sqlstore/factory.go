@@ -0,0 +1,181 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+
+	// DefaultTable is the table Anubis stores values in when none is set.
+	DefaultTable = "anubis_store"
+
+	// DefaultSweepInterval is how often expired rows are deleted when no
+	// interval is set.
+	DefaultSweepInterval = time.Hour
+)
+
+var (
+	ErrNoDriver         = errors.New("sqlstore.Config: driver is missing from config")
+	ErrUnknownDriver    = errors.New("sqlstore.Config: driver must be sqlite or postgres")
+	ErrNoDSN            = errors.New("sqlstore.Config: dsn is missing from config")
+	ErrBadTable         = errors.New("sqlstore.Config: table must be at most 63 letters, digits and underscores and not start with a digit")
+	ErrBadSweepInterval = errors.New("sqlstore.Config: sweepInterval must be a positive duration")
+)
+
+// The table name is put into queries as is, so it is limited to names that
+// never need quoting. 63 characters is the PostgreSQL identifier limit.
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+func init() {
+	store.Register("sql", Factory{})
+}
+
+// Factory builds new instances of the SQL storage backend according to
+// configuration passed via a json.RawMessage.
+type Factory struct{}
+
+// Build parses and validates the SQL storage backend Config, connects to the
+// database, creates the schema if it does not exist yet and starts sweeping
+// expired rows in the background until ctx is cancelled.
+func (Factory) Build(ctx context.Context, data json.RawMessage) (store.Interface, error) {
+	var config Config
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		return nil, fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	if err := config.Valid(); err != nil {
+		return nil, fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	d := dialects[config.Driver]
+
+	dsn := config.DSN
+	if config.Driver == DriverSQLite {
+		dsn = sqliteDSN(dsn)
+	}
+
+	db, err := sql.Open(d.driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sqlstore: can't open %s database: %w", config.Driver, err)
+	}
+
+	if config.Driver == DriverSQLite {
+		// SQLite only allows one writer at a time. Funnelling everything
+		// through one connection avoids "database is locked" errors within
+		// this process and keeps :memory: databases from being split across
+		// connections. Other processes are waited for with the busy timeout
+		// that sqliteDSN sets.
+		db.SetMaxOpenConns(1)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sqlstore: can't connect to %s database: %w", config.Driver, err)
+	}
+
+	result := newStore(db, d, config.tableName())
+
+	if err := result.createSchema(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	go result.sweepThread(ctx, config.sweepInterval())
+
+	return result, nil
+}
+
+// Valid parses and validates the SQL store Config or returns an error.
+func (Factory) Valid(data json.RawMessage) error {
+	var config Config
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		return fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	if err := config.Valid(); err != nil {
+		return fmt.Errorf("%w: %w", store.ErrBadConfig, err)
+	}
+
+	return nil
+}
+
+// Config is the SQL storage backend configuration.
+type Config struct {
+	// Driver is the kind of database to connect to, sqlite or postgres.
+	Driver string `json:"driver"`
+
+	// DSN is the data source name passed to the database driver. For sqlite
+	// this is a file path, optionally followed by driver parameters such as
+	// ?_busy_timeout=10000. Unless they are set, a busy timeout and
+	// write-ahead logging are turned on so that several processes can share
+	// the file. For postgres this is a connection URL or keyword/value
+	// connection string.
+	DSN string `json:"dsn"`
+
+	// Table is the name of the table values are stored in. It is created on
+	// startup if it does not exist. Defaults to DefaultTable.
+	Table string `json:"table,omitempty"`
+
+	// SweepInterval is how often expired rows are deleted, as a Go duration
+	// string. Defaults to DefaultSweepInterval.
+	SweepInterval string `json:"sweepInterval,omitempty"`
+}
+
+// Valid validates the configuration.
+func (c Config) Valid() error {
+	var errs []error
+
+	switch c.Driver {
+	case "":
+		errs = append(errs, ErrNoDriver)
+	case DriverSQLite, DriverPostgres:
+	default:
+		errs = append(errs, fmt.Errorf("%w, got: %q", ErrUnknownDriver, c.Driver))
+	}
+
+	if c.DSN == "" {
+		errs = append(errs, ErrNoDSN)
+	}
+
+	if c.Table != "" && !tableNameRegexp.MatchString(c.Table) {
+		errs = append(errs, fmt.Errorf("%w, got: %q", ErrBadTable, c.Table))
+	}
+
+	if c.SweepInterval != "" {
+		if d, err := time.ParseDuration(c.SweepInterval); err != nil || d <= 0 {
+			errs = append(errs, fmt.Errorf("%w, got: %q", ErrBadSweepInterval, c.SweepInterval))
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+func (c Config) tableName() string {
+	if c.Table == "" {
+		return DefaultTable
+	}
+	return c.Table
+}
+
+func (c Config) sweepInterval() time.Duration {
+	d, err := time.ParseDuration(c.SweepInterval)
+	if err != nil {
+		return DefaultSweepInterval
+	}
+	return d
+}
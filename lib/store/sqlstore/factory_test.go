@@ -0,0 +1,68 @@
+package sqlstore
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestFactoryValid(t *testing.T) {
+	f := Factory{}
+
+	t.Run("bad config", func(t *testing.T) {
+		if err := f.Valid(json.RawMessage(`}`)); err == nil {
+			t.Error("wanted parsing failure but got a successful result")
+		}
+	})
+
+	for _, tt := range []struct {
+		err  error
+		name string
+		cfg  Config
+	}{
+		{
+			name: "postgres",
+			cfg:  Config{Driver: DriverPostgres, DSN: "postgres://localhost/anubis"},
+		},
+		{
+			name: "custom table and sweep interval",
+			cfg:  Config{Driver: DriverPostgres, DSN: "postgres://localhost/anubis", Table: "anubis_prod", SweepInterval: "5m"},
+		},
+		{
+			name: "missing driver",
+			cfg:  Config{DSN: "postgres://localhost/anubis"},
+			err:  ErrNoDriver,
+		},
+		{
+			name: "unknown driver",
+			cfg:  Config{Driver: "mysql", DSN: "anubis@/anubis"},
+			err:  ErrUnknownDriver,
+		},
+		{
+			name: "missing dsn",
+			cfg:  Config{Driver: DriverPostgres},
+			err:  ErrNoDSN,
+		},
+		{
+			name: "table needs quoting",
+			cfg:  Config{Driver: DriverPostgres, DSN: "postgres://localhost/anubis", Table: "anubis; DROP TABLE users"},
+			err:  ErrBadTable,
+		},
+		{
+			name: "bad sweep interval",
+			cfg:  Config{Driver: DriverPostgres, DSN: "postgres://localhost/anubis", SweepInterval: "-1m"},
+			err:  ErrBadSweepInterval,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := f.Valid(json.RawMessage(data)); !errors.Is(err, tt.err) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+		})
+	}
+}
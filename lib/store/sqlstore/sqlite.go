@@ -0,0 +1,68 @@
+package sqlstore
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	// The SQLite driver is written in pure Go, so SQLite works in every build
+	// of Anubis, including the ones cross-compiled without cgo.
+	_ "modernc.org/sqlite"
+)
+
+const sqliteDriverName = "sqlite"
+
+// sqliteBusyTimeout is how long a write waits for other processes writing to
+// the same SQLite database before it fails with SQLITE_BUSY.
+const sqliteBusyTimeout = 5 * time.Second
+
+// sqliteDSN returns dsn with the settings that let several processes share a
+// SQLite database, unless dsn sets them itself: a busy timeout so that
+// overlapping writes wait for each other instead of failing, and write-ahead
+// logging so that reads don't wait for writes.
+func sqliteDSN(dsn string) string {
+	_, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		// Let the driver report the malformed DSN.
+		return dsn
+	}
+
+	var add []string
+	if !sqliteDSNSets(params, "busy_timeout", "_busy_timeout", "_timeout") {
+		add = append(add, "_busy_timeout="+strconv.FormatInt(sqliteBusyTimeout.Milliseconds(), 10))
+	}
+	if !sqliteDSNSets(params, "journal_mode", "_journal_mode", "_journal") {
+		add = append(add, "_journal_mode=WAL")
+	}
+
+	if len(add) == 0 {
+		return dsn
+	}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+
+	return dsn + sep + strings.Join(add, "&")
+}
+
+// sqliteDSNSets reports whether params set pragma, either with one of the
+// driver's shorthand keys or with a _pragma parameter.
+func sqliteDSNSets(params url.Values, pragma string, keys ...string) bool {
+	for _, k := range keys {
+		if params.Has(k) {
+			return true
+		}
+	}
+
+	for _, v := range params["_pragma"] {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(v)), pragma) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,290 @@
+// Package sqlstore implements store.Interface on top of database/sql, with
+// support for SQLite and PostgreSQL.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+)
+
+// dialect holds what differs between the supported databases.
+type dialect struct {
+	driverName string
+	blobType   string
+
+	// placeholder returns the bind parameter for the n-th argument of a
+	// query, counting from 1.
+	placeholder func(n int) string
+
+	// addToCounter returns an expression that adds the integer expression
+	// delta to the counter stored in the value column of table, as written
+	// by store.FormatCounter.
+	addToCounter func(table, delta string) string
+}
+
+var dialects = map[string]dialect{
+	DriverSQLite: {
+		driverName:  sqliteDriverName,
+		blobType:    "BLOB",
+		placeholder: func(int) string { return "?" },
+		addToCounter: func(table, delta string) string {
+			return fmt.Sprintf("CAST(CAST(CAST(%s.value AS TEXT) AS INTEGER) + %s AS BLOB)", table, delta)
+		},
+	},
+	DriverPostgres: {
+		driverName:  "pgx",
+		blobType:    "BYTEA",
+		placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+		addToCounter: func(table, delta string) string {
+			return fmt.Sprintf("convert_to((convert_from(%s.value, 'UTF8')::BIGINT + %s::BIGINT)::TEXT, 'UTF8')", table, delta)
+		},
+	},
+}
+
+// Store implements store.Interface backed by a SQL database.
+//
+// Every value is a row in a single table keyed by its name. The expiry is
+// kept next to the value as Unix nanoseconds in the expires_at column, which
+// is indexed. Reads ignore expired rows and a background sweeper deletes them
+// periodically so the table does not grow without bounds.
+//
+// Unlike bbolt, any number of Anubis instances can share a PostgreSQL
+// database, and any number of Anubis processes on one host can share a SQLite
+// file. Increment and CompareAndSwap are single statements, so they are
+// atomic across all of them.
+type Store struct {
+	db    *sql.DB
+	d     dialect
+	table string
+
+	getQuery       string
+	setQuery       string
+	setNXQuery     string
+	swapQuery      string
+	incrementQuery string
+	deleteQuery    string
+	listQuery      string
+	sweepQuery     string
+}
+
+var (
+	_ store.Interface         = (*Store)(nil)
+	_ store.Incrementer       = (*Store)(nil)
+	_ store.CompareAndSwapper = (*Store)(nil)
+	_ store.Lister            = (*Store)(nil)
+)
+
+func newStore(db *sql.DB, d dialect, table string) *Store {
+	p := d.placeholder
+
+	return &Store{
+		db:    db,
+		d:     d,
+		table: table,
+
+		getQuery: fmt.Sprintf("SELECT value FROM %s WHERE key = %s AND expires_at > %s", table, p(1), p(2)),
+		setQuery: fmt.Sprintf(
+			"INSERT INTO %s (key, value, expires_at) VALUES (%s, %s, %s) ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at",
+			table, p(1), p(2), p(3),
+		),
+		// Expired rows may not have been swept yet, so they are replaced as
+		// if they didn't exist.
+		setNXQuery: fmt.Sprintf(
+			"INSERT INTO %s (key, value, expires_at) VALUES (%s, %s, %s) ON CONFLICT (key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at WHERE %s.expires_at <= %s",
+			table, p(1), p(2), p(3), table, p(4),
+		),
+		swapQuery: fmt.Sprintf(
+			"UPDATE %s SET value = %s, expires_at = %s WHERE key = %s AND value = %s AND expires_at > %s",
+			table, p(1), p(2), p(3), p(4), p(5),
+		),
+		incrementQuery: fmt.Sprintf(
+			"INSERT INTO %s (key, value, expires_at) VALUES (%s, %s, %s) ON CONFLICT (key) DO UPDATE SET value = CASE WHEN %s.expires_at <= %s THEN excluded.value ELSE %s END, expires_at = excluded.expires_at RETURNING value",
+			table, p(1), p(2), p(3), table, p(4), d.addToCounter(table, p(5)),
+		),
+		deleteQuery: fmt.Sprintf("DELETE FROM %s WHERE key = %s", table, p(1)),
+		listQuery:   fmt.Sprintf("SELECT key, expires_at FROM %s WHERE substr(key, 1, %s) = %s AND expires_at > %s", table, p(1), p(2), p(3)),
+		sweepQuery:  fmt.Sprintf("DELETE FROM %s WHERE expires_at <= %s", table, p(1)),
+	}
+}
+
+// createSchema creates the table and its expiry index if they don't exist.
+func (s *Store) createSchema(ctx context.Context) error {
+	for _, stmt := range []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (key TEXT PRIMARY KEY, value %s NOT NULL, expires_at BIGINT NOT NULL)", s.table, s.d.blobType),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expires_at ON %s (expires_at)", s.table, s.table),
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("sqlstore: can't create schema for table %s: %w", s.table, err)
+		}
+	}
+
+	return nil
+}
+
+// Delete a key from the datastore. If the key does not exist, return an error.
+func (s *Store) Delete(ctx context.Context, key string) error {
+	res, err := s.db.ExecContext(ctx, s.deleteQuery, key)
+	if err != nil {
+		return fmt.Errorf("sqlstore: can't delete %q: %w", key, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("sqlstore: can't delete %q: %w", key, err)
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%w: %q", store.ErrNotFound, key)
+	}
+
+	return nil
+}
+
+// Get a value from the datastore. Expired values are treated as missing.
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	var result []byte
+
+	err := s.db.QueryRowContext(ctx, s.getQuery, key, time.Now().UnixNano()).Scan(&result)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("%w: %q", store.ErrNotFound, key)
+	case err != nil:
+		return nil, fmt.Errorf("sqlstore: can't get %q: %w", key, err)
+	}
+
+	return result, nil
+}
+
+// Set a value into the store with a given expiry.
+func (s *Store) Set(ctx context.Context, key string, value []byte, expiry time.Duration) error {
+	if value == nil {
+		// The value column is NOT NULL.
+		value = []byte{}
+	}
+
+	if _, err := s.db.ExecContext(ctx, s.setQuery, key, value, time.Now().Add(expiry).UnixNano()); err != nil {
+		return fmt.Errorf("sqlstore: can't set %q: %w", key, err)
+	}
+
+	return nil
+}
+
+// Increment adds delta to the counter at key in a single upsert, so that
+// concurrent increments from any number of Anubis instances are all counted.
+func (s *Store) Increment(ctx context.Context, key string, delta int64, expiry time.Duration) (int64, error) {
+	now := time.Now()
+
+	var result []byte
+	err := s.db.QueryRowContext(ctx, s.incrementQuery, key, store.FormatCounter(delta), now.Add(expiry).UnixNano(), now.UnixNano(), delta).Scan(&result)
+	if err != nil {
+		return 0, fmt.Errorf("sqlstore: can't increment %q: %w", key, err)
+	}
+
+	return store.ParseCounter(result)
+}
+
+// CompareAndSwap sets key to value only if its current value is old, or if
+// old is nil and key doesn't exist or has expired.
+func (s *Store) CompareAndSwap(ctx context.Context, key string, old, value []byte, expiry time.Duration) (bool, error) {
+	if value == nil {
+		// The value column is NOT NULL.
+		value = []byte{}
+	}
+
+	now := time.Now()
+
+	var (
+		res sql.Result
+		err error
+	)
+	if old == nil {
+		res, err = s.db.ExecContext(ctx, s.setNXQuery, key, value, now.Add(expiry).UnixNano(), now.UnixNano())
+	} else {
+		res, err = s.db.ExecContext(ctx, s.swapQuery, value, now.Add(expiry).UnixNano(), key, old, now.UnixNano())
+	}
+	if err != nil {
+		return false, fmt.Errorf("sqlstore: can't swap %q: %w", key, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("sqlstore: can't swap %q: %w", key, err)
+	}
+
+	return n == 1, nil
+}
+
+// List calls fn for every key starting with prefix that has not expired.
+func (s *Store) List(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	// fn may use the store, and SQLite only has one connection, so read all
+	// the keys before calling it.
+	rows, err := s.db.QueryContext(ctx, s.listQuery, utf8.RuneCountInString(prefix), prefix, time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("sqlstore: can't list %q: %w", prefix, err)
+	}
+
+	var entries []store.Entry
+	for rows.Next() {
+		var (
+			key       string
+			expiresAt int64
+		)
+		if err := rows.Scan(&key, &expiresAt); err != nil {
+			rows.Close() //nolint:errcheck
+			return fmt.Errorf("sqlstore: can't list %q: %w", prefix, err)
+		}
+
+		entries = append(entries, store.Entry{Key: key, Expires: time.Unix(0, expiresAt)})
+	}
+	if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+		return fmt.Errorf("sqlstore: can't list %q: %w", prefix, err)
+	}
+
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) IsPersistent() bool {
+	return true
+}
+
+// sweep deletes every expired row and returns how many there were.
+func (s *Store) sweep(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.sweepQuery, time.Now().UnixNano())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *Store) sweepThread(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n, err := s.sweep(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "error during sql store cleanup", "table", s.table, "err", err)
+				continue
+			}
+			slog.DebugContext(ctx, "swept expired rows from sql store", "table", s.table, "count", n)
+		}
+	}
+}
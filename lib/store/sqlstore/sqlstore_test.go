@@ -0,0 +1,269 @@
+package sqlstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/store"
+	"github.com/TecharoHQ/anubis/lib/store/storetest"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func newSQLiteStore(t *testing.T) *Store {
+	t.Helper()
+
+	return openSQLiteStore(t, filepath.Join(t.TempDir(), "anubis.db"))
+}
+
+// openSQLiteStore opens the SQLite database at dsn with a connection of its
+// own, like another Anubis process would.
+func openSQLiteStore(t *testing.T, dsn string) *Store {
+	t.Helper()
+
+	data, err := json.Marshal(Config{
+		Driver: DriverSQLite,
+		DSN:    dsn,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Factory{}.Build(t.Context(), json.RawMessage(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.(*Store).db.Close() }) //nolint:errcheck
+
+	return s.(*Store)
+}
+
+func TestImplSQLite(t *testing.T) {
+	data, err := json.Marshal(Config{
+		Driver: DriverSQLite,
+		DSN:    filepath.Join(t.TempDir(), "anubis.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storetest.Common(t, Factory{}, json.RawMessage(data))
+}
+
+func TestImplPostgres(t *testing.T) {
+	if os.Getenv("DONT_USE_NETWORK") != "" {
+		t.Skip("test requires network egress")
+		return
+	}
+
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	pgC, err := testcontainers.Run(
+		t.Context(), "postgres:17",
+		testcontainers.WithExposedPorts("5432/tcp"),
+		testcontainers.WithEnv(map[string]string{
+			"POSTGRES_USER":     "anubis",
+			"POSTGRES_PASSWORD": "anubis",
+			"POSTGRES_DB":       "anubis",
+		}),
+		testcontainers.WithWaitStrategy(
+			wait.ForListeningPort("5432/tcp"),
+			wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+		),
+	)
+	testcontainers.CleanupContainer(t, pgC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint, err := pgC.PortEndpoint(t.Context(), "5432/tcp", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(Config{
+		Driver: DriverPostgres,
+		DSN:    fmt.Sprintf("postgres://anubis:anubis@%s/anubis?sslmode=disable", endpoint),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storetest.Common(t, Factory{}, json.RawMessage(data))
+}
+
+func TestSweep(t *testing.T) {
+	s := newSQLiteStore(t)
+
+	if err := s.Set(t.Context(), "expired", []byte("old"), -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(t.Context(), "live", []byte("new"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.sweep(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("swept %d rows, want 1", n)
+	}
+
+	// The expired row is gone for good, not just hidden by Get.
+	if err := s.Delete(t.Context(), "expired"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expired row still exists after sweep: %v", err)
+	}
+
+	if _, err := s.Get(t.Context(), "live"); err != nil {
+		t.Errorf("live row was swept: %v", err)
+	}
+}
+
+func TestSetOverwrites(t *testing.T) {
+	s := newSQLiteStore(t)
+
+	if err := s.Set(t.Context(), "key", []byte("old"), -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(t.Context(), "key", []byte("new"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get(t.Context(), "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "new" {
+		t.Errorf("got %q, want %q", got, "new")
+	}
+}
+
+func TestSchemaIsIdempotent(t *testing.T) {
+	s := newSQLiteStore(t)
+
+	if err := s.createSchema(t.Context()); err != nil {
+		t.Errorf("creating the schema a second time failed: %v", err)
+	}
+}
+
+func TestSetDatabaseErrorIsNotEncodeError(t *testing.T) {
+	s := newSQLiteStore(t)
+
+	if err := s.db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.Set(t.Context(), "key", []byte("value"), time.Hour)
+	if err == nil {
+		t.Fatal("Set on a closed database succeeded")
+	}
+	if errors.Is(err, store.ErrCantEncode) {
+		t.Errorf("database errors must not be reported as %v: %v", store.ErrCantEncode, err)
+	}
+}
+
+func TestSQLiteSharedBetweenProcesses(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "anubis.db")
+	stores := []*Store{openSQLiteStore(t, dsn), openSQLiteStore(t, dsn)}
+
+	const perStore = 50
+
+	var wg sync.WaitGroup
+	for _, s := range stores {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			for range perStore {
+				if _, err := s.Increment(t.Context(), "counter", 1, time.Hour); err != nil {
+					t.Errorf("Increment: %v", err)
+					return
+				}
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			for range perStore {
+				for {
+					old, err := s.Get(t.Context(), "swapped")
+					if errors.Is(err, store.ErrNotFound) {
+						old = nil
+					} else if err != nil {
+						t.Errorf("Get: %v", err)
+						return
+					}
+
+					n := int64(0)
+					if old != nil {
+						if n, err = store.ParseCounter(old); err != nil {
+							t.Errorf("ParseCounter: %v", err)
+							return
+						}
+					}
+
+					ok, err := s.CompareAndSwap(t.Context(), "swapped", old, store.FormatCounter(n+1), time.Hour)
+					if err != nil {
+						t.Errorf("CompareAndSwap: %v", err)
+						return
+					}
+					if ok {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, key := range []string{"counter", "swapped"} {
+		val, err := stores[0].Get(t.Context(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := store.ParseCounter(val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 2*perStore {
+			t.Errorf("%s = %d, want %d", key, n, 2*perStore)
+		}
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	for _, tt := range []struct {
+		dsn, want string
+	}{
+		{
+			dsn:  "/data/anubis.db",
+			want: "/data/anubis.db?_busy_timeout=5000&_journal_mode=WAL",
+		},
+		{
+			dsn:  "file:/data/anubis.db?mode=rwc",
+			want: "file:/data/anubis.db?mode=rwc&_busy_timeout=5000&_journal_mode=WAL",
+		},
+		{
+			dsn:  "/data/anubis.db?_timeout=100&_journal=DELETE",
+			want: "/data/anubis.db?_timeout=100&_journal=DELETE",
+		},
+		{
+			dsn:  "/data/anubis.db?_pragma=busy_timeout(100)",
+			want: "/data/anubis.db?_pragma=busy_timeout(100)&_journal_mode=WAL",
+		},
+	} {
+		if got := sqliteDSN(tt.dsn); got != tt.want {
+			t.Errorf("sqliteDSN(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
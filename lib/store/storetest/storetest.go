@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -78,6 +80,196 @@ func Common(t *testing.T, f store.Factory, config json.RawMessage) {
 					t.Errorf("wanted %s to not exist in store but it exists anyways", t.Name())
 				}
 
+				return nil
+			},
+		},
+		{
+			name: "increment",
+			doer: func(t *testing.T, s store.Interface) error {
+				const workers = 16
+
+				var wg sync.WaitGroup
+				errs := make(chan error, workers)
+				for range workers {
+					wg.Go(func() {
+						if _, err := store.Increment(t.Context(), s, t.Name(), 2, 5*time.Minute); err != nil {
+							errs <- err
+						}
+					})
+				}
+				wg.Wait()
+				close(errs)
+
+				// errs is closed, so this is nil if nothing failed.
+				if err := <-errs; err != nil {
+					return err
+				}
+
+				got, err := store.Increment(t.Context(), s, t.Name(), -1, 5*time.Minute)
+				if err != nil {
+					return err
+				}
+
+				if want := int64(workers*2 - 1); got != want {
+					t.Errorf("wanted counter to be %d, got: %d", want, got)
+				}
+
+				// Counters must stay readable as JSON integers.
+				val, err := (&store.JSON[int]{Underlying: s}).Get(t.Context(), t.Name())
+				if err != nil {
+					return err
+				}
+
+				if int64(val) != got {
+					t.Errorf("counter read back as %d, wanted %d", val, got)
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "increment expired counter",
+			doer: func(t *testing.T, s store.Interface) error {
+				if _, err := store.Increment(t.Context(), s, t.Name(), 5, 150*time.Millisecond); err != nil {
+					return err
+				}
+
+				//nosleep:bypass XXX(Xe): use Go's time faking thing in Go 1.25 when that is released.
+				time.Sleep(155 * time.Millisecond)
+
+				got, err := store.Increment(t.Context(), s, t.Name(), 1, 5*time.Minute)
+				if err != nil {
+					return err
+				}
+
+				if got != 1 {
+					t.Errorf("wanted expired counter to start over at 1, got: %d", got)
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "set if not exists",
+			doer: func(t *testing.T, s store.Interface) error {
+				const workers = 16
+
+				var wg sync.WaitGroup
+				var won atomic.Int32
+				errs := make(chan error, workers)
+				for range workers {
+					wg.Go(func() {
+						ok, err := store.SetNX(t.Context(), s, t.Name(), []byte("claimed"), 5*time.Minute)
+						if err != nil {
+							errs <- err
+						}
+						if ok {
+							won.Add(1)
+						}
+					})
+				}
+				wg.Wait()
+				close(errs)
+
+				// errs is closed, so this is nil if nothing failed.
+				if err := <-errs; err != nil {
+					return err
+				}
+
+				if n := won.Load(); n != 1 {
+					t.Errorf("wanted exactly one SetNX to succeed, %d did", n)
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "compare and swap",
+			doer: func(t *testing.T, s store.Interface) error {
+				if err := s.Set(t.Context(), t.Name(), []byte("old"), 5*time.Minute); err != nil {
+					return err
+				}
+
+				ok, err := store.CompareAndSwap(t.Context(), s, t.Name(), []byte("wrong"), []byte("new"), 5*time.Minute)
+				if err != nil {
+					return err
+				}
+				if ok {
+					t.Error("swap succeeded even though the current value did not match")
+				}
+
+				ok, err = store.CompareAndSwap(t.Context(), s, t.Name(), []byte("old"), []byte("new"), 5*time.Minute)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					t.Error("swap failed even though the current value matched")
+				}
+
+				val, err := s.Get(t.Context(), t.Name())
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(val, []byte("new")) {
+					t.Errorf("wanted %q after swap, got: %q", "new", val)
+				}
+
+				if ok, _ := store.SetNX(t.Context(), s, t.Name(), []byte("other"), 5*time.Minute); ok {
+					t.Error("SetNX overwrote an existing value")
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "list",
+			doer: func(t *testing.T, s store.Interface) error {
+				prefix := t.Name() + ":"
+				for key, expiry := range map[string]time.Duration{
+					prefix + "a":        5 * time.Minute,
+					prefix + "b":        5 * time.Minute,
+					prefix + "expired":  time.Millisecond,
+					t.Name() + "-other": 5 * time.Minute,
+				} {
+					if err := s.Set(t.Context(), key, []byte(key), expiry); err != nil {
+						return err
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+
+				got := map[string]time.Time{}
+				err := store.List(t.Context(), s, prefix, func(e store.Entry) error {
+					got[e.Key] = e.Expires
+					return nil
+				})
+				if errors.Is(err, store.ErrCantList) {
+					t.Skip("backend can't list keys")
+				}
+				if err != nil {
+					return err
+				}
+
+				if len(got) != 2 {
+					t.Errorf("wanted only %[1]sa and %[1]sb to be listed, got: %v", prefix, got)
+				}
+
+				for _, key := range []string{prefix + "a", prefix + "b"} {
+					expires, ok := got[key]
+					if !ok {
+						t.Errorf("%s was not listed", key)
+						continue
+					}
+
+					if d := time.Until(expires); d < 4*time.Minute || d > 6*time.Minute {
+						t.Errorf("wanted %s to expire in about five minutes, got: %v", key, d)
+					}
+				}
+
+				errStop := errors.New("stop")
+				if err := store.List(t.Context(), s, prefix, func(store.Entry) error { return errStop }); !errors.Is(err, errStop) {
+					t.Errorf("wanted the error returned by fn, got: %v", err)
+				}
+
 				return nil
 			},
 		},
@@ -105,6 +105,10 @@ type redisClient interface {
 	Get(ctx context.Context, key string) *valkey.StringCmd
 	Set(ctx context.Context, key string, value any, expiration time.Duration) *valkey.StatusCmd
 	Del(ctx context.Context, keys ...string) *valkey.IntCmd
+	SetNX(ctx context.Context, key string, value any, expiration time.Duration) *valkey.BoolCmd
+	Eval(ctx context.Context, script string, keys []string, args ...any) *valkey.Cmd
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *valkey.ScanCmd
+	PTTL(ctx context.Context, key string) *valkey.DurationCmd
 	Ping(ctx context.Context) *valkey.StatusCmd
 }
 
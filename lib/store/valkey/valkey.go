@@ -2,6 +2,8 @@ package valkey
 
 import (
 	"context"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/TecharoHQ/anubis/lib/store"
@@ -13,7 +15,28 @@ type Store struct {
 	client redisClient
 }
 
-var _ store.Interface = (*Store)(nil)
+var (
+	_ store.Interface         = (*Store)(nil)
+	_ store.Incrementer       = (*Store)(nil)
+	_ store.CompareAndSwapper = (*Store)(nil)
+	_ store.Lister            = (*Store)(nil)
+)
+
+// incrementScript adds to a counter and refreshes its expiry in one step.
+const incrementScript = `
+local n = redis.call("INCRBY", KEYS[1], ARGV[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+return n
+`
+
+// compareAndSwapScript sets a key only if it holds the expected value.
+const compareAndSwapScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+	return 1
+end
+return 0
+`
 
 func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
 	cmd := s.client.Get(ctx, key)
@@ -41,6 +64,105 @@ func (s *Store) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+func (s *Store) Increment(ctx context.Context, key string, delta int64, expiry time.Duration) (int64, error) {
+	return s.client.Eval(ctx, incrementScript, []string{key}, delta, expiryMillis(expiry)).Int64()
+}
+
+func (s *Store) CompareAndSwap(ctx context.Context, key string, old, value []byte, expiry time.Duration) (bool, error) {
+	if old == nil {
+		return s.client.SetNX(ctx, key, value, expiry).Result()
+	}
+
+	n, err := s.client.Eval(ctx, compareAndSwapScript, []string{key}, old, value, expiryMillis(expiry)).Int64()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// List calls fn for every key starting with prefix. It uses SCAN, so it
+// doesn't block the server, and visits every master of a cluster.
+func (s *Store) List(ctx context.Context, prefix string, fn func(store.Entry) error) error {
+	match := globEscaper.Replace(prefix) + "*"
+
+	var keys []string
+	if cc, ok := s.client.(*valkey.ClusterClient); ok {
+		var mu sync.Mutex
+		if err := cc.ForEachMaster(ctx, func(ctx context.Context, c *valkey.Client) error {
+			found, err := scan(ctx, c, match)
+			mu.Lock()
+			keys = append(keys, found...)
+			mu.Unlock()
+			return err
+		}); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if keys, err = scan(ctx, s.client, match); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range keys {
+		ttl, err := s.client.PTTL(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+
+		var e store.Entry
+		switch {
+		case ttl == -2:
+			// The key expired or was deleted since it was scanned.
+			continue
+		case ttl == -1:
+			e = store.Entry{Key: key}
+		default:
+			e = store.Entry{Key: key, Expires: time.Now().Add(ttl)}
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// globEscaper escapes the characters that are special in SCAN MATCH
+// patterns.
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// scan returns every key on one server that matches match.
+func scan(ctx context.Context, c interface {
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *valkey.ScanCmd
+}, match string) ([]string, error) {
+	var (
+		result []string
+		cursor uint64
+	)
+
+	for {
+		keys, next, err := c.Scan(ctx, cursor, match, 1000).Result()
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, keys...)
+		if next == 0 {
+			return result, nil
+		}
+		cursor = next
+	}
+}
+
+// expiryMillis converts expiry to the millisecond count PEXPIRE and SET PX
+// take. Both reject anything below one millisecond.
+func expiryMillis(expiry time.Duration) int64 {
+	return max(expiry.Milliseconds(), 1)
+}
+
 // IsPersistent tells Anubis this backend is “real” storage, not in-memory.
 func (s *Store) IsPersistent() bool {
 	return true
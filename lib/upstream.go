@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TecharoHQ/anubis/lib/config"
+	"github.com/TecharoHQ/anubis/lib/policy"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// upstreamDecisionHeader holds the signed copy of the decision headers.
+const upstreamDecisionHeader = "X-Anubis-Decision"
+
+// upstreamDecisionType is the typ header of signed decisions. Decisions are
+// signed with the same keys, issuer and audience as auth cookies, so this is
+// what keeps one from being taken for the other.
+const upstreamDecisionType = "anubis-decision+jwt"
+
+// upstreamDecisionLifetime is how long a signed decision is valid for. It
+// only has to outlive the request it was made for.
+const upstreamDecisionLifetime = 30 * time.Second
+
+var upstreamHeaderNames = map[config.UpstreamHeaderField]string{
+	config.UpstreamChallengeID: "X-Anubis-Challenge-Id",
+	config.UpstreamMethod:      "X-Anubis-Challenge-Method",
+	config.UpstreamDifficulty:  "X-Anubis-Difficulty",
+	config.UpstreamIssuedAt:    "X-Anubis-Issued-At",
+	config.UpstreamWeight:      "X-Anubis-Weight",
+	config.UpstreamASN:         "X-Anubis-Asn",
+	config.UpstreamCountry:     "X-Anubis-Country",
+}
+
+// stripUpstreamHeaders removes every header Anubis uses to tell the upstream
+// about its decision, so that clients can't send their own.
+func stripUpstreamHeaders(r *http.Request) {
+	r.Header.Del("X-Anubis-Rule")
+	r.Header.Del("X-Anubis-Action")
+	r.Header.Del("X-Anubis-Status")
+	r.Header.Del(upstreamDecisionHeader)
+
+	for _, name := range upstreamHeaderNames {
+		r.Header.Del(name)
+	}
+}
+
+// decisionValues returns the configured facts about the decision for r. The
+// claims of the client's token are nil when the request was let through
+// without one.
+func (s *Server) decisionValues(r *http.Request, cr policy.CheckResult, claims jwt.MapClaims) map[config.UpstreamHeaderField]any {
+	result := map[config.UpstreamHeaderField]any{}
+
+	for _, f := range s.policy.UpstreamHeaders.Include {
+		switch f {
+		case config.UpstreamChallengeID:
+			if v, ok := claims["challenge"].(string); ok {
+				result[f] = v
+			}
+		case config.UpstreamMethod:
+			if v, ok := claims["method"].(string); ok {
+				result[f] = v
+			}
+		case config.UpstreamDifficulty:
+			if v, ok := claims["difficulty"].(float64); ok {
+				result[f] = int(v)
+			}
+		case config.UpstreamIssuedAt:
+			if t, ok := sessionStart(claims); ok {
+				result[f] = t.Unix()
+			}
+		case config.UpstreamWeight:
+			result[f] = cr.Weight
+		case config.UpstreamASN:
+			if asn, _ := asnFromContext(r.Context()); asn != "" {
+				result[f] = asn
+			}
+		case config.UpstreamCountry:
+			if country := countryFromContext(r.Context()); country != "" {
+				result[f] = country
+			}
+		}
+	}
+
+	return result
+}
+
+// forwardDecision adds the configured decision headers to r before it is
+// passed upstream. Without an upstream, as in subrequest authentication, the
+// headers are set on the response so that the proxy can copy them.
+func (s *Server) forwardDecision(w http.ResponseWriter, r *http.Request, cr policy.CheckResult, claims jwt.MapClaims) {
+	if s.policy.UpstreamHeaders == nil {
+		return
+	}
+
+	set := r.Header.Set
+	if s.next == nil {
+		set = w.Header().Set
+	}
+
+	values := s.decisionValues(r, cr, claims)
+	for f, v := range values {
+		switch v := v.(type) {
+		case string:
+			set(upstreamHeaderNames[f], v)
+		case int:
+			set(upstreamHeaderNames[f], strconv.Itoa(v))
+		case int64:
+			set(upstreamHeaderNames[f], time.Unix(v, 0).UTC().Format(time.RFC3339))
+		}
+	}
+
+	if !s.policy.UpstreamHeaders.Sign {
+		return
+	}
+
+	now := time.Now()
+	decision := jwt.MapClaims{
+		"iss":    s.opts.JWTIssuer,
+		"aud":    s.jwtAudience(r),
+		"iat":    now.Unix(),
+		"exp":    now.Add(upstreamDecisionLifetime).Unix(),
+		"rule":   cr.Name,
+		"action": string(cr.Rule),
+	}
+	for f, v := range values {
+		decision[string(f)] = v
+	}
+
+	token, err := s.keyring.SignType(decision, upstreamDecisionType)
+	if err != nil {
+		lg, _ := s.getRequestLogger(r)
+		lg.ErrorContext(r.Context(), "can't sign upstream decision", "err", err)
+		return
+	}
+
+	set(upstreamDecisionHeader, token)
+}
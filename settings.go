@@ -0,0 +1,59 @@
+package anubis
+
+import "context"
+
+// Settings are the per-instance settings of an Anubis server that templates and
+// helpers outside of package lib need to know about. They used to be package
+// globals, which made it impossible to run more than one differently configured
+// server in the same process. lib.Server attaches its Settings to the context of
+// every request it handles.
+type Settings struct {
+	// BasePrefix is a prefix for all Anubis endpoints, without a trailing slash.
+	// It is empty when Anubis is served from the root.
+	BasePrefix string
+
+	// PublicUrl is the externally accessible URL for this Anubis instance.
+	PublicUrl string
+
+	// CookieName is the name of the cookie that Anubis uses in order to validate
+	// access.
+	CookieName string
+
+	// TestCookieName is the name of the cookie that Anubis uses in order to
+	// check if cookies are enabled on the client's browser.
+	TestCookieName string
+
+	// ForcedLanguage is the language being used instead of the one of the
+	// request's Accept-Language header if set.
+	ForcedLanguage string
+
+	// UseSimplifiedExplanation replaces the "Why am I seeing this?" text with a
+	// more simplified text for a non-tech-savvy audience.
+	UseSimplifiedExplanation bool
+}
+
+// DefaultSettings returns the settings that are used when a context carries no
+// Settings of its own.
+func DefaultSettings() *Settings {
+	return &Settings{
+		CookieName:     CookieName,
+		TestCookieName: TestCookieName,
+	}
+}
+
+type settingsCtxKey struct{}
+
+// WithSettings returns a copy of ctx that carries s.
+func WithSettings(ctx context.Context, s *Settings) context.Context {
+	return context.WithValue(ctx, settingsCtxKey{}, s)
+}
+
+// SettingsFromContext returns the Settings attached to ctx with WithSettings,
+// falling back to DefaultSettings if there are none.
+func SettingsFromContext(ctx context.Context) *Settings {
+	if s, ok := ctx.Value(settingsCtxKey{}).(*Settings); ok && s != nil {
+		return s
+	}
+
+	return DefaultSettings()
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/a-h/templ"
 
+	"github.com/TecharoHQ/anubis"
 	"github.com/TecharoHQ/anubis/lib/challenge"
 	"github.com/TecharoHQ/anubis/lib/config"
 	"github.com/TecharoHQ/anubis/lib/localization"
@@ -42,3 +43,13 @@ func honeypotLink(href string) templ.Component {
 		return nil
 	})
 }
+
+// basePrefix returns the base prefix of the Anubis server rendering a page.
+func basePrefix(ctx context.Context) string {
+	return anubis.SettingsFromContext(ctx).BasePrefix
+}
+
+// publicURL returns the public URL of the Anubis server rendering a page.
+func publicURL(ctx context.Context) string {
+	return anubis.SettingsFromContext(ctx).PublicUrl
+}
@@ -37,11 +37,7 @@ func TestBasePrefixInLinks(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Save original BasePrefix and restore after test
-			origPrefix := anubis.BasePrefix
-			defer func() { anubis.BasePrefix = origPrefix }()
-
-			anubis.BasePrefix = tt.basePrefix
+			ctx := anubis.WithSettings(context.Background(), &anubis.Settings{BasePrefix: tt.basePrefix})
 
 			// Create test impressum
 			impressum := &config.Impressum{
@@ -60,7 +56,7 @@ func TestBasePrefixInLinks(t *testing.T) {
 			// Render the base template to a buffer
 			var buf strings.Builder
 			component := base(tt.name, templ.NopComponent, impressum, &config.Honeypot{Enabled: true, Implementation: "naive"}, nil, nil, localizer)
-			err := component.Render(context.Background(), &buf)
+			err := component.Render(ctx, &buf)
 			if err != nil {
 				t.Fatalf("failed to render template: %v", err)
 			}
@@ -3,6 +3,7 @@ import {
   ProgressCallback,
   ProcessOptions,
   ProcessResult,
+  WorkerArgs,
   WorkerSpawner,
   createWorkerSpawner,
 } from "@lib/worker";
@@ -50,13 +51,17 @@ export default async function process(
   }
 }
 
-function runWorkers(
+// runWorkers spreads the nonce space over threads workers and resolves with
+// the first solution any of them finds. extraArgs is passed through to every
+// worker for algorithms that need more than the difficulty.
+export function runWorkers(
   spawner: WorkerSpawner,
   data: string,
   difficulty: number,
   signal: AbortSignal | null,
   progressCallback: ProgressCallback | undefined,
   threads: number,
+  extraArgs: Partial<WorkerArgs> = {},
 ): Promise<ProcessResult> {
   return new Promise((resolve, reject) => {
     let workers: Worker[] = [];
@@ -190,6 +195,7 @@ function runWorkers(
         };
 
         worker.postMessage({
+          ...extraArgs,
           data,
           difficulty,
           nonce: i,
@@ -1,6 +1,8 @@
 import fast from "./fast";
+import scrypt from "./scrypt";
 
 export default {
   fast: fast,
   slow: fast, // XXX(Xe): slow is deprecated, but keep this around in case anything goes bad
+  scrypt: scrypt,
 } as Record<string, any>;
@@ -0,0 +1,46 @@
+import {
+  getHardwareConcurrency,
+  ProgressCallback,
+  ProcessOptions,
+  ProcessResult,
+  createWorkerSpawner,
+} from "@lib/worker";
+import { runWorkers } from "./fast";
+
+// These match config.DefaultScryptMemory and config.DefaultScryptIterations.
+// The server always sends the values it validates against, so these are only
+// a safety net.
+const defaultMemory = 4096;
+const defaultIterations = 1;
+
+export default async function process(
+  options: ProcessOptions,
+  data: string,
+  difficulty: number = 1,
+  signal: AbortSignal | null = null,
+  progressCallback?: ProgressCallback,
+  threads: number = Math.trunc(Math.max(getHardwareConcurrency() / 2, 1)),
+): Promise<ProcessResult> {
+  console.debug("scrypt algo");
+
+  const webWorkerURL = `${options.basePrefix}/.within.website/x/cmd/anubis/static/js/worker/scrypt.mjs?cacheBuster=${options.version}`;
+
+  const spawner = await createWorkerSpawner(webWorkerURL, signal);
+
+  try {
+    return await runWorkers(
+      spawner,
+      data,
+      difficulty,
+      signal,
+      progressCallback,
+      threads,
+      {
+        memory: options.memory ?? defaultMemory,
+        iterations: options.iterations ?? defaultIterations,
+      },
+    );
+  } finally {
+    spawner.dispose();
+  }
+}
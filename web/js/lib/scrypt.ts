@@ -0,0 +1,165 @@
+import { Sha256 } from "@aws-crypto/sha256-js";
+
+// scrypt (RFC 7914) with a 32 byte output, matching internal.ScryptSum on the
+// server. WebCrypto doesn't expose scrypt, so this is done by hand.
+
+// The scrypt r parameter. With r = 8 every unit of N costs 1 KiB of memory.
+const r = 8;
+// Number of 32-bit words in one scrypt block (128 * r bytes).
+const blockWords = 32 * r;
+
+const hmacSHA256 = async (
+  key: Uint8Array,
+  data: Uint8Array,
+): Promise<Uint8Array> => {
+  const hash = new Sha256(key);
+  hash.update(data);
+  return await hash.digest();
+};
+
+// PBKDF2-HMAC-SHA256 with a single iteration, which is all scrypt uses it for.
+const pbkdf2 = async (
+  password: Uint8Array,
+  salt: Uint8Array,
+  length: number,
+): Promise<Uint8Array> => {
+  const out = new Uint8Array(length);
+  const block = new Uint8Array(salt.length + 4);
+  block.set(salt);
+
+  for (let i = 1, offset = 0; offset < length; i++, offset += 32) {
+    block[salt.length] = i >>> 24;
+    block[salt.length + 1] = i >>> 16;
+    block[salt.length + 2] = i >>> 8;
+    block[salt.length + 3] = i;
+
+    const t = await hmacSHA256(password, block);
+    out.set(t.subarray(0, Math.min(32, length - offset)), offset);
+  }
+
+  return out;
+};
+
+const rotl = (a: number, b: number): number => (a << b) | (a >>> (32 - b));
+
+// salsa208 runs the Salsa20/8 core over the 16 words in b in place, using x
+// as scratch space.
+const salsa208 = (b: Uint32Array, x: Uint32Array) => {
+  x.set(b);
+
+  for (let i = 0; i < 8; i += 2) {
+    x[4] ^= rotl(x[0] + x[12], 7);
+    x[8] ^= rotl(x[4] + x[0], 9);
+    x[12] ^= rotl(x[8] + x[4], 13);
+    x[0] ^= rotl(x[12] + x[8], 18);
+    x[9] ^= rotl(x[5] + x[1], 7);
+    x[13] ^= rotl(x[9] + x[5], 9);
+    x[1] ^= rotl(x[13] + x[9], 13);
+    x[5] ^= rotl(x[1] + x[13], 18);
+    x[14] ^= rotl(x[10] + x[6], 7);
+    x[2] ^= rotl(x[14] + x[10], 9);
+    x[6] ^= rotl(x[2] + x[14], 13);
+    x[10] ^= rotl(x[6] + x[2], 18);
+    x[3] ^= rotl(x[15] + x[11], 7);
+    x[7] ^= rotl(x[3] + x[15], 9);
+    x[11] ^= rotl(x[7] + x[3], 13);
+    x[15] ^= rotl(x[11] + x[7], 18);
+
+    x[1] ^= rotl(x[0] + x[3], 7);
+    x[2] ^= rotl(x[1] + x[0], 9);
+    x[3] ^= rotl(x[2] + x[1], 13);
+    x[0] ^= rotl(x[3] + x[2], 18);
+    x[6] ^= rotl(x[5] + x[4], 7);
+    x[7] ^= rotl(x[6] + x[5], 9);
+    x[4] ^= rotl(x[7] + x[6], 13);
+    x[5] ^= rotl(x[4] + x[7], 18);
+    x[11] ^= rotl(x[10] + x[9], 7);
+    x[8] ^= rotl(x[11] + x[10], 9);
+    x[9] ^= rotl(x[8] + x[11], 13);
+    x[10] ^= rotl(x[9] + x[8], 18);
+    x[12] ^= rotl(x[15] + x[14], 7);
+    x[13] ^= rotl(x[12] + x[15], 9);
+    x[14] ^= rotl(x[13] + x[12], 13);
+    x[15] ^= rotl(x[14] + x[13], 18);
+  }
+
+  for (let i = 0; i < 16; i++) {
+    b[i] += x[i];
+  }
+};
+
+// Scratch space shared by every hash in this worker so that each attempt
+// doesn't allocate (and then garbage collect) the whole memory cost.
+let v = new Uint32Array(0);
+const xBlock = new Uint32Array(blockWords);
+const yBlock = new Uint32Array(blockWords);
+const tBlock = new Uint32Array(16);
+const sBlock = new Uint32Array(16);
+
+const blockMix = (b: Uint32Array) => {
+  tBlock.set(b.subarray((2 * r - 1) * 16));
+
+  for (let i = 0; i < 2 * r; i++) {
+    for (let j = 0; j < 16; j++) {
+      tBlock[j] ^= b[i * 16 + j];
+    }
+    salsa208(tBlock, sBlock);
+    // Even blocks go to the first half of the output, odd ones to the second.
+    yBlock.set(tBlock, ((i >> 1) + (i & 1) * r) * 16);
+  }
+
+  b.set(yBlock);
+};
+
+const roMix = (b: Uint8Array, n: number) => {
+  if (v.length !== n * blockWords) {
+    v = new Uint32Array(n * blockWords);
+  }
+
+  for (let i = 0; i < blockWords; i++) {
+    xBlock[i] =
+      b[i * 4] |
+      (b[i * 4 + 1] << 8) |
+      (b[i * 4 + 2] << 16) |
+      (b[i * 4 + 3] << 24);
+  }
+
+  for (let i = 0; i < n; i++) {
+    v.set(xBlock, i * blockWords);
+    blockMix(xBlock);
+  }
+
+  for (let i = 0; i < n; i++) {
+    const j = (xBlock[(2 * r - 1) * 16] & (n - 1)) * blockWords;
+    for (let k = 0; k < blockWords; k++) {
+      xBlock[k] ^= v[j + k];
+    }
+    blockMix(xBlock);
+  }
+
+  for (let i = 0; i < blockWords; i++) {
+    b[i * 4] = xBlock[i];
+    b[i * 4 + 1] = xBlock[i] >>> 8;
+    b[i * 4 + 2] = xBlock[i] >>> 16;
+    b[i * 4 + 3] = xBlock[i] >>> 24;
+  }
+};
+
+/**
+ * scrypt hashes password with salt. memory is the cost in KiB (the scrypt N
+ * parameter) and must be a power of two, iterations is the scrypt p parameter.
+ */
+export const scrypt = async (
+  password: Uint8Array,
+  salt: Uint8Array,
+  memory: number,
+  iterations: number,
+): Promise<Uint8Array> => {
+  const b = await pbkdf2(password, salt, iterations * blockWords * 4);
+
+  for (let i = 0; i < iterations; i++) {
+    roMix(b.subarray(i * blockWords * 4, (i + 1) * blockWords * 4), memory);
+  }
+
+  return await pbkdf2(password, b, 32);
+};
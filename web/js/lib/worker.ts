@@ -10,6 +10,9 @@ export type ProgressCallback = (nonce: number) => void;
 export interface ProcessOptions {
   basePrefix: string;
   version: string;
+  // Only used by memory-hard algorithms.
+  memory?: number;
+  iterations?: number;
 }
 
 export interface ProcessResult {
@@ -24,6 +27,9 @@ export interface WorkerArgs {
   difficulty: number;
   nonce: number;
   threads: number;
+  // Only used by memory-hard algorithms.
+  memory?: number;
+  iterations?: number;
 }
 
 // A spawner hands out workers that all run the same script. Which flavour of
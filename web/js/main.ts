@@ -179,7 +179,12 @@ interface OhNoesParams {
   try {
     const t0 = Date.now();
     const { hash, nonce } = await process(
-      { basePrefix, version: anubisVersion },
+      {
+        basePrefix,
+        version: anubisVersion,
+        memory: rules.memory,
+        iterations: rules.iterations,
+      },
       challenge.randomData,
       rules.difficulty,
       null,
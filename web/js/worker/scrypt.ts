@@ -0,0 +1,66 @@
+import { scrypt } from "@lib/scrypt";
+import { WorkerArgs } from "@lib/worker";
+
+function toHexString(arr: Uint8Array): string {
+  return Array.from(arr)
+    .map((c) => c.toString(16).padStart(2, "0"))
+    .join("");
+}
+
+addEventListener(
+  "message",
+  async ({ data: eventData }: { data: WorkerArgs }) => {
+    const { data, difficulty, threads, memory, iterations } = eventData;
+    let nonce = eventData.nonce;
+    const isMainThread = nonce === 0;
+    let attempts = 0;
+
+    const encoder = new TextEncoder();
+    const salt = encoder.encode(data);
+
+    const requiredZeroBytes = Math.floor(difficulty / 2);
+    const isDifficultyOdd = difficulty % 2 !== 0;
+
+    for (;;) {
+      const hashArray = await scrypt(
+        encoder.encode(data + nonce),
+        salt,
+        memory!,
+        iterations!,
+      );
+
+      let isValid = true;
+      for (let i = 0; i < requiredZeroBytes; i++) {
+        if (hashArray[i] !== 0) {
+          isValid = false;
+          break;
+        }
+      }
+
+      if (isValid && isDifficultyOdd) {
+        if (hashArray[requiredZeroBytes] >> 4 !== 0) {
+          isValid = false;
+        }
+      }
+
+      if (isValid) {
+        postMessage({
+          hash: toHexString(hashArray),
+          data,
+          difficulty,
+          nonce,
+        });
+        return; // Exit worker
+      }
+
+      nonce += threads;
+      attempts++;
+
+      // Every attempt is expensive, so report progress far more often than the
+      // sha256 workers do.
+      if (isMainThread && (attempts & 3) === 0) {
+        postMessage(nonce);
+      }
+    }
+  },
+);
@@ -33,7 +33,13 @@ func init() {
 
 // Mount registers the xess static file handlers on the given mux
 func Mount(mux *http.ServeMux) {
-	prefix := anubis.BasePrefix + "/.within.website/x/xess/"
+	MountWithPrefix(mux, "")
+}
+
+// MountWithPrefix registers the xess static file handlers on the given mux
+// under basePrefix.
+func MountWithPrefix(mux *http.ServeMux, basePrefix string) {
+	prefix := basePrefix + BasePrefix
 
 	mux.Handle(prefix, internal.UnchangingCache(http.StripPrefix(prefix, http.FileServerFS(Static))))
 }
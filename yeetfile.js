@@ -34,6 +34,7 @@ const packages = methods.map(([goos, goarch, methods]) => {
       build: ({ bin, etc, systemd, doc }) => {
         $`go build -trimpath -o ${bin}/anubis${exe} -ldflags '-s -w -extldflags "-static"' ./cmd/anubis`;
         $`go build -trimpath -o ${bin}/anubis-robots2policy${exe} -ldflags '-s -w -extldflags "-static"' ./cmd/robots2policy`;
+        $`go build -trimpath -o ${bin}/anubisctl${exe} -ldflags '-s -w -extldflags "-static"' ./cmd/anubisctl`;
 
         if (goos == "linux") {
           file.install("./run/anubis@.service", `${systemd}/anubis@.service`);